@@ -2,33 +2,86 @@ package data
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 // CollectionDefinition contains the main name structure for a rest API collection
 type CollectionDefinition struct {
-	Name   string            `json:"name"`
-	Fields map[string]string `json:"fields"`
+	Name   string                     `json:"name"`
+	Fields map[string]FieldDefinition `json:"fields"`
+	// IDStrategy how item IDs are obtained, IDs generated by the storage are used by default
+	IDStrategy string `json:"id_strategy,omitempty"`
 }
 
 // IsDataValid check if the specified item map contains valid structure and field types based on the collection definition
 func (cd CollectionDefinition) IsDataValid(item map[string]interface{}) bool {
-	for itemKey := range item {
-		if !cd.isFieldNameValid(itemKey) ||
-			!cd.isFieldTypeValid(itemKey, item[itemKey]) {
-			return false
+	return len(cd.Validate(item)) == 0
+}
+
+// ApplyDefaults set the default value for all missing fields declaring a default value, including nested objects
+func (cd CollectionDefinition) ApplyDefaults(item map[string]interface{}) {
+	applyDefaults(cd.Fields, item)
+}
+
+// MissingRequiredFields returns the sorted list of required fields not found in the item, including nested
+// objects fields, e.g. "address.zip"
+func (cd CollectionDefinition) MissingRequiredFields(item map[string]interface{}) []string {
+	missing := missingRequiredFields(cd.Fields, item, "")
+	sort.Strings(missing)
+	return missing
+}
+
+// FieldByPath get the field definition for a dot separated path, e.g. "address.zip". Arrays of nested objects can be
+// traversed too, e.g. "authors.name", in that case the path can contain multiple values so the definition obtained
+// is an array of the nested field type
+func (cd CollectionDefinition) FieldByPath(path string) (FieldDefinition, bool) {
+	names := strings.Split(path, ".")
+	field, exists := cd.Fields[names[0]]
+	if !exists {
+		return FieldDefinition{}, false
+	}
+	multipleValues := false
+	for _, name := range names[1:] {
+		if field.Type == FieldTypeArray && field.Items != nil {
+			multipleValues = true
+			field = *field.Items
+		}
+		if field.Type != FieldTypeObject {
+			return FieldDefinition{}, false
+		}
+		if field, exists = field.Fields[name]; !exists {
+			return FieldDefinition{}, false
 		}
 	}
-	return true
+	if multipleValues && field.Type != FieldTypeArray {
+		return FieldDefinition{Type: FieldTypeArray, Items: &field}, true
+	}
+	return field, true
 }
 
-func (cd CollectionDefinition) isFieldNameValid(name string) bool {
-	_, exists := cd.Fields[name]
-	return exists
+// ParseFieldValue converts a raw string value (e.g. obtained from a query string) into the type declared for the
+// field path. For array fields the type declared for the elements is used
+func (cd CollectionDefinition) ParseFieldValue(name string, value string) (interface{}, error) {
+	field, exists := cd.FieldByPath(name)
+	if !exists {
+		return nil, fmt.Errorf("unknown field '%s'", name)
+	}
+	if field.Type == FieldTypeArray && field.Items != nil {
+		field = *field.Items
+	}
+	scalar, exists := scalarTypes[field.Type]
+	if !exists {
+		return nil, fmt.Errorf("unsupported type '%s' for field '%s'", field.Type, name)
+	}
+	if parsed, ok := scalar.parse(field, value); ok {
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("invalid value '%s' for field '%s', %s expected", value, name, field.Type)
 }
 
-func (cd CollectionDefinition) isFieldTypeValid(name string, value interface{}) bool {
-	definitionType := cd.Fields[name]
-	valueType := fmt.Sprintf("%T", value)
-	return strings.Contains(valueType, definitionType)
+// ToNative converts the item values into the go types used by storages, e.g. RFC 3339 strings into dates for
+// datetime fields. It must be called once the item is validated
+func (cd CollectionDefinition) ToNative(item map[string]interface{}) {
+	toNative(cd.Fields, item)
 }
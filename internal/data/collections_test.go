@@ -1,15 +1,19 @@
 package data
 
-import "testing"
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
 
 func TestCollectionDefinition_IsDataValid(t *testing.T) {
 	collection := CollectionDefinition{
 		Name: "test",
-		Fields: map[string]string{
-			"name": "string",
-			"lastname": "string",
-			"age": "float",
-			"is_active": "bool",
+		Fields: map[string]FieldDefinition{
+			"name": {Type: "string"},
+			"lastname": {Type: "string"},
+			"age": {Type: "float"},
+			"is_active": {Type: "bool"},
 		},
 	}
 
@@ -26,11 +30,11 @@ func TestCollectionDefinition_IsDataValid(t *testing.T) {
 func TestCollectionDefinition_IsDataValid_partial(t *testing.T) {
 	collection := CollectionDefinition{
 		Name: "test",
-		Fields: map[string]string{
-			"name": "string",
-			"lastname": "string",
-			"age": "float",
-			"is_active": "bool",
+		Fields: map[string]FieldDefinition{
+			"name": {Type: "string"},
+			"lastname": {Type: "string"},
+			"age": {Type: "float"},
+			"is_active": {Type: "bool"},
 		},
 	}
 
@@ -45,11 +49,11 @@ func TestCollectionDefinition_IsDataValid_partial(t *testing.T) {
 func TestCollectionDefinition_IsDataValid_failsMismatchingFieldNames(t *testing.T) {
 	collection := CollectionDefinition{
 		Name: "test",
-		Fields: map[string]string{
-			"name": "string",
-			"lastname": "string",
-			"age": "float",
-			"is_active": "bool",
+		Fields: map[string]FieldDefinition{
+			"name": {Type: "string"},
+			"lastname": {Type: "string"},
+			"age": {Type: "float"},
+			"is_active": {Type: "bool"},
 		},
 	}
 
@@ -63,8 +67,8 @@ func TestCollectionDefinition_IsDataValid_failsMismatchingFieldNames(t *testing.
 func TestCollectionDefinition_IsDataValid_failsMismatchingFieldTypeBool(t *testing.T) {
 	collection := CollectionDefinition{
 		Name: "test",
-		Fields: map[string]string{
-			"expected": "bool",
+		Fields: map[string]FieldDefinition{
+			"expected": {Type: "bool"},
 		},
 	}
 
@@ -78,8 +82,8 @@ func TestCollectionDefinition_IsDataValid_failsMismatchingFieldTypeBool(t *testi
 func TestCollectionDefinition_IsDataValid_failsMismatchingFieldTypeString(t *testing.T) {
 	collection := CollectionDefinition{
 		Name: "test",
-		Fields: map[string]string{
-			"expected": "string",
+		Fields: map[string]FieldDefinition{
+			"expected": {Type: "string"},
 		},
 	}
 
@@ -93,8 +97,8 @@ func TestCollectionDefinition_IsDataValid_failsMismatchingFieldTypeString(t *tes
 func TestCollectionDefinition_IsDataValid_failsMismatchingFieldTypeFloat(t *testing.T) {
 	collection := CollectionDefinition{
 		Name: "test",
-		Fields: map[string]string{
-			"expected": "float",
+		Fields: map[string]FieldDefinition{
+			"expected": {Type: "float"},
 		},
 	}
 
@@ -104,3 +108,152 @@ func TestCollectionDefinition_IsDataValid_failsMismatchingFieldTypeFloat(t *test
 		t.Fatalf("unexpected success result")
 	}
 }
+
+func TestCollectionDefinition_ParseFieldValue(t *testing.T) {
+	collection := CollectionDefinition{
+		Name: "test",
+		Fields: map[string]FieldDefinition{
+			"name":      {Type: "string"},
+			"age":       {Type: "float"},
+			"is_active": {Type: "bool"},
+		},
+	}
+
+	cases := map[string]interface{}{
+		"name":      "Bob",
+		"age":       20.5,
+		"is_active": true,
+	}
+	raw := map[string]string{
+		"name":      "Bob",
+		"age":       "20.5",
+		"is_active": "true",
+	}
+	for field, expected := range cases {
+		value, err := collection.ParseFieldValue(field, raw[field])
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		if value != expected {
+			t.Fatalf("unexpected value %v for field %s", value, field)
+		}
+	}
+}
+
+func TestCollectionDefinition_ParseFieldValue_fails(t *testing.T) {
+	collection := CollectionDefinition{
+		Name: "test",
+		Fields: map[string]FieldDefinition{
+			"age":       {Type: "float"},
+			"is_active": {Type: "bool"},
+		},
+	}
+
+	if _, err := collection.ParseFieldValue("age", "not a float"); err == nil {
+		t.Fatalf("unexpected success result for float field")
+	}
+	if _, err := collection.ParseFieldValue("is_active", "not a bool"); err == nil {
+		t.Fatalf("unexpected success result for bool field")
+	}
+	if _, err := collection.ParseFieldValue("unknown", "value"); err == nil {
+		t.Fatalf("unexpected success result for unknown field")
+	}
+}
+
+func TestCollectionDefinition_UnmarshalJSON(t *testing.T) {
+	var collection CollectionDefinition
+	err := json.Unmarshal([]byte(`{
+		"name": "books",
+		"fields": {
+			"title": {"type": "string", "required": true},
+			"author": "string",
+			"year": {"type": "float", "nullable": true},
+			"tags": {"type": "string", "default": "none"}
+		}
+	}`), &collection)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	expected := map[string]FieldDefinition{
+		"title":  {Type: "string", Required: true},
+		"author": {Type: "string"},
+		"year":   {Type: "float", Nullable: true},
+		"tags":   {Type: "string", Default: "none"},
+	}
+	if !reflect.DeepEqual(collection.Fields, expected) {
+		t.Fatalf("unexpected fields %v", collection.Fields)
+	}
+}
+
+func TestCollectionDefinition_UnmarshalJSON_invalidField(t *testing.T) {
+	var collection CollectionDefinition
+	if err := json.Unmarshal([]byte(`{"name": "books", "fields": {"title": 1}}`), &collection); err == nil {
+		t.Fatalf("unexpected success result")
+	}
+}
+
+func TestFieldDefinition_MarshalJSON(t *testing.T) {
+	data, _ := json.Marshal(map[string]FieldDefinition{
+		"author": {Type: "string"},
+		"title":  {Type: "string", Required: true},
+	})
+	if string(data) != `{"author":"string","title":{"type":"string","required":true}}` {
+		t.Fatalf("unexpected json: " + string(data))
+	}
+}
+
+func TestCollectionDefinition_IsDataValid_nullable(t *testing.T) {
+	collection := CollectionDefinition{
+		Name: "test",
+		Fields: map[string]FieldDefinition{
+			"nullable":     {Type: "string", Nullable: true},
+			"not_nullable": {Type: "string"},
+		},
+	}
+
+	if !collection.IsDataValid(map[string]interface{}{"nullable": nil}) {
+		t.Fatalf("unexpected invalid data for nullable field")
+	}
+	if collection.IsDataValid(map[string]interface{}{"not_nullable": nil}) {
+		t.Fatalf("unexpected success result for non nullable field")
+	}
+}
+
+func TestCollectionDefinition_ApplyDefaults(t *testing.T) {
+	collection := CollectionDefinition{
+		Name: "test",
+		Fields: map[string]FieldDefinition{
+			"name":   {Type: "string", Default: "unknown"},
+			"status": {Type: "string", Default: "active"},
+			"age":    {Type: "float"},
+		},
+	}
+
+	item := map[string]interface{}{"name": "Bob"}
+	collection.ApplyDefaults(item)
+	expected := map[string]interface{}{"name": "Bob", "status": "active"}
+	if !reflect.DeepEqual(item, expected) {
+		t.Fatalf("unexpected item %v", item)
+	}
+}
+
+func TestCollectionDefinition_MissingRequiredFields(t *testing.T) {
+	collection := CollectionDefinition{
+		Name: "test",
+		Fields: map[string]FieldDefinition{
+			"name":     {Type: "string", Required: true},
+			"lastname": {Type: "string", Required: true},
+			"age":      {Type: "float", Required: true, Nullable: true},
+			"phone":    {Type: "string"},
+		},
+	}
+
+	missing := collection.MissingRequiredFields(map[string]interface{}{"age": nil})
+	if !reflect.DeepEqual(missing, []string{"lastname", "name"}) {
+		t.Fatalf("unexpected missing fields %v", missing)
+	}
+	missing = collection.MissingRequiredFields(map[string]interface{}{"name": "Bob", "lastname": "Howards", "age": 20.0})
+	if len(missing) != 0 {
+		t.Fatalf("unexpected missing fields %v", missing)
+	}
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// patterns compiled regular expressions used by field constraints, indexed by the pattern declared in the manifest
+var patterns sync.Map
+
+// UniqueFields returns the sorted list of top level fields declared as unique
+func (cd CollectionDefinition) UniqueFields() []string {
+	var unique []string
+	for name, field := range cd.Fields {
+		if field.Unique {
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// SearchableFields returns the sorted list of fields declared as searchable, nested fields are included using their
+// dot separated path
+func (cd CollectionDefinition) SearchableFields() []string {
+	searchable := searchableFields(cd.Fields, "")
+	sort.Strings(searchable)
+	return searchable
+}
+
+func searchableFields(fields map[string]FieldDefinition, prefix string) []string {
+	var searchable []string
+	for name, field := range fields {
+		if field.Searchable {
+			searchable = append(searchable, prefix+name)
+		}
+		if field.Type == FieldTypeArray && field.Items != nil {
+			field = *field.Items
+		}
+		searchable = append(searchable, searchableFields(field.Fields, prefix+name+".")...)
+	}
+	return searchable
+}
+
+// validateConstraints check the constraints declared are supported by the field type
+func (fd FieldDefinition) validateConstraints() error {
+	if (fd.Min != nil || fd.Max != nil) && fd.Type != "float" && fd.Type != FieldTypeInteger {
+		return fmt.Errorf("min and max constraints not supported for type '%s'", fd.Type)
+	}
+	if fd.Min != nil && fd.Max != nil && *fd.Min > *fd.Max {
+		return fmt.Errorf("invalid min and max constraints, min is greater than max")
+	}
+	if (fd.MinLength != nil || fd.MaxLength != nil) && !fd.SupportsContains() && fd.Type != FieldTypeArray {
+		return fmt.Errorf("minLength and maxLength constraints not supported for type '%s'", fd.Type)
+	}
+	if fd.MinLength != nil && fd.MaxLength != nil && *fd.MinLength > *fd.MaxLength {
+		return fmt.Errorf("invalid minLength and maxLength constraints, minLength is greater than maxLength")
+	}
+	if fd.Pattern != "" {
+		if !fd.SupportsContains() {
+			return fmt.Errorf("pattern constraint not supported for type '%s'", fd.Type)
+		}
+		if _, err := compilePattern(fd.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern '%s'", fd.Pattern)
+		}
+	}
+	if fd.Unique && (fd.Type == FieldTypeObject || fd.Type == FieldTypeArray) {
+		return fmt.Errorf("unique constraint not supported for type '%s'", fd.Type)
+	}
+	textArray := fd.Type == FieldTypeArray && fd.Items != nil && fd.Items.SupportsContains()
+	if fd.Searchable && !fd.SupportsContains() && !textArray {
+		return fmt.Errorf("searchable not supported for type '%s'", fd.Type)
+	}
+	return nil
+}
+
+// compilePattern compiled patterns are cached, so they are compiled only once
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if compiled, exists := patterns.Load(pattern); exists {
+		return compiled.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, compiled)
+	return compiled, nil
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func createConstrainedCollectionDefinition(t *testing.T) CollectionDefinition {
+	var collection CollectionDefinition
+	err := json.Unmarshal([]byte(`{
+		"name": "books",
+		"fields": {
+			"title": {"type": "string", "minLength": 1, "maxLength": 10},
+			"year": {"type": "integer", "min": 1450},
+			"isbn": {"type": "string", "pattern": "^[0-9]{3}-[0-9]{10}$", "unique": true},
+			"tags": {"type": "array", "items": "string", "maxLength": 2},
+			"email": {"type": "email", "unique": true}
+		}
+	}`), &collection)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	return collection
+}
+
+func TestCollectionDefinition_IsDataValid_constraints(t *testing.T) {
+	collection := createConstrainedCollectionDefinition(t)
+
+	if !collection.IsDataValid(map[string]interface{}{
+		"title": "The Hobbit",
+		"year":  1937.0,
+		"isbn":  "978-0261103283",
+		"tags":  []interface{}{"fantasy"},
+	}) {
+		t.Fatalf("unexpected invalid data")
+	}
+
+	invalidItems := []map[string]interface{}{
+		{"title": ""},
+		{"title": "The Lord of the Rings"},
+		{"year": 1200.0},
+		{"isbn": "0261103283"},
+		{"tags": []interface{}{"fantasy", "classic", "adventure"}},
+	}
+	for _, item := range invalidItems {
+		if collection.IsDataValid(item) {
+			t.Errorf("unexpected valid data %v", item)
+		}
+	}
+}
+
+func TestFieldDefinition_UnmarshalJSON_invalidConstraints(t *testing.T) {
+	cases := []string{
+		`{"type": "string", "min": 1}`,
+		`{"type": "float", "min": 10, "max": 1}`,
+		`{"type": "bool", "maxLength": 1}`,
+		`{"type": "string", "minLength": 10, "maxLength": 1}`,
+		`{"type": "string", "pattern": "["}`,
+		`{"type": "float", "pattern": "^1$"}`,
+		`{"type": "array", "items": "string", "unique": true}`,
+		`{"type": "integer", "searchable": true}`,
+		`{"type": "array", "items": "float", "searchable": true}`,
+		`{"type": "integer", "min": 10, "default": 1}`,
+	}
+	for _, c := range cases {
+		var field FieldDefinition
+		if err := json.Unmarshal([]byte(c), &field); err == nil {
+			t.Errorf("unexpected success result for %s", c)
+		}
+	}
+}
+
+func TestCollectionDefinition_UniqueFields(t *testing.T) {
+	collection := createConstrainedCollectionDefinition(t)
+	if unique := collection.UniqueFields(); !reflect.DeepEqual(unique, []string{"email", "isbn"}) {
+		t.Fatalf("unexpected unique fields %v", unique)
+	}
+}
+
+func TestCollectionDefinition_SearchableFields(t *testing.T) {
+	var collection CollectionDefinition
+	err := json.Unmarshal([]byte(`{
+		"name": "books",
+		"fields": {
+			"title": {"type": "string", "searchable": true},
+			"year": "integer",
+			"tags": {"type": "array", "items": "string", "searchable": true},
+			"authors": [{"name": {"type": "string", "searchable": true}}],
+			"publisher": {"name": {"type": "string", "searchable": true}, "country": "string"}
+		}
+	}`), &collection)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	expected := []string{"authors.name", "publisher.name", "tags", "title"}
+	if searchable := collection.SearchableFields(); !reflect.DeepEqual(searchable, expected) {
+		t.Fatalf("unexpected searchable fields %v", searchable)
+	}
+}
@@ -0,0 +1,247 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	//FieldTypeObject type used for nested objects, nested fields are declared in FieldDefinition.Fields
+	FieldTypeObject = "object"
+	//FieldTypeArray type used for arrays, the type for the elements is declared in FieldDefinition.Items
+	FieldTypeArray = "array"
+)
+
+// FieldDefinition contains the type and rules for a single collection field. It can be declared in the manifest
+// using a short form or using an object with all the attributes:
+//  - "string": type name
+//  - "enum:[value1,value2]": enum type with the allowed values
+//  - "[string]" or ["string"]: array with elements of the specified type
+//  - {"street": "string", "zip": "string"}: object with the specified nested fields
+//  - {"type": "string", "required": true, ...}: object form with all the attributes
+type FieldDefinition struct {
+	Type     string                     `json:"type"`
+	Required bool                       `json:"required,omitempty"`
+	Default  interface{}                `json:"default,omitempty"`
+	Nullable bool                       `json:"nullable,omitempty"`
+	Items    *FieldDefinition           `json:"items,omitempty"`
+	Fields   map[string]FieldDefinition `json:"fields,omitempty"`
+	Values   []string                   `json:"values,omitempty"`
+	// Min and Max inclusive limits for numeric fields
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// MinLength and MaxLength inclusive limits for the length of text fields or the amount of array elements
+	MinLength *int `json:"minLength,omitempty"`
+	MaxLength *int `json:"maxLength,omitempty"`
+	// Pattern regular expression text fields must match
+	Pattern string `json:"pattern,omitempty"`
+	// Unique the same value can't be used by multiple items of the collection, only for top level fields
+	Unique bool `json:"unique,omitempty"`
+	// Searchable the field is used by the full text search, only for text fields or arrays of text elements
+	Searchable bool `json:"searchable,omitempty"`
+}
+
+// fieldDefinitionAttributes used to parse the object form, preventing a recursive call to FieldDefinition.UnmarshalJSON
+type fieldDefinitionAttributes FieldDefinition
+
+// attributeNames json names for all FieldDefinition attributes, used to detect the object form
+var attributeNames = func() map[string]bool {
+	names := map[string]bool{}
+	attributesType := reflect.TypeOf(fieldDefinitionAttributes{})
+	for i := 0; i < attributesType.NumField(); i++ {
+		name := strings.Split(attributesType.Field(i).Tag.Get("json"), ",")[0]
+		names[name] = true
+	}
+	return names
+}()
+
+// UnmarshalJSON implements json.Unmarshaler, all short forms and the object form are supported.
+// An object is handled as the object form when it contains a string 'type' and only known attributes,
+// otherwise it's handled as a nested object declaration
+func (fd *FieldDefinition) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return fmt.Errorf("invalid field definition")
+	}
+	switch data[0] {
+	case '"':
+		var fieldType string
+		if err := json.Unmarshal(data, &fieldType); err != nil {
+			return err
+		}
+		return fd.parseShortType(fieldType)
+	case '[':
+		var items []FieldDefinition
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		if len(items) != 1 {
+			return fmt.Errorf("invalid array field definition: %s", string(data))
+		}
+		*fd = FieldDefinition{Type: FieldTypeArray, Items: &items[0]}
+		return nil
+	case '{':
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(data, &attributes); err != nil {
+			return err
+		}
+		if isObjectForm(attributes) {
+			var definition fieldDefinitionAttributes
+			if err := json.Unmarshal(data, &definition); err != nil {
+				return fmt.Errorf("invalid field definition: %s", string(data))
+			}
+			*fd = FieldDefinition(definition)
+			return fd.validateDefinition()
+		}
+		var fields map[string]FieldDefinition
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		*fd = FieldDefinition{Type: FieldTypeObject, Fields: fields}
+		return nil
+	}
+	return fmt.Errorf("invalid field definition: %s", string(data))
+}
+
+// MarshalJSON implements json.Marshaler, the short form is used when only the type is declared
+func (fd FieldDefinition) MarshalJSON() ([]byte, error) {
+	if reflect.DeepEqual(fd, FieldDefinition{Type: fd.Type}) {
+		return json.Marshal(fd.Type)
+	}
+	return json.Marshal(fieldDefinitionAttributes(fd))
+}
+
+// parseShortType parse a type name, including array types like "[string]"
+func (fd *FieldDefinition) parseShortType(fieldType string) error {
+	if strings.HasPrefix(fieldType, "[") && strings.HasSuffix(fieldType, "]") {
+		items := &FieldDefinition{}
+		if err := items.parseShortType(fieldType[1 : len(fieldType)-1]); err != nil {
+			return err
+		}
+		*fd = FieldDefinition{Type: FieldTypeArray, Items: items}
+		return nil
+	}
+	*fd = FieldDefinition{Type: fieldType}
+	return fd.validateDefinition()
+}
+
+// validateDefinition check the type is supported and the default value is valid for the type, enum values
+// declared in the type name are moved to FieldDefinition.Values
+func (fd *FieldDefinition) validateDefinition() error {
+	if strings.HasPrefix(fd.Type, enumPrefix) {
+		values, err := parseEnumType(fd.Type)
+		if err != nil {
+			return err
+		}
+		fd.Type = FieldTypeEnum
+		fd.Values = values
+	}
+	if _, exists := scalarTypes[fd.Type]; !exists && fd.Type != FieldTypeObject && fd.Type != FieldTypeArray {
+		return fmt.Errorf("unsupported field type '%s'", fd.Type)
+	}
+	if fd.Type == FieldTypeEnum && len(fd.Values) == 0 {
+		return fmt.Errorf("missing values for enum type")
+	}
+	if err := fd.validateConstraints(); err != nil {
+		return err
+	}
+	if fd.Default != nil && !fd.isValueValid(fd.Default) {
+		return fmt.Errorf("invalid default value %v for type '%s'", fd.Default, fd.Type)
+	}
+	return nil
+}
+
+func isObjectForm(attributes map[string]json.RawMessage) bool {
+	var fieldType string
+	if err := json.Unmarshal(attributes["type"], &fieldType); err != nil {
+		return false
+	}
+	for name := range attributes {
+		if !attributeNames[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// isValueValid check the value type and constraints, nested objects and array elements are validated recursively
+func (fd FieldDefinition) isValueValid(value interface{}) bool {
+	return len(fd.validateValue(value, "")) == 0
+}
+
+// applyDefaults set the default value for all missing fields, nested objects are handled recursively
+func applyDefaults(fields map[string]FieldDefinition, object map[string]interface{}) {
+	for name, field := range fields {
+		value, exists := object[name]
+		if !exists && field.Default != nil {
+			object[name] = copyValue(field.Default)
+			continue
+		}
+		field.forEachObject(value, func(nested map[string]interface{}, nestedFields map[string]FieldDefinition, _ string) {
+			applyDefaults(nestedFields, nested)
+		})
+	}
+}
+
+// missingRequiredFields get the path for all required fields not found in the object, nested objects are handled
+// recursively, e.g. "address.zip" or "authors[1].name"
+func missingRequiredFields(fields map[string]FieldDefinition, object map[string]interface{}, prefix string) []string {
+	missing := []string{}
+	for name, field := range fields {
+		value, exists := object[name]
+		if !exists {
+			if field.Required {
+				missing = append(missing, prefix+name)
+			}
+			continue
+		}
+		field.forEachObject(value, func(nested map[string]interface{}, nestedFields map[string]FieldDefinition, path string) {
+			missing = append(missing, missingRequiredFields(nestedFields, nested, prefix+name+path+".")...)
+		})
+	}
+	return missing
+}
+
+// forEachObject calls the function for the value if it's a declared nested object, or for each array element
+// if they are declared nested objects. The path suffix for the object is provided, e.g. "" or "[1]"
+func (fd FieldDefinition) forEachObject(value interface{}, apply func(object map[string]interface{}, fields map[string]FieldDefinition, path string)) {
+	switch fd.Type {
+	case FieldTypeObject:
+		if object, ok := value.(map[string]interface{}); ok && fd.Fields != nil {
+			apply(object, fd.Fields, "")
+		}
+	case FieldTypeArray:
+		list, ok := value.([]interface{})
+		if !ok || fd.Items == nil {
+			return
+		}
+		for i, element := range list {
+			fd.Items.forEachObject(element, func(object map[string]interface{}, fields map[string]FieldDefinition, path string) {
+				apply(object, fields, "["+strconv.Itoa(i)+"]"+path)
+			})
+		}
+	}
+}
+
+// copyValue copy maps and arrays recursively, so default values are never shared between items
+func copyValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typed))
+		for key, element := range typed {
+			copied[key] = copyValue(element)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(typed))
+		for i, element := range typed {
+			copied[i] = copyValue(element)
+		}
+		return copied
+	}
+	return value
+}
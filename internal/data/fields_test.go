@@ -0,0 +1,173 @@
+package data
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func createNestedCollectionDefinition(t *testing.T) CollectionDefinition {
+	var collection CollectionDefinition
+	err := json.Unmarshal([]byte(`{
+		"name": "books",
+		"fields": {
+			"title": "string",
+			"tags": "[string]",
+			"ratings": ["float"],
+			"address": {"street": "string", "zip": {"type": "string", "required": true}},
+			"authors": [{"name": {"type": "string", "required": true}, "country": {"type": "string", "default": "unknown"}}],
+			"meta": {"type": "object", "fields": {"type": "string"}},
+			"matrix": "[[float]]"
+		}
+	}`), &collection)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	return collection
+}
+
+func TestFieldDefinition_UnmarshalJSON_nested(t *testing.T) {
+	collection := createNestedCollectionDefinition(t)
+	expected := map[string]FieldDefinition{
+		"title":   {Type: "string"},
+		"tags":    {Type: FieldTypeArray, Items: &FieldDefinition{Type: "string"}},
+		"ratings": {Type: FieldTypeArray, Items: &FieldDefinition{Type: "float"}},
+		"address": {Type: FieldTypeObject, Fields: map[string]FieldDefinition{
+			"street": {Type: "string"},
+			"zip":    {Type: "string", Required: true},
+		}},
+		"authors": {Type: FieldTypeArray, Items: &FieldDefinition{Type: FieldTypeObject, Fields: map[string]FieldDefinition{
+			"name":    {Type: "string", Required: true},
+			"country": {Type: "string", Default: "unknown"},
+		}}},
+		"meta": {Type: FieldTypeObject, Fields: map[string]FieldDefinition{
+			"type": {Type: "string"},
+		}},
+		"matrix": {Type: FieldTypeArray, Items: &FieldDefinition{Type: FieldTypeArray, Items: &FieldDefinition{Type: "float"}}},
+	}
+	if !reflect.DeepEqual(collection.Fields, expected) {
+		t.Fatalf("unexpected fields %v", collection.Fields)
+	}
+}
+
+func TestFieldDefinition_UnmarshalJSON_fails(t *testing.T) {
+	cases := []string{
+		`1`,
+		`""`,
+		`["string", "float"]`,
+		`[]`,
+		`{"street": 1}`,
+	}
+	for _, c := range cases {
+		var field FieldDefinition
+		if err := json.Unmarshal([]byte(c), &field); err == nil {
+			t.Errorf("unexpected success result for %s", c)
+		}
+	}
+}
+
+func TestFieldDefinition_MarshalJSON_nested(t *testing.T) {
+	collection := createNestedCollectionDefinition(t)
+	data, err := json.Marshal(collection)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	var parsed CollectionDefinition
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if !reflect.DeepEqual(collection, parsed) {
+		t.Fatalf("unexpected definition after marshal round trip %s", string(data))
+	}
+}
+
+func TestCollectionDefinition_IsDataValid_nested(t *testing.T) {
+	collection := createNestedCollectionDefinition(t)
+
+	if !collection.IsDataValid(map[string]interface{}{
+		"tags":    []interface{}{"fantasy", "classic"},
+		"ratings": []interface{}{4.5, 5.0},
+		"address": map[string]interface{}{"street": "Bag End", "zip": "1"},
+		"authors": []interface{}{map[string]interface{}{"name": "Tolkien"}},
+		"meta":    map[string]interface{}{"type": "novel"},
+		"matrix":  []interface{}{[]interface{}{1.0, 2.0}, []interface{}{}},
+	}) {
+		t.Fatalf("unexpected invalid data")
+	}
+
+	invalidItems := []map[string]interface{}{
+		{"title": map[string]interface{}{"nested": "string"}},
+		{"tags": "fantasy"},
+		{"tags": []interface{}{"fantasy", 1.0}},
+		{"address": "Bag End"},
+		{"address": map[string]interface{}{"street": 1.0}},
+		{"address": map[string]interface{}{"unknown": "value"}},
+		{"authors": []interface{}{map[string]interface{}{"name": true}}},
+		{"matrix": []interface{}{[]interface{}{"1"}}},
+	}
+	for _, item := range invalidItems {
+		if collection.IsDataValid(item) {
+			t.Errorf("unexpected success result for %v", item)
+		}
+	}
+}
+
+func TestCollectionDefinition_ApplyDefaults_nested(t *testing.T) {
+	collection := createNestedCollectionDefinition(t)
+	item := map[string]interface{}{
+		"authors": []interface{}{
+			map[string]interface{}{"name": "Tolkien"},
+			map[string]interface{}{"name": "Lewis", "country": "UK"},
+		},
+	}
+	collection.ApplyDefaults(item)
+	authors := item["authors"].([]interface{})
+	if authors[0].(map[string]interface{})["country"] != "unknown" || authors[1].(map[string]interface{})["country"] != "UK" {
+		t.Fatalf("unexpected item %v", item)
+	}
+}
+
+func TestCollectionDefinition_MissingRequiredFields_nested(t *testing.T) {
+	collection := createNestedCollectionDefinition(t)
+	missing := collection.MissingRequiredFields(map[string]interface{}{
+		"address": map[string]interface{}{"street": "Bag End"},
+		"authors": []interface{}{
+			map[string]interface{}{"name": "Tolkien"},
+			map[string]interface{}{},
+		},
+	})
+	if !reflect.DeepEqual(missing, []string{"address.zip", "authors[1].name"}) {
+		t.Fatalf("unexpected missing fields %v", missing)
+	}
+}
+
+func TestCollectionDefinition_FieldByPath(t *testing.T) {
+	collection := createNestedCollectionDefinition(t)
+
+	if field, exists := collection.FieldByPath("address.zip"); !exists || field.Type != "string" {
+		t.Fatalf("unexpected field %v", field)
+	}
+	if field, exists := collection.FieldByPath("authors.name"); !exists ||
+		field.Type != FieldTypeArray || field.Items.Type != "string" {
+		t.Fatalf("unexpected field %v", field)
+	}
+	for _, path := range []string{"unknown", "title.unknown", "address.unknown", "tags.unknown"} {
+		if _, exists := collection.FieldByPath(path); exists {
+			t.Errorf("unexpected field found for path %s", path)
+		}
+	}
+}
+
+func TestCollectionDefinition_ParseFieldValue_nested(t *testing.T) {
+	collection := createNestedCollectionDefinition(t)
+
+	if value, err := collection.ParseFieldValue("ratings", "4.5"); err != nil || value != 4.5 {
+		t.Fatalf("unexpected value %v", value)
+	}
+	if value, err := collection.ParseFieldValue("address.zip", "1"); err != nil || value != "1" {
+		t.Fatalf("unexpected value %v", value)
+	}
+	if _, err := collection.ParseFieldValue("address", "1"); err == nil {
+		t.Fatalf("unexpected success result for object field")
+	}
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// IDField name of the field including the item ID in the items returned by the api, it can't be declared in the
+// collection fields
+const IDField = "id"
+
+const (
+	// IDStrategyObjectID MongoDB ObjectIDs (24 hex characters) generated on item creation
+	IDStrategyObjectID = "objectid"
+	// IDStrategyUUID random UUIDs generated on item creation
+	IDStrategyUUID = "uuid"
+	// IDStrategyIncrement incremental numbers generated on item creation
+	IDStrategyIncrement = "increment"
+	// IDStrategyClient IDs provided by the client when the item is created
+	IDStrategyClient = "client"
+)
+
+// idPatterns ID format for each strategy
+var idPatterns = map[string]*regexp.Regexp{
+	IDStrategyObjectID: regexp.MustCompile(`^[0-9a-f]{24}$`),
+	IDStrategyUUID:     regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`),
+	// up to 18 digits, so any ID fits in an int64
+	IDStrategyIncrement: regexp.MustCompile(`^[1-9][0-9]{0,17}$`),
+	// only unreserved URL characters are accepted, so IDs can be used in paths without escaping. IDs starting with
+	// '_' are reserved for collection endpoints, e.g. _search, and IDs starting with '.' could be removed from the
+	// path when it's cleaned, e.g. '..'
+	IDStrategyClient: regexp.MustCompile(`^[A-Za-z0-9~-][A-Za-z0-9._~-]{0,127}$`),
+}
+
+// collectionDefinitionAttributes used to parse the collection, preventing a recursive call to
+// CollectionDefinition.UnmarshalJSON
+type collectionDefinitionAttributes CollectionDefinition
+
+// UnmarshalJSON implements json.Unmarshaler, the ID strategy and the reserved ID field are validated once the
+// collection is parsed
+func (cd *CollectionDefinition) UnmarshalJSON(data []byte) error {
+	var attributes collectionDefinitionAttributes
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return err
+	}
+	*cd = CollectionDefinition(attributes)
+	if _, declared := cd.Fields[IDField]; declared {
+		return fmt.Errorf("field '%s' is reserved for the item ID in collection '%s'", IDField, cd.Name)
+	}
+	if _, exists := idPatterns[cd.IDStrategy]; cd.IDStrategy == "" || exists {
+		return nil
+	}
+	return fmt.Errorf("invalid id_strategy '%s' for collection '%s'", cd.IDStrategy, cd.Name)
+}
+
+// IsIDValid check the ID format for the collection ID strategy. False is always returned when no strategy is
+// declared, the ID format depends on the storage in that case
+func (cd CollectionDefinition) IsIDValid(id string) bool {
+	if pattern, exists := idPatterns[cd.IDStrategy]; exists {
+		return pattern.MatchString(id)
+	}
+	return false
+}
+
+// NewUUID generates a random (version 4) UUID
+func NewUUID() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		panic("unable to generate UUID. err: " + err.Error())
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
@@ -0,0 +1,47 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCollectionDefinition_UnmarshalJSON_idStrategy(t *testing.T) {
+	var collection CollectionDefinition
+	if err := json.Unmarshal([]byte(`{"name": "editions", "id_strategy": "client", "fields": {"title": "string"}}`), &collection); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if collection.IDStrategy != IDStrategyClient || collection.Fields["title"].Type != "string" {
+		t.Fatalf("unexpected collection %v", collection)
+	}
+	if err := json.Unmarshal([]byte(`{"name": "editions", "id_strategy": "random"}`), &collection); err == nil {
+		t.Fatalf("expected error for unknown id strategy")
+	}
+	if err := json.Unmarshal([]byte(`{"name": "editions", "fields": {"id": "string"}}`), &collection); err == nil {
+		t.Fatalf("expected error for reserved id field")
+	}
+}
+
+func TestCollectionDefinition_IsIDValid(t *testing.T) {
+	cases := map[string]map[string]bool{
+		IDStrategyClient:    {"dune-1965": true, "Dune_1.0~b": true, "": false, "dune 1965": false, "a/b": false, "_search": false, "_aggregate": false, "_bulk": false, "_update": false, "dune_1965": true, ".": false, "..": false, ".dune": false},
+		IDStrategyObjectID:  {"5e9f1b0c8f1d2a3b4c5d6e7f": true, "5E9F1B0C8F1D2A3B4C5D6E7F": false, "5e9f1b0c": false},
+		IDStrategyIncrement: {"1": true, "120": true, "0": false, "012": false, "-1": false, "1234567890123456789": false},
+		IDStrategyUUID:      {NewUUID(): true, "dune-1965": false},
+		"":                  {"1": false},
+	}
+	for strategy, ids := range cases {
+		collection := CollectionDefinition{IDStrategy: strategy}
+		for id, expected := range ids {
+			if collection.IsIDValid(id) != expected {
+				t.Fatalf("unexpected validation result for %s id '%s'", strategy, id)
+			}
+		}
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	uuid := NewUUID()
+	if len(uuid) != 36 || uuid[14] != '4' || uuid == NewUUID() {
+		t.Fatalf("unexpected uuid '%s'", uuid)
+	}
+}
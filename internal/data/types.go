@@ -0,0 +1,273 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//FieldTypeEnum type used for strings limited to a list of values, declared as "enum:[value1,value2]"
+	FieldTypeEnum = "enum"
+	//FieldTypeDatetime type used for RFC 3339 formatted dates, stored as native dates
+	FieldTypeDatetime = "datetime"
+	//FieldTypeInteger type used for numbers without decimals, stored as native integers
+	FieldTypeInteger = "integer"
+
+	enumPrefix = FieldTypeEnum + ":"
+)
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// scalarType validation and conversion rules for a non nested field type
+type scalarType struct {
+	// isValid check if the value decoded from JSON is valid for the type
+	isValid func(field FieldDefinition, value interface{}) bool
+	// parse converts a raw string into the native value for the type
+	parse func(field FieldDefinition, value string) (interface{}, bool)
+	// ordered values can be compared using greater and lower operators
+	ordered bool
+	// text values can be compared using contains operator
+	text bool
+}
+
+// scalarTypes all available non nested types
+var scalarTypes = map[string]scalarType{
+	"string": {
+		isValid: isString,
+		parse:   parseString,
+		ordered: true,
+		text:    true,
+	},
+	"float": {
+		isValid: func(_ FieldDefinition, value interface{}) bool {
+			_, ok := toFloat(value)
+			return ok
+		},
+		parse: func(_ FieldDefinition, value string) (interface{}, bool) {
+			number, err := strconv.ParseFloat(value, 64)
+			return number, err == nil
+		},
+		ordered: true,
+	},
+	FieldTypeInteger: {
+		isValid: func(_ FieldDefinition, value interface{}) bool {
+			_, ok := toInteger(value)
+			return ok
+		},
+		parse: func(_ FieldDefinition, value string) (interface{}, bool) {
+			number, err := strconv.ParseInt(value, 10, 64)
+			return number, err == nil
+		},
+		ordered: true,
+	},
+	"bool": {
+		isValid: isBool,
+		parse:   parseBool,
+	},
+	"boolean": {
+		isValid: isBool,
+		parse:   parseBool,
+	},
+	FieldTypeDatetime: {
+		isValid: func(_ FieldDefinition, value interface{}) bool {
+			switch typed := value.(type) {
+			case time.Time:
+				return true
+			case string:
+				_, err := time.Parse(time.RFC3339, typed)
+				return err == nil
+			}
+			return false
+		},
+		parse: func(_ FieldDefinition, value string) (interface{}, bool) {
+			date, err := time.Parse(time.RFC3339, value)
+			return toNativeDate(date), err == nil
+		},
+		ordered: true,
+	},
+	"email": {
+		isValid: func(_ FieldDefinition, value interface{}) bool {
+			text, ok := value.(string)
+			if !ok {
+				return false
+			}
+			address, err := mail.ParseAddress(text)
+			return err == nil && address.Address == text
+		},
+		parse:   parseString,
+		ordered: true,
+		text:    true,
+	},
+	"uuid": {
+		isValid: func(_ FieldDefinition, value interface{}) bool {
+			text, ok := value.(string)
+			return ok && uuidRegexp.MatchString(text)
+		},
+		parse:   parseString,
+		ordered: true,
+		text:    true,
+	},
+	"url": {
+		isValid: func(_ FieldDefinition, value interface{}) bool {
+			text, ok := value.(string)
+			if !ok {
+				return false
+			}
+			parsedURL, err := url.ParseRequestURI(text)
+			return err == nil && parsedURL.Scheme != "" && parsedURL.Host != ""
+		},
+		parse:   parseString,
+		ordered: true,
+		text:    true,
+	},
+	FieldTypeEnum: {
+		isValid: func(field FieldDefinition, value interface{}) bool {
+			text, ok := value.(string)
+			return ok && field.isEnumValue(text)
+		},
+		parse: func(field FieldDefinition, value string) (interface{}, bool) {
+			return value, field.isEnumValue(value)
+		},
+		ordered: true,
+	},
+}
+
+// SupportsRange check if the field values can be compared using greater and lower operators
+func (fd FieldDefinition) SupportsRange() bool {
+	return scalarTypes[fd.Type].ordered
+}
+
+// SupportsContains check if the field values can be compared using the contains operator
+func (fd FieldDefinition) SupportsContains() bool {
+	return scalarTypes[fd.Type].text
+}
+
+func (fd FieldDefinition) isEnumValue(value string) bool {
+	for _, enumValue := range fd.Values {
+		if enumValue == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEnumType parse the values declared in the enum type, e.g. "enum:[fiction,poetry]"
+func parseEnumType(fieldType string) ([]string, error) {
+	declaration := strings.TrimPrefix(fieldType, enumPrefix)
+	if !strings.HasPrefix(declaration, "[") || !strings.HasSuffix(declaration, "]") {
+		return nil, fmt.Errorf("invalid enum declaration '%s'", fieldType)
+	}
+	var values []string
+	for _, value := range strings.Split(declaration[1:len(declaration)-1], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("invalid empty enum declaration '%s'", fieldType)
+	}
+	return values, nil
+}
+
+// toNative converts the value into the go type used by storages: dates for datetime fields and int64 for
+// integer fields. Nested objects and arrays are converted recursively
+func (fd FieldDefinition) toNative(value interface{}) interface{} {
+	switch fd.Type {
+	case FieldTypeObject:
+		if object, ok := value.(map[string]interface{}); ok {
+			toNative(fd.Fields, object)
+		}
+	case FieldTypeArray:
+		if list, ok := value.([]interface{}); ok && fd.Items != nil {
+			for i, element := range list {
+				list[i] = fd.Items.toNative(element)
+			}
+		}
+	case FieldTypeDatetime:
+		switch typed := value.(type) {
+		case string:
+			if date, err := time.Parse(time.RFC3339, typed); err == nil {
+				return toNativeDate(date)
+			}
+		case time.Time:
+			return toNativeDate(typed)
+		}
+	case FieldTypeInteger:
+		if number, ok := toInteger(value); ok {
+			return number
+		}
+	}
+	return value
+}
+
+func toNative(fields map[string]FieldDefinition, object map[string]interface{}) {
+	for name, value := range object {
+		if field, exists := fields[name]; exists {
+			object[name] = field.toNative(value)
+		}
+	}
+}
+
+// toNativeDate dates are stored in UTC with milliseconds precision, the same precision used by MongoDB
+func toNativeDate(date time.Time) time.Time {
+	return date.UTC().Truncate(time.Millisecond)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case float32:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case int32:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	}
+	return 0, false
+}
+
+// toInteger convert whole numbers to int64, false is returned for other values and for numbers outside the int64
+// range, so they are never overflowed. MaxInt64 can't be represented as float64, 2^63 is the first float out of range
+func toInteger(value interface{}) (int64, bool) {
+	switch number := value.(type) {
+	case int:
+		return int64(number), true
+	case int32:
+		return int64(number), true
+	case int64:
+		return number, true
+	}
+	number, ok := toFloat(value)
+	if !ok || number != math.Trunc(number) || number < math.MinInt64 || number >= -math.MinInt64 {
+		return 0, false
+	}
+	return int64(number), true
+}
+
+func isString(_ FieldDefinition, value interface{}) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+func parseString(_ FieldDefinition, value string) (interface{}, bool) {
+	return value, true
+}
+
+func isBool(_ FieldDefinition, value interface{}) bool {
+	_, ok := value.(bool)
+	return ok
+}
+
+func parseBool(_ FieldDefinition, value string) (interface{}, bool) {
+	boolean, err := strconv.ParseBool(value)
+	return boolean, err == nil
+}
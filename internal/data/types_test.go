@@ -0,0 +1,158 @@
+package data
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func createTypedCollectionDefinition(t *testing.T) CollectionDefinition {
+	var collection CollectionDefinition
+	err := json.Unmarshal([]byte(`{
+		"name": "books",
+		"fields": {
+			"pages": "integer",
+			"available": "boolean",
+			"published": "datetime",
+			"contact": "email",
+			"isbn": "uuid",
+			"website": "url",
+			"genre": "enum:[fiction, poetry]",
+			"format": {"type": "enum", "values": ["paperback", "ebook"], "default": "ebook"}
+		}
+	}`), &collection)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	return collection
+}
+
+func TestFieldDefinition_UnmarshalJSON_types(t *testing.T) {
+	collection := createTypedCollectionDefinition(t)
+	genre := collection.Fields["genre"]
+	if genre.Type != FieldTypeEnum || len(genre.Values) != 2 || genre.Values[1] != "poetry" {
+		t.Fatalf("unexpected enum definition %v", genre)
+	}
+}
+
+func TestFieldDefinition_UnmarshalJSON_invalidTypes(t *testing.T) {
+	cases := []string{
+		`"int"`,
+		`"enum:[]"`,
+		`"enum:fiction"`,
+		`{"type": "enum"}`,
+		`{"type": "integer", "default": 1.5}`,
+		`"[unknown]"`,
+	}
+	for _, c := range cases {
+		var field FieldDefinition
+		if err := json.Unmarshal([]byte(c), &field); err == nil {
+			t.Errorf("unexpected success result for %s", c)
+		}
+	}
+}
+
+func TestCollectionDefinition_IsDataValid_types(t *testing.T) {
+	collection := createTypedCollectionDefinition(t)
+
+	if !collection.IsDataValid(map[string]interface{}{
+		"pages":     310.0,
+		"available": true,
+		"published": "1937-09-21T00:00:00Z",
+		"contact":   "bilbo@shire.com",
+		"isbn":      "123e4567-e89b-12d3-a456-426614174000",
+		"website":   "https://shire.com/hobbit",
+		"genre":     "fiction",
+		"format":    "paperback",
+	}) {
+		t.Fatalf("unexpected invalid data")
+	}
+
+	invalidItems := []map[string]interface{}{
+		{"pages": 310.5},
+		{"pages": 1e300},
+		{"pages": -1e300},
+		{"pages": math.Pow(2, 63)},
+		{"pages": "310"},
+		{"available": "true"},
+		{"published": "1937-09-21"},
+		{"published": 1937.0},
+		{"contact": "bilbo"},
+		{"contact": "Bilbo <bilbo@shire.com>"},
+		{"isbn": "123e4567"},
+		{"website": "shire.com"},
+		{"genre": "drama"},
+		{"genre": 1.0},
+	}
+	for _, item := range invalidItems {
+		if collection.IsDataValid(item) {
+			t.Errorf("unexpected success result for %v", item)
+		}
+	}
+}
+
+func TestCollectionDefinition_IsDataValid_integerRange(t *testing.T) {
+	collection := createTypedCollectionDefinition(t)
+
+	for _, pages := range []interface{}{-math.Pow(2, 63), math.Pow(2, 62), int64(math.MaxInt64), int64(math.MinInt64)} {
+		if !collection.IsDataValid(map[string]interface{}{"pages": pages}) {
+			t.Errorf("unexpected invalid value %v", pages)
+		}
+	}
+	// int64 values are kept as they are, without a float64 conversion losing precision
+	item := map[string]interface{}{"pages": int64(math.MaxInt64)}
+	collection.ToNative(item)
+	if item["pages"] != int64(math.MaxInt64) {
+		t.Fatalf("unexpected integer value %#v", item["pages"])
+	}
+}
+
+func TestCollectionDefinition_ToNative(t *testing.T) {
+	collection := createTypedCollectionDefinition(t)
+	item := map[string]interface{}{
+		"pages":     310.0,
+		"published": "1937-09-21T10:00:00.123456+02:00",
+		"genre":     "fiction",
+	}
+	collection.ToNative(item)
+	if item["pages"] != int64(310) {
+		t.Fatalf("unexpected integer value %#v", item["pages"])
+	}
+	if item["published"] != time.Date(1937, 9, 21, 8, 0, 0, 123000000, time.UTC) {
+		t.Fatalf("unexpected datetime value %#v", item["published"])
+	}
+	if item["genre"] != "fiction" {
+		t.Fatalf("unexpected enum value %#v", item["genre"])
+	}
+}
+
+func TestCollectionDefinition_ParseFieldValue_types(t *testing.T) {
+	collection := createTypedCollectionDefinition(t)
+
+	if value, err := collection.ParseFieldValue("pages", "310"); err != nil || value != int64(310) {
+		t.Fatalf("unexpected integer value %#v", value)
+	}
+	if value, err := collection.ParseFieldValue("published", "1937-09-21T00:00:00Z"); err != nil ||
+		value != time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC) {
+		t.Fatalf("unexpected datetime value %#v", value)
+	}
+	if value, err := collection.ParseFieldValue("genre", "poetry"); err != nil || value != "poetry" {
+		t.Fatalf("unexpected enum value %#v", value)
+	}
+	for field, value := range map[string]string{"pages": "1.5", "published": "yesterday", "genre": "drama"} {
+		if _, err := collection.ParseFieldValue(field, value); err == nil {
+			t.Errorf("unexpected success result for field %s", field)
+		}
+	}
+}
+
+func TestFieldDefinition_SupportsRange(t *testing.T) {
+	collection := createTypedCollectionDefinition(t)
+	if !collection.Fields["published"].SupportsRange() || collection.Fields["available"].SupportsRange() {
+		t.Fatalf("unexpected range support")
+	}
+	if !collection.Fields["contact"].SupportsContains() || collection.Fields["pages"].SupportsContains() {
+		t.Fatalf("unexpected contains support")
+	}
+}
@@ -0,0 +1,164 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	//ErrorCodeUnknownField the field is not declared in the collection definition
+	ErrorCodeUnknownField = "unknown_field"
+	//ErrorCodeInvalidType the value doesn't match the field type
+	ErrorCodeInvalidType = "invalid_type"
+	//ErrorCodeNotNullable null value used for a non nullable field
+	ErrorCodeNotNullable = "not_nullable"
+	//ErrorCodeRequired required field is missing
+	ErrorCodeRequired = "required"
+	//ErrorCodeMin the value is lower than the min constraint
+	ErrorCodeMin = "min"
+	//ErrorCodeMax the value is greater than the max constraint
+	ErrorCodeMax = "max"
+	//ErrorCodeMinLength the value length is lower than the minLength constraint
+	ErrorCodeMinLength = "min_length"
+	//ErrorCodeMaxLength the value length is greater than the maxLength constraint
+	ErrorCodeMaxLength = "max_length"
+	//ErrorCodePattern the value doesn't match the pattern constraint
+	ErrorCodePattern = "pattern"
+	//ErrorCodeReadOnly the field can't be modified, e.g. the item ID
+	ErrorCodeReadOnly = "read_only"
+)
+
+// FieldError validation problem found for a single field. Field is the path to the field, e.g. "address.zip" or
+// "authors[1].name"
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Validate check the item structure and field values based on the collection definition, all problems found are
+// returned sorted by field path. An empty list is returned for valid items
+func (cd CollectionDefinition) Validate(item map[string]interface{}) []FieldError {
+	fieldErrors := validateFields(cd.Fields, item, "")
+	sortFieldErrors(fieldErrors)
+	return fieldErrors
+}
+
+// ValidateComplete check a whole item content, used when items are created or replaced. Default values are applied
+// for missing fields before checking the required ones
+func (cd CollectionDefinition) ValidateComplete(item map[string]interface{}) []FieldError {
+	fieldErrors := validateFields(cd.Fields, item, "")
+	cd.ApplyDefaults(item)
+	for _, name := range cd.MissingRequiredFields(item) {
+		fieldErrors = append(fieldErrors, FieldError{Field: name, Code: ErrorCodeRequired, Message: "field is required"})
+	}
+	sortFieldErrors(fieldErrors)
+	return fieldErrors
+}
+
+func validateFields(fields map[string]FieldDefinition, object map[string]interface{}, prefix string) []FieldError {
+	var fieldErrors []FieldError
+	for name, value := range object {
+		field, exists := fields[name]
+		if !exists {
+			fieldErrors = append(fieldErrors, FieldError{Field: prefix + name, Code: ErrorCodeUnknownField, Message: "unknown field"})
+			continue
+		}
+		fieldErrors = append(fieldErrors, field.validateValue(value, prefix+name)...)
+	}
+	return fieldErrors
+}
+
+// validateValue check the value type and constraints, nested objects and array elements are validated recursively
+func (fd FieldDefinition) validateValue(value interface{}, path string) []FieldError {
+	if value == nil {
+		if fd.Nullable {
+			return nil
+		}
+		return []FieldError{{Field: path, Code: ErrorCodeNotNullable, Message: "null is not allowed"}}
+	}
+	switch fd.Type {
+	case FieldTypeObject:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []FieldError{fd.typeError(path)}
+		}
+		if fd.Fields == nil {
+			return nil
+		}
+		return validateFields(fd.Fields, object, path+".")
+	case FieldTypeArray:
+		list, ok := value.([]interface{})
+		if !ok {
+			return []FieldError{fd.typeError(path)}
+		}
+		var fieldErrors []FieldError
+		for i, element := range list {
+			if fd.Items != nil {
+				fieldErrors = append(fieldErrors, fd.Items.validateValue(element, path+"["+strconv.Itoa(i)+"]")...)
+			}
+		}
+		return append(fieldErrors, fd.constraintErrors(value, path)...)
+	}
+	if scalar, exists := scalarTypes[fd.Type]; !exists || !scalar.isValid(fd, value) {
+		return []FieldError{fd.typeError(path)}
+	}
+	return fd.constraintErrors(value, path)
+}
+
+func (fd FieldDefinition) typeError(path string) FieldError {
+	message := fmt.Sprintf("invalid value, %s expected", fd.Type)
+	if fd.Type == FieldTypeEnum {
+		message = fmt.Sprintf("invalid value, one of '%s' expected", strings.Join(fd.Values, "', '"))
+	}
+	return FieldError{Field: path, Code: ErrorCodeInvalidType, Message: message}
+}
+
+// constraintErrors check the value satisfies the declared constraints, the value type must be already validated
+func (fd FieldDefinition) constraintErrors(value interface{}, path string) []FieldError {
+	var fieldErrors []FieldError
+	if number, ok := toFloat(value); ok {
+		if fd.Min != nil && number < *fd.Min {
+			fieldErrors = append(fieldErrors, FieldError{Field: path, Code: ErrorCodeMin,
+				Message: fmt.Sprintf("value must be greater than or equal to %v", *fd.Min)})
+		}
+		if fd.Max != nil && number > *fd.Max {
+			fieldErrors = append(fieldErrors, FieldError{Field: path, Code: ErrorCodeMax,
+				Message: fmt.Sprintf("value must be lower than or equal to %v", *fd.Max)})
+		}
+	}
+	length := -1
+	switch typed := value.(type) {
+	case string:
+		length = utf8.RuneCountInString(typed)
+		if fd.Pattern != "" {
+			pattern, err := compilePattern(fd.Pattern)
+			if err != nil || !pattern.MatchString(typed) {
+				fieldErrors = append(fieldErrors, FieldError{Field: path, Code: ErrorCodePattern,
+					Message: fmt.Sprintf("value must match the pattern '%s'", fd.Pattern)})
+			}
+		}
+	case []interface{}:
+		length = len(typed)
+	}
+	if length >= 0 {
+		if fd.MinLength != nil && length < *fd.MinLength {
+			fieldErrors = append(fieldErrors, FieldError{Field: path, Code: ErrorCodeMinLength,
+				Message: fmt.Sprintf("length must be at least %d", *fd.MinLength)})
+		}
+		if fd.MaxLength != nil && length > *fd.MaxLength {
+			fieldErrors = append(fieldErrors, FieldError{Field: path, Code: ErrorCodeMaxLength,
+				Message: fmt.Sprintf("length must be at most %d", *fd.MaxLength)})
+		}
+	}
+	return fieldErrors
+}
+
+func sortFieldErrors(fieldErrors []FieldError) {
+	sort.SliceStable(fieldErrors, func(i, j int) bool {
+		return fieldErrors[i].Field < fieldErrors[j].Field
+	})
+}
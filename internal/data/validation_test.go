@@ -0,0 +1,70 @@
+package data
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCollectionDefinition_Validate(t *testing.T) {
+	var collection CollectionDefinition
+	err := json.Unmarshal([]byte(`{
+		"name": "books",
+		"fields": {
+			"title": {"type": "string", "required": true, "maxLength": 5},
+			"year": {"type": "integer", "min": 1450},
+			"genre": "enum:[fiction,poetry]",
+			"authors": [{"name": "string"}],
+			"summary": "string"
+		}
+	}`), &collection)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+
+	fieldErrors := collection.Validate(map[string]interface{}{
+		"title":   "The Hobbit",
+		"year":    1200.0,
+		"genre":   "essay",
+		"authors": []interface{}{map[string]interface{}{"name": "Tolkien"}, map[string]interface{}{"name": 1.0}},
+		"summary": nil,
+		"bad":     "structure",
+	})
+	expected := []FieldError{
+		{Field: "authors[1].name", Code: ErrorCodeInvalidType, Message: "invalid value, string expected"},
+		{Field: "bad", Code: ErrorCodeUnknownField, Message: "unknown field"},
+		{Field: "genre", Code: ErrorCodeInvalidType, Message: "invalid value, one of 'fiction', 'poetry' expected"},
+		{Field: "summary", Code: ErrorCodeNotNullable, Message: "null is not allowed"},
+		{Field: "title", Code: ErrorCodeMaxLength, Message: "length must be at most 5"},
+		{Field: "year", Code: ErrorCodeMin, Message: "value must be greater than or equal to 1450"},
+	}
+	if !reflect.DeepEqual(fieldErrors, expected) {
+		t.Fatalf("unexpected field errors %v", fieldErrors)
+	}
+
+	if fieldErrors := collection.Validate(map[string]interface{}{"year": 1937.0}); len(fieldErrors) != 0 {
+		t.Fatalf("unexpected field errors %v", fieldErrors)
+	}
+}
+
+func TestCollectionDefinition_ValidateComplete(t *testing.T) {
+	collection := CollectionDefinition{
+		Name: "books",
+		Fields: map[string]FieldDefinition{
+			"title":  {Type: "string", Required: true},
+			"status": {Type: "string", Required: true, Default: "available"},
+			"year":   {Type: "float"},
+		},
+	}
+	item := map[string]interface{}{"year": "1937"}
+	expected := []FieldError{
+		{Field: "title", Code: ErrorCodeRequired, Message: "field is required"},
+		{Field: "year", Code: ErrorCodeInvalidType, Message: "invalid value, float expected"},
+	}
+	if fieldErrors := collection.ValidateComplete(item); !reflect.DeepEqual(fieldErrors, expected) {
+		t.Fatalf("unexpected field errors %v", fieldErrors)
+	}
+	if item["status"] != "available" {
+		t.Fatalf("default value not applied %v", item)
+	}
+}
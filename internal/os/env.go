@@ -3,6 +3,7 @@ package os
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 //GetEnv look for environment variable
@@ -24,3 +25,14 @@ func GetIntEnv(key string, defaultValue int) int {
 
 	return defaultValue
 }
+
+// GetDurationEnv look for environment variable and parse it as a duration, e.g. "500ms" or "10s"
+func GetDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if val, err := time.ParseDuration(value); err == nil {
+			return val
+		}
+	}
+
+	return defaultValue
+}
@@ -3,6 +3,7 @@ package os
 import (
 	sys_os "os"
 	"testing"
+	"time"
 )
 
 func TestGetEnv(t *testing.T) {
@@ -34,3 +35,19 @@ func TestGetIntEnv_default(t *testing.T) {
 		t.Fatalf("unexpected environment value")
 	}
 }
+
+func TestGetDurationEnv(t *testing.T) {
+	sys_os.Clearenv()
+	sys_os.Setenv("TESTING", "500ms")
+	if GetDurationEnv("TESTING", 0) != 500*time.Millisecond {
+		t.Fatalf("unexpected environment value")
+	}
+}
+
+func TestGetDurationEnv_default(t *testing.T) {
+	sys_os.Clearenv()
+	sys_os.Setenv("TESTING", "invalid")
+	if GetDurationEnv("TESTING", time.Second) != time.Second {
+		t.Fatalf("unexpected environment value")
+	}
+}
@@ -0,0 +1,237 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Operation single JSON Patch operation
+type Operation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// JSONPatch JSON Patch as described in RFC 6902, operations are applied in order and if any of them fails
+// the whole patch fails
+type JSONPatch []Operation
+
+// Apply implements patch.Patch.Apply
+func (jp JSONPatch) Apply(doc interface{}) (interface{}, error) {
+	result := deepCopy(doc)
+	for _, operation := range jp {
+		var err error
+		if result, err = operation.apply(result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (o Operation) apply(doc interface{}) (interface{}, error) {
+	path, err := parsePointer(o.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch o.Op {
+	case "add":
+		return add(doc, path, deepCopy(o.Value))
+	case "remove":
+		return remove(doc, path)
+	case "replace":
+		if _, err := get(doc, path); err != nil {
+			return nil, err
+		}
+		return replace(doc, path, deepCopy(o.Value))
+	case "move":
+		from, err := parsePointer(o.From)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(o.Path+"/", o.From+"/") && o.Path != o.From {
+			return nil, fmt.Errorf("can't move '%s' into one of its children", o.From)
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "copy":
+		from, err := parsePointer(o.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, deepCopy(value))
+	case "test":
+		value, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(value, o.Value) {
+			return nil, fmt.Errorf("test operation failed for path '%s'", o.Path)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("invalid patch operation '%s'", o.Op)
+}
+
+// parsePointer split a JSON Pointer (RFC 6901) into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path '%s'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, exists := container[token]
+			if !exists {
+				return nil, fmt.Errorf("path '%s' not found", token)
+			}
+			doc = value
+		case []interface{}:
+			index, err := parseIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("path '%s' not found", token)
+		}
+	}
+	return doc, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch typed := container.(type) {
+		case map[string]interface{}:
+			typed[token] = value
+			return typed, nil
+		case []interface{}:
+			if token == "-" {
+				return append(typed, value), nil
+			}
+			index, err := parseIndex(token, len(typed))
+			if err != nil {
+				return nil, err
+			}
+			typed = append(typed, nil)
+			copy(typed[index+1:], typed[index:])
+			typed[index] = value
+			return typed, nil
+		}
+		return nil, fmt.Errorf("path '%s' not found", token)
+	})
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("can't remove the whole document")
+	}
+	return updateParent(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch typed := container.(type) {
+		case map[string]interface{}:
+			if _, exists := typed[token]; !exists {
+				return nil, fmt.Errorf("path '%s' not found", token)
+			}
+			delete(typed, token)
+			return typed, nil
+		case []interface{}:
+			index, err := parseIndex(token, len(typed)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(typed[:index], typed[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("path '%s' not found", token)
+	})
+}
+
+func replace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch typed := container.(type) {
+		case map[string]interface{}:
+			typed[token] = value
+			return typed, nil
+		case []interface{}:
+			index, err := parseIndex(token, len(typed)-1)
+			if err != nil {
+				return nil, err
+			}
+			typed[index] = value
+			return typed, nil
+		}
+		return nil, fmt.Errorf("path '%s' not found", token)
+	})
+}
+
+// updateParent walks the document up to the parent container of the path and applies the update over it,
+// the updated containers are set back into their own parents since arrays may be reallocated
+func updateParent(doc interface{}, path []string, update func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+	child, err := get(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	updatedChild, err := updateParent(child, path[1:], update)
+	if err != nil {
+		return nil, err
+	}
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		container[path[0]] = updatedChild
+	case []interface{}:
+		index, _ := strconv.Atoi(path[0])
+		container[index] = updatedChild
+	}
+	return doc, nil
+}
+
+// parseIndex parse an array index, max is the highest valid index
+func parseIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+	return index, nil
+}
+
+// jsonEqual compare both values using their JSON representation, so numbers with different go types are equal
+func jsonEqual(a interface{}, b interface{}) bool {
+	var normalizedA, normalizedB interface{}
+	encodedA, _ := json.Marshal(a)
+	encodedB, _ := json.Marshal(b)
+	json.Unmarshal(encodedA, &normalizedA)
+	json.Unmarshal(encodedB, &normalizedB)
+	return reflect.DeepEqual(normalizedA, normalizedB)
+}
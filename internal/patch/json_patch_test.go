@@ -0,0 +1,92 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONPatch_Apply(t *testing.T) {
+	// most test cases are based on RFC 6902 Appendix A
+	cases := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","qux"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"foo":"bar"}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"foo":"bar","baz":"bar"}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"","value":{"baz":"qux"}}]`, `{"baz":"qux"}`},
+	}
+
+	for _, c := range cases {
+		var doc, expected interface{}
+		json.Unmarshal([]byte(c.doc), &doc)
+		json.Unmarshal([]byte(c.expected), &expected)
+		patch, err := Parse(JSONPatchContentType, []byte(c.patch))
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		result, err := patch.Apply(doc)
+		if err != nil {
+			t.Errorf("unexpected error for patch %s: %s", c.patch, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("unexpected result for patch %s over %s: %v", c.patch, c.doc, result)
+		}
+	}
+}
+
+func TestJSONPatch_Apply_fails(t *testing.T) {
+	cases := []struct {
+		doc   string
+		patch string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`},
+		{`{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/01"}]`},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`},
+		{`{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`},
+		{`{"foo":"bar"}`, `[{"op":"unknown","path":"/foo"}]`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"foo","value":1}]`},
+	}
+
+	for _, c := range cases {
+		var doc interface{}
+		json.Unmarshal([]byte(c.doc), &doc)
+		patch, _ := Parse(JSONPatchContentType, []byte(c.patch))
+		if _, err := patch.Apply(doc); err == nil {
+			t.Errorf("unexpected success result for patch %s over %s", c.patch, c.doc)
+		}
+	}
+}
+
+func TestJSONPatch_Apply_keepsOriginal(t *testing.T) {
+	doc := map[string]interface{}{
+		"foo": []interface{}{"bar"},
+	}
+	JSONPatch{{Op: "add", Path: "/foo/0", Value: "baz"}, {Op: "remove", Path: "/foo/1"}}.Apply(doc)
+	if len(doc["foo"].([]interface{})) != 1 || doc["foo"].([]interface{})[0] != "bar" {
+		t.Fatalf("unexpected change in original document")
+	}
+}
+
+func TestParse_unsupportedContentType(t *testing.T) {
+	if _, err := Parse("text/plain", []byte(`{}`)); err == nil {
+		t.Fatalf("unexpected success result")
+	}
+}
@@ -0,0 +1,32 @@
+package patch
+
+// MergePatch JSON Merge Patch as described in RFC 7396
+type MergePatch struct {
+	Patch interface{}
+}
+
+// Apply implements patch.Patch.Apply
+func (mp MergePatch) Apply(doc interface{}) (interface{}, error) {
+	return mergePatch(doc, mp.Patch), nil
+}
+
+// mergePatch objects are merged recursively, null values remove the target member and any other value replace it
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return deepCopy(patch)
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	result := deepCopy(targetObject).(map[string]interface{})
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = mergePatch(result[key], value)
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch_Apply(t *testing.T) {
+	// test cases from RFC 7396 Appendix A
+	cases := []struct {
+		target   string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, c := range cases {
+		var target, expected interface{}
+		json.Unmarshal([]byte(c.target), &target)
+		json.Unmarshal([]byte(c.expected), &expected)
+		patch, err := Parse(MergePatchContentType, []byte(c.patch))
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		result, err := patch.Apply(target)
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("unexpected result for patch %s over %s: %v", c.patch, c.target, result)
+		}
+	}
+}
+
+func TestMergePatch_Apply_keepsOriginal(t *testing.T) {
+	target := map[string]interface{}{
+		"a": map[string]interface{}{"b": "c"},
+	}
+	MergePatch{Patch: map[string]interface{}{
+		"a": map[string]interface{}{"b": nil},
+	}}.Apply(target)
+	if target["a"].(map[string]interface{})["b"] != "c" {
+		t.Fatalf("unexpected change in original document")
+	}
+}
@@ -0,0 +1,58 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	//MergePatchContentType content type used for RFC 7396 JSON Merge Patch
+	MergePatchContentType = "application/merge-patch+json"
+	//JSONPatchContentType content type used for RFC 6902 JSON Patch
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// Patch a set of changes to be applied over a JSON document
+type Patch interface {
+	// Apply returns a new document with the changes applied, the original document is never modified
+	Apply(doc interface{}) (interface{}, error)
+}
+
+// Parse creates the patch corresponding to the content type from the raw body. 'application/json' is handled as
+// a JSON Merge Patch
+func Parse(contentType string, body []byte) (Patch, error) {
+	switch contentType {
+	case MergePatchContentType, "application/json", "":
+		var mergePatch MergePatch
+		if err := json.Unmarshal(body, &mergePatch.Patch); err != nil {
+			return nil, err
+		}
+		return mergePatch, nil
+	case JSONPatchContentType:
+		var jsonPatch JSONPatch
+		if err := json.Unmarshal(body, &jsonPatch); err != nil {
+			return nil, err
+		}
+		return jsonPatch, nil
+	}
+	return nil, fmt.Errorf("unsupported patch content type '%s'", contentType)
+}
+
+// deepCopy copy maps and arrays recursively, so changes can be applied without modifying the original document
+func deepCopy(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typed))
+		for key, element := range typed {
+			copied[key] = deepCopy(element)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(typed))
+		for i, element := range typed {
+			copied[i] = deepCopy(element)
+		}
+		return copied
+	}
+	return value
+}
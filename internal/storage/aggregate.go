@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"fmt"
+	"monkiato/apio/internal/data"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AggregateQuery groups the items matching the filter by the values of the GroupBy fields, and computes the
+// accumulators for each group: sum and average for numeric fields, min and max for ordered fields. All the items
+// are placed in a single group when GroupBy is empty. Fields must not be arrays or be nested inside arrays
+type AggregateQuery struct {
+	GroupBy []string
+	Sum     []string
+	Avg     []string
+	Min     []string
+	Max     []string
+	Filter  Filter
+}
+
+// AggregateGroup values computed for a group of items, sorted by Key. Key contains the value of each GroupBy field,
+// nil for items without the field. Accumulators are indexed by field name, missing values are ignored: sums are 0 and
+// Avg, Min and Max are nil when no item in the group has a value for the field.
+// Values are typed using the collection definition, sums of integer fields are int64 and averages are float64
+type AggregateGroup struct {
+	Key   map[string]interface{}
+	Count int64
+	Sum   map[string]interface{}
+	Avg   map[string]interface{}
+	Min   map[string]interface{}
+	Max   map[string]interface{}
+}
+
+// aggregator computes an aggregation in-process, used by storages without native aggregations
+type aggregator struct {
+	definition data.CollectionDefinition
+	query      AggregateQuery
+	groups     map[string]*aggregateState
+	// integerSums sum fields declared as integers, they are accumulated as int64 so large sums keep their precision
+	integerSums []bool
+}
+
+// aggregateState values accumulated for a single group
+type aggregateState struct {
+	key       []interface{}
+	count     int64
+	sums      []float64
+	intSums   []int64
+	avgSums   []float64
+	avgCounts []int64
+	mins      []interface{}
+	maxs      []interface{}
+}
+
+func newAggregator(definition data.CollectionDefinition, query AggregateQuery) *aggregator {
+	integerSums := make([]bool, len(query.Sum))
+	for i, field := range query.Sum {
+		integerSums[i] = isIntegerField(definition, field)
+	}
+	return &aggregator{
+		definition:  definition,
+		query:       query,
+		groups:      map[string]*aggregateState{},
+		integerSums: integerSums,
+	}
+}
+
+// add accumulate the item values into its group, the item must match the query filter
+func (a *aggregator) add(item map[string]interface{}) {
+	key := make([]interface{}, len(a.query.GroupBy))
+	for i, field := range a.query.GroupBy {
+		key[i], _ = lookupValue(item, field)
+	}
+	encodedKey := encodeGroupKey(key)
+	state, exists := a.groups[encodedKey]
+	if !exists {
+		state = &aggregateState{
+			key:       key,
+			sums:      make([]float64, len(a.query.Sum)),
+			intSums:   make([]int64, len(a.query.Sum)),
+			avgSums:   make([]float64, len(a.query.Avg)),
+			avgCounts: make([]int64, len(a.query.Avg)),
+			mins:      make([]interface{}, len(a.query.Min)),
+			maxs:      make([]interface{}, len(a.query.Max)),
+		}
+		a.groups[encodedKey] = state
+	}
+
+	state.count++
+	for i, field := range a.query.Sum {
+		if a.integerSums[i] {
+			if number, ok := integerValue(item, field); ok {
+				state.intSums[i] += number
+			}
+		} else if number, ok := numericValue(item, field); ok {
+			state.sums[i] += number
+		}
+	}
+	for i, field := range a.query.Avg {
+		if number, ok := numericValue(item, field); ok {
+			state.avgSums[i] += number
+			state.avgCounts[i]++
+		}
+	}
+	for i, field := range a.query.Min {
+		if value, exists := lookupValue(item, field); exists && value != nil {
+			if state.mins[i] == nil || compareValues(value, state.mins[i]) < 0 {
+				state.mins[i] = value
+			}
+		}
+	}
+	for i, field := range a.query.Max {
+		if value, exists := lookupValue(item, field); exists && value != nil {
+			if state.maxs[i] == nil || compareValues(value, state.maxs[i]) > 0 {
+				state.maxs[i] = value
+			}
+		}
+	}
+}
+
+// result groups sorted by key, with the values typed using the collection definition
+func (a *aggregator) result() []AggregateGroup {
+	states := make([]*aggregateState, 0, len(a.groups))
+	for _, state := range a.groups {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return compareValues(states[i].key, states[j].key) < 0
+	})
+
+	groups := make([]AggregateGroup, len(states))
+	for n, state := range states {
+		group := newAggregateGroup(a.query, state.count)
+		for i, field := range a.query.GroupBy {
+			group.Key[field] = state.key[i]
+		}
+		for i, field := range a.query.Sum {
+			group.Sum[field] = state.sums[i]
+			if a.integerSums[i] {
+				group.Sum[field] = state.intSums[i]
+			}
+		}
+		for i, field := range a.query.Avg {
+			group.Avg[field] = nil
+			if state.avgCounts[i] > 0 {
+				group.Avg[field] = state.avgSums[i] / float64(state.avgCounts[i])
+			}
+		}
+		for i, field := range a.query.Min {
+			group.Min[field] = state.mins[i]
+		}
+		for i, field := range a.query.Max {
+			group.Max[field] = state.maxs[i]
+		}
+		groups[n] = group
+	}
+	return groups
+}
+
+func newAggregateGroup(query AggregateQuery, count int64) AggregateGroup {
+	return AggregateGroup{
+		Key:   make(map[string]interface{}, len(query.GroupBy)),
+		Count: count,
+		Sum:   make(map[string]interface{}, len(query.Sum)),
+		Avg:   make(map[string]interface{}, len(query.Avg)),
+		Min:   make(map[string]interface{}, len(query.Min)),
+		Max:   make(map[string]interface{}, len(query.Max)),
+	}
+}
+
+// typedSum sum converted to the field type, int64 for integer fields and float64 otherwise. Integer sums are never
+// converted to float64, so they keep their precision
+func typedSum(definition data.CollectionDefinition, field string, sum interface{}) interface{} {
+	if !isIntegerField(definition, field) {
+		return toFloat(sum)
+	}
+	if number, ok := toInt64(sum); ok {
+		return number
+	}
+	return int64(toFloat(sum))
+}
+
+func isIntegerField(definition data.CollectionDefinition, field string) bool {
+	fieldDefinition, _ := definition.FieldByPath(field)
+	return fieldDefinition.Type == data.FieldTypeInteger
+}
+
+// numericValue get the field value as a number, false is returned for missing and non numeric values
+func numericValue(item map[string]interface{}, field string) (float64, bool) {
+	value, _ := lookupValue(item, field)
+	if typeOrder(value) != typeOrder(0) {
+		return 0, false
+	}
+	return toFloat(value), true
+}
+
+// integerValue get the field value as an int64, integer values are converted without losing precision. False is
+// returned for missing and non numeric values
+func integerValue(item map[string]interface{}, field string) (int64, bool) {
+	value, _ := lookupValue(item, field)
+	if number, ok := toInt64(value); ok {
+		return number, true
+	}
+	if typeOrder(value) != typeOrder(0) {
+		return 0, false
+	}
+	return int64(toFloat(value)), true
+}
+
+// toInt64 convert integer values to int64, false is returned for any other type
+func toInt64(value interface{}) (int64, bool) {
+	switch number := value.(type) {
+	case int64:
+		return number, true
+	case int32:
+		return int64(number), true
+	case int:
+		return int64(number), true
+	}
+	return 0, false
+}
+
+// encodeGroupKey unique representation of the group key values, numbers with the same value are in the same group
+// regardless of their type
+func encodeGroupKey(key []interface{}) string {
+	encoded := make([]string, len(key))
+	for i, value := range key {
+		switch typed := value.(type) {
+		case float64, float32, int, int32, int64:
+			encoded[i] = fmt.Sprintf("number:%v", toFloat(typed))
+		case time.Time:
+			encoded[i] = fmt.Sprintf("time:%d", typed.UnixNano())
+		default:
+			encoded[i] = fmt.Sprintf("%T:%v", typed, typed)
+		}
+	}
+	return strings.Join(encoded, "\x00")
+}
@@ -1,6 +1,9 @@
 package storage
 
-import "monkiato/apio/internal/data"
+import (
+	"context"
+	"monkiato/apio/internal/data"
+)
 
 // Storage handles data for multiple collections, it's the main entry points to initialize and manage all API collections
 type Storage interface {
@@ -12,23 +15,91 @@ type Storage interface {
 	GetCollection(collectionName string) (CollectionHandler, error)
 }
 
-// CollectionHandler used to operate over a single collection
+// CollectionHandler used to operate over a single collection. All operations receive the context of the request
+// being handled, so cancelled or timed out requests stop the operation in progress.
+// Errors are wrapped with ErrNotFound, ErrConflict, ErrInvalidID or ErrUnavailable when the cause is known
 type CollectionHandler interface {
-	// GetItem get a collection item for the specified item ID
-	GetItem(itemID string) (interface{}, bool)
+	// GetItem get a collection item for the specified item ID, ErrNotFound is returned if the item doesn't exist.
+	// Items returned by GetItem and Query include their canonical ID in data.IDField
+	GetItem(ctx context.Context, itemID string) (interface{}, error)
+	// GetItemFields get a collection item including only the fields of the projection, the same way Query does.
+	// The whole item is returned when the projection is empty
+	GetItemFields(ctx context.Context, itemID string, fields Projection) (interface{}, error)
+	// ValidateID check the item ID has the format used by the collection, ErrInvalidID is returned otherwise
+	ValidateID(itemID string) error
 	// AddItem insert new item. (itemID, error) is returned
-	AddItem(item map[string]interface{}) (string, error)
-	// UpdateItem used to update an existing item, it must exists previously, otherwise an error will be returned
-	UpdateItem(itemID string, item map[string]interface{}) error
+	AddItem(ctx context.Context, item map[string]interface{}) (string, error)
+	// InsertItem insert new item using the specified ID, used by collections with IDs provided by the client.
+	// ErrConflict is returned if the ID is already used
+	InsertItem(ctx context.Context, itemID string, item map[string]interface{}) error
+	// UpsertItem replace the whole content of the item, or insert it if it doesn't exist. True is returned when the
+	// item is created
+	UpsertItem(ctx context.Context, itemID string, item map[string]interface{}) (bool, error)
+	// UpdateItem used to update an existing item, it must exists previously, otherwise an error will be returned.
+	// Only the specified fields are updated, the rest of the item fields are kept
+	UpdateItem(ctx context.Context, itemID string, item map[string]interface{}) error
+	// ReplaceItem used to replace the whole content of an existing item, it must exists previously, otherwise an
+	// error will be returned
+	ReplaceItem(ctx context.Context, itemID string, item map[string]interface{}) error
+	// PatchItem replace the whole content of an existing item with the result of the patch over its current content.
+	// The item can't be modified by other operations between the read and the write, errors returned by the patch
+	// abort the operation and are returned as they are
+	PatchItem(ctx context.Context, itemID string, patch ItemPatch) error
 	// DeleteItem remove the specified itemID
-	DeleteItem(itemID string) error
+	DeleteItem(ctx context.Context, itemID string) error
+	// UpdateMany update the specified fields of all the items matching the filter, the amount of matched items is
+	// returned. ErrConflict is returned when a unique field would be duplicated
+	UpdateMany(ctx context.Context, filter Filter, item map[string]interface{}) (int64, error)
+	// DeleteMany remove all the items matching the filter, the amount of deleted items is returned
+	DeleteMany(ctx context.Context, filter Filter) (int64, error)
+	// BulkWrite apply a batch of operations, each one succeeds or fails on its own and the results are returned in
+	// the same order. An error is only returned when the batch can't be completed, e.g. the storage is unavailable,
+	// in that case some operations may have been applied
+	BulkWrite(ctx context.Context, operations []BulkOperation) ([]BulkResult, error)
 	// Query returns a list of items from a collection filtered by some criteria declared in QueryParams
-	Query(query QueryParams) ([]interface{}, error)
+	Query(ctx context.Context, query QueryParams) (QueryResult, error)
+	// Count returns the total amount of items in a collection matching the filter
+	Count(ctx context.Context, filter Filter) (int64, error)
+	// Search returns the items matching a full text search over the searchable fields, sorted by relevance
+	Search(ctx context.Context, query SearchQuery) ([]SearchResult, error)
+	// Aggregate returns the values computed for each group of items matching the query filter, sorted by group key
+	Aggregate(ctx context.Context, query AggregateQuery) ([]AggregateGroup, error)
+}
+
+// ItemPatch computes the new content of an item from its current content, which includes the item ID in
+// data.IDField. The received item can be modified and returned
+type ItemPatch func(item map[string]interface{}) (map[string]interface{}, error)
+
+// withID copy of the item including its ID, the stored item is never modified
+func withID(item map[string]interface{}, itemID string) map[string]interface{} {
+	copied := make(map[string]interface{}, len(item)+1)
+	for key, value := range item {
+		copied[key] = value
+	}
+	copied[data.IDField] = itemID
+	return copied
 }
 
 // QueryParams used to filter data on a query
 type QueryParams struct {
 	Skip   int64
 	Limit  int64
-	SortBy string
+	SortBy []SortField
+	Filter Filter
+	// After used for keyset pagination, only items placed after the cursor position are returned
+	After *Cursor
+	// Fields projection applied to the returned items, the whole items are returned when it's empty
+	Fields Projection
+}
+
+// QueryResult items obtained from a query. Next cursor is only available when there are more items after the last one
+type QueryResult struct {
+	Items []interface{}
+	Next  *Cursor
+}
+
+// SortField single sorting criteria, multiple criteria are applied in the same order they are declared in QueryParams.SortBy
+type SortField struct {
+	Name       string
+	Descending bool
 }
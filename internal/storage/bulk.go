@@ -0,0 +1,28 @@
+package storage
+
+// BulkOperationType kind of write applied by a bulk operation
+type BulkOperationType string
+
+const (
+	// BulkCreate creates a new item, using the operation ID when it's provided
+	BulkCreate BulkOperationType = "create"
+	// BulkUpdate updates the specified fields of an existing item, the rest of the item fields are kept
+	BulkUpdate BulkOperationType = "update"
+	// BulkDelete removes an existing item
+	BulkDelete BulkOperationType = "delete"
+)
+
+// BulkOperation single write executed by CollectionHandler.BulkWrite. ID is optional for create operations, the
+// storage generates it unless the collection uses client IDs
+type BulkOperation struct {
+	Type BulkOperationType
+	ID   string
+	Item map[string]interface{}
+}
+
+// BulkResult outcome of a single bulk operation. ID is the item ID, including the generated ID for created items,
+// and Err is nil when the operation succeeded
+type BulkResult struct {
+	ID  string
+	Err error
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// typeOrder returns the relative position of the value type, following the MongoDB BSON comparison order so
+// in-process sorting gives the same results as the MongoDB storage when mixed types are stored in the same field
+func typeOrder(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 1
+	case float64, float32, int, int32, int64:
+		return 2
+	case string:
+		return 3
+	case map[string]interface{}:
+		return 4
+	case []interface{}:
+		return 5
+	case bool:
+		return 8
+	case time.Time:
+		return 9
+	default:
+		return 10
+	}
+}
+
+// compareValues returns -1, 0 or 1 if a is lower, equal or greater than b respectively
+func compareValues(a, b interface{}) int {
+	orderA, orderB := typeOrder(a), typeOrder(b)
+	if orderA != orderB {
+		return compareInts(orderA, orderB)
+	}
+
+	switch valueA := a.(type) {
+	case string:
+		return strings.Compare(valueA, b.(string))
+	case bool:
+		if valueA == b.(bool) {
+			return 0
+		}
+		if !valueA {
+			return -1
+		}
+		return 1
+	case time.Time:
+		valueB := b.(time.Time)
+		if valueA.Before(valueB) {
+			return -1
+		}
+		if valueA.After(valueB) {
+			return 1
+		}
+		return 0
+	case []interface{}:
+		valueB := b.([]interface{})
+		for i := 0; i < len(valueA) && i < len(valueB); i++ {
+			if result := compareValues(valueA[i], valueB[i]); result != 0 {
+				return result
+			}
+		}
+		return compareInts(len(valueA), len(valueB))
+	}
+
+	if orderA == 2 {
+		numberA, numberB := toFloat(a), toFloat(b)
+		if numberA < numberB {
+			return -1
+		}
+		if numberA > numberB {
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func toFloat(value interface{}) float64 {
+	switch number := value.(type) {
+	case float64:
+		return number
+	case float32:
+		return float64(number)
+	case int:
+		return float64(number)
+	case int32:
+		return float64(number)
+	case int64:
+		return float64(number)
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package storage_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"monkiato/apio/internal/storage"
+	"monkiato/apio/internal/storage/storagetest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage_conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, manifest string) storage.Storage {
+		s := storage.NewMemoryStorage()
+		s.Initialize(manifest)
+		return s
+	})
+}
+
+func TestFileStorage_conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, manifest string) storage.Storage {
+		path, err := ioutil.TempDir("", "apio")
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		t.Cleanup(func() { os.RemoveAll(path) })
+		os.Setenv("FILE_STORAGE_PATH", path)
+		defer os.Unsetenv("FILE_STORAGE_PATH")
+		s := storage.NewFileStorage()
+		s.Initialize(manifest)
+		return s
+	})
+}
+
+func TestSQLiteStorage_conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, manifest string) storage.Storage {
+		path, err := ioutil.TempDir("", "apio")
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		t.Cleanup(func() { os.RemoveAll(path) })
+		os.Setenv("SQLITE_PATH", filepath.Join(path, "apio.db"))
+		defer os.Unsetenv("SQLITE_PATH")
+		s := storage.NewSQLiteStorage()
+		s.Initialize(manifest)
+		return s
+	})
+}
+
+// TestMongoStorage_conformance requires a MongoDB server, it's only executed when MONGODB_USERNAME is set.
+// Each test uses its own database, dropped once the test finishes
+func TestMongoStorage_conformance(t *testing.T) {
+	if os.Getenv("MONGODB_USERNAME") == "" {
+		t.Skip("MONGODB_USERNAME not set, skipping MongoDB conformance tests")
+	}
+	storagetest.Run(t, func(t *testing.T, manifest string) storage.Storage {
+		os.Setenv("MONGODB_NAME", fmt.Sprintf("apio_test_%d", time.Now().UnixNano()))
+		defer os.Unsetenv("MONGODB_NAME")
+		s := storage.NewMongoStorage()
+		s.Initialize(manifest)
+		t.Cleanup(func() { storage.DropMongoDatabase(s) })
+		return s
+	})
+}
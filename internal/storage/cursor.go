@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Cursor position of the last item obtained in a query, used for keyset pagination. It contains the values for
+// the fields used to sort the query and the item ID, so the next query can continue right after that item
+type Cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	ID     string        `json:"id"`
+}
+
+// NewCursor create a cursor pointing to the specified item
+func NewCursor(sortBy []SortField, itemID string, item map[string]interface{}) *Cursor {
+	values := make([]interface{}, len(sortBy))
+	for i, sortField := range sortBy {
+		values[i], _ = lookupValue(item, sortField.Name)
+	}
+	return &Cursor{
+		Sort:   sortKey(sortBy),
+		Values: values,
+		ID:     itemID,
+	}
+}
+
+// DecodeCursor decode an opaque cursor token, the cursor must have been created for the same sorting criteria
+func DecodeCursor(token string, sortBy []SortField) (*Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if cursor.Sort != sortKey(sortBy) || len(cursor.Values) != len(sortBy) {
+		return nil, fmt.Errorf("cursor doesn't match the sort criteria")
+	}
+	return &cursor, nil
+}
+
+// Encode get the opaque cursor token
+func (c *Cursor) Encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// sortKey string representation for the sorting criteria, e.g. "-year,title"
+func sortKey(sortBy []SortField) string {
+	names := make([]string, len(sortBy))
+	for i, sortField := range sortBy {
+		names[i] = sortField.Name
+		if sortField.Descending {
+			names[i] = "-" + names[i]
+		}
+	}
+	return strings.Join(names, ",")
+}
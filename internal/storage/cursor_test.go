@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCursor_Encode(t *testing.T) {
+	sortBy := []SortField{{Name: "year", Descending: true}, {Name: "title"}}
+	cursor := NewCursor(sortBy, "a1", map[string]interface{}{
+		"year":  1954.0,
+		"title": "The Lord of the Rings",
+	})
+	decoded, err := DecodeCursor(cursor.Encode(), sortBy)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if !reflect.DeepEqual(cursor, decoded) {
+		t.Fatalf("unexpected decoded cursor %v", decoded)
+	}
+}
+
+func TestDecodeCursor_invalidToken(t *testing.T) {
+	if _, err := DecodeCursor("not a valid token", nil); err == nil {
+		t.Fatalf("unexpected success result")
+	}
+}
+
+func TestDecodeCursor_sortMismatch(t *testing.T) {
+	cursor := NewCursor([]SortField{{Name: "year"}}, "a1", map[string]interface{}{"year": 1954.0})
+	if _, err := DecodeCursor(cursor.Encode(), []SortField{{Name: "year", Descending: true}}); err == nil {
+		t.Fatalf("unexpected success result")
+	}
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound returned when the requested item doesn't exist in the collection
+	ErrNotFound = errors.New("item not found")
+	// ErrConflict returned when an item can't be stored because it conflicts with an existing one, e.g. a duplicated
+	// value for a unique field
+	ErrConflict = errors.New("item conflict")
+	// ErrInvalidID returned when the item ID doesn't have the format used by the storage
+	ErrInvalidID = errors.New("invalid item id")
+	// ErrUnavailable returned when the storage can't complete the operation, e.g. the database is down or the
+	// operation timed out
+	ErrUnavailable = errors.New("storage unavailable")
+)
+
+func notFoundError(itemID string) error {
+	return fmt.Errorf("%w: '%s'", ErrNotFound, itemID)
+}
+
+func existingItemError(itemID string) error {
+	return fmt.Errorf("%w: item '%s' already exists", ErrConflict, itemID)
+}
+
+func missingClientIDError() error {
+	return fmt.Errorf("%w: the item ID must be provided by the client", ErrInvalidID)
+}
+
+func invalidIDError(itemID string) error {
+	return fmt.Errorf("%w: '%s'", ErrInvalidID, itemID)
+}
+
+func invalidCursorError(itemID string) error {
+	return fmt.Errorf("%w: cursor item '%s'", ErrInvalidID, itemID)
+}
+
+func unknownBulkOperationError(operationType BulkOperationType) error {
+	return fmt.Errorf("unknown bulk operation '%s'", operationType)
+}
+
+// contextError wraps timed out operations with ErrUnavailable, cancelled operations are returned as they are since
+// nobody is waiting for the result
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
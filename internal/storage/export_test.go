@@ -0,0 +1,9 @@
+package storage
+
+// DropMongoDatabase drop the whole database used by the storage, used to clean up after conformance tests
+func DropMongoDatabase(s Storage) error {
+	ms := s.(*MongoStorage)
+	ctx, cancel := createContext()
+	defer cancel()
+	return ms.client.Database(ms.dbName).Drop(ctx)
+}
@@ -0,0 +1,518 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"monkiato/apio/internal/data"
+	mk_os "monkiato/apio/internal/os"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	defaultFileStoragePath    = "/app/data"
+	defaultFileStorageCompact = 1000
+
+	fileOperationAdd     = "add"
+	fileOperationUpdate  = "update"
+	fileOperationReplace = "replace"
+	fileOperationDelete  = "delete"
+)
+
+//FileStorage structure for the storage keeping data in memory and persisting it to disk. Each collection uses a
+//snapshot file with the whole collection content and an append-only log with the operations applied after the
+//snapshot. The log is compacted into a new snapshot periodically, and the state is recovered on Initialize
+type FileStorage struct {
+	memory             *MemoryStorage
+	collectionHandlers map[string]CollectionHandler
+	path               string
+	// compactThreshold amount of log entries needed to compact the log into a new snapshot
+	compactThreshold int
+}
+
+//FileCollectionHandler data handler used for a specific collection, operations are applied over the in-memory
+//collection and appended to the collection log
+type FileCollectionHandler struct {
+	// mutex serializes write operations, so the log keeps the same order used to apply them
+	mutex        sync.Mutex
+	memory       *MemoryCollectionHandler
+	definition   data.CollectionDefinition
+	snapshotPath string
+	logPath      string
+	logFile      *os.File
+	// logSize and logEntries size in bytes and amount of operations written to the log since the last compaction
+	logSize          int64
+	logEntries       int
+	compactThreshold int
+}
+
+// fileLogEntry single operation stored in the collection log
+type fileLogEntry struct {
+	Operation string                 `json:"op"`
+	ID        string                 `json:"id"`
+	Item      map[string]interface{} `json:"item,omitempty"`
+}
+
+// fileSnapshot whole collection content stored in the snapshot file
+type fileSnapshot struct {
+	LastID int64                             `json:"lastID"`
+	Items  map[string]map[string]interface{} `json:"items"`
+}
+
+//NewFileStorage create a new FileStorage instance
+//Data directory and compaction frequency can be set by environment variables
+//FILE_STORAGE_PATH and FILE_STORAGE_COMPACT (amount of log entries)
+func NewFileStorage() Storage {
+	return newFileStorage(
+		mk_os.GetEnv("FILE_STORAGE_PATH", defaultFileStoragePath),
+		mk_os.GetIntEnv("FILE_STORAGE_COMPACT", defaultFileStorageCompact))
+}
+
+func newFileStorage(path string, compactThreshold int) *FileStorage {
+	return &FileStorage{
+		memory:             NewMemoryStorage().(*MemoryStorage),
+		collectionHandlers: map[string]CollectionHandler{},
+		path:               path,
+		compactThreshold:   compactThreshold,
+	}
+}
+
+//Initialize implements storage.Storage.Initialize
+func (fs *FileStorage) Initialize(manifest string) {
+	fs.memory.Initialize(manifest)
+	if err := os.MkdirAll(fs.path, 0755); err != nil {
+		log.Fatalf("unable to create data directory %s. err: %s", fs.path, err.Error())
+	}
+	// all handlers are created on initialization, so the handlers map is never modified later
+	for _, collectionDefinition := range fs.memory.GetCollectionDefinitions() {
+		memoryHandler, _ := fs.memory.GetCollection(collectionDefinition.Name)
+		handler := &FileCollectionHandler{
+			memory:           memoryHandler.(*MemoryCollectionHandler),
+			definition:       collectionDefinition,
+			snapshotPath:     filepath.Join(fs.path, collectionDefinition.Name+".snapshot.json"),
+			logPath:          filepath.Join(fs.path, collectionDefinition.Name+".log"),
+			compactThreshold: fs.compactThreshold,
+		}
+		if err := handler.recover(); err != nil {
+			log.Fatalf("unable to recover collection %s. err: %s", collectionDefinition.Name, err.Error())
+		}
+		fs.collectionHandlers[collectionDefinition.Name] = handler
+	}
+}
+
+//GetCollectionDefinitions implements storage.Storage.GetCollectionDefinitions
+func (fs *FileStorage) GetCollectionDefinitions() []data.CollectionDefinition {
+	return fs.memory.GetCollectionDefinitions()
+}
+
+//GetCollection implements storage.Storage.GetCollection
+func (fs *FileStorage) GetCollection(collectionName string) (CollectionHandler, error) {
+	if collectionHandler, ok := fs.collectionHandlers[collectionName]; ok {
+		return collectionHandler, nil
+	}
+	return nil, fmt.Errorf("collection %s not found", collectionName)
+}
+
+//GetItem implements storage.CollectionHandler.GetItem
+func (fch *FileCollectionHandler) GetItem(ctx context.Context, itemID string) (interface{}, error) {
+	return fch.memory.GetItem(ctx, itemID)
+}
+
+//GetItemFields implements storage.CollectionHandler.GetItemFields
+func (fch *FileCollectionHandler) GetItemFields(ctx context.Context, itemID string, fields Projection) (interface{}, error) {
+	return fch.memory.GetItemFields(ctx, itemID, fields)
+}
+
+//ValidateID implements storage.CollectionHandler.ValidateID
+func (fch *FileCollectionHandler) ValidateID(itemID string) error {
+	return fch.memory.ValidateID(itemID)
+}
+
+//AddItem implements storage.CollectionHandler.AddItem
+func (fch *FileCollectionHandler) AddItem(ctx context.Context, item map[string]interface{}) (string, error) {
+	var id string
+	err := fch.write(ctx, func() ([]fileLogEntry, error) {
+		var err error
+		if id, err = fch.memory.addItem(item); err != nil {
+			return nil, err
+		}
+		return []fileLogEntry{{Operation: fileOperationAdd, ID: id, Item: item}}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+//InsertItem implements storage.CollectionHandler.InsertItem
+func (fch *FileCollectionHandler) InsertItem(ctx context.Context, itemID string, item map[string]interface{}) error {
+	return fch.write(ctx, func() ([]fileLogEntry, error) {
+		if err := fch.memory.createItem(itemID, item); err != nil {
+			return nil, err
+		}
+		return []fileLogEntry{{Operation: fileOperationAdd, ID: itemID, Item: item}}, nil
+	})
+}
+
+//UpsertItem implements storage.CollectionHandler.UpsertItem
+func (fch *FileCollectionHandler) UpsertItem(ctx context.Context, itemID string, item map[string]interface{}) (bool, error) {
+	if err := fch.memory.ValidateID(itemID); err != nil {
+		return false, err
+	}
+	var created bool
+	err := fch.write(ctx, func() ([]fileLogEntry, error) {
+		var err error
+		if created, err = fch.memory.upsertItem(itemID, item); err != nil {
+			return nil, err
+		}
+		operation := fileOperationReplace
+		if created {
+			operation = fileOperationAdd
+		}
+		return []fileLogEntry{{Operation: operation, ID: itemID, Item: item}}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+//UpdateItem implements storage.CollectionHandler.UpdateItem
+func (fch *FileCollectionHandler) UpdateItem(ctx context.Context, itemID string, item map[string]interface{}) error {
+	return fch.write(ctx, func() ([]fileLogEntry, error) {
+		if err := fch.memory.updateItem(itemID, item); err != nil {
+			return nil, err
+		}
+		return []fileLogEntry{{Operation: fileOperationUpdate, ID: itemID, Item: item}}, nil
+	})
+}
+
+//ReplaceItem implements storage.CollectionHandler.ReplaceItem
+func (fch *FileCollectionHandler) ReplaceItem(ctx context.Context, itemID string, item map[string]interface{}) error {
+	return fch.write(ctx, func() ([]fileLogEntry, error) {
+		if err := fch.memory.replaceItem(itemID, item); err != nil {
+			return nil, err
+		}
+		return []fileLogEntry{{Operation: fileOperationReplace, ID: itemID, Item: item}}, nil
+	})
+}
+
+//PatchItem implements storage.CollectionHandler.PatchItem, the patched item is logged as a replace operation
+func (fch *FileCollectionHandler) PatchItem(ctx context.Context, itemID string, patch ItemPatch) error {
+	return fch.write(ctx, func() ([]fileLogEntry, error) {
+		newItem, err := fch.memory.patchItem(itemID, patch)
+		if err != nil {
+			return nil, err
+		}
+		return []fileLogEntry{{Operation: fileOperationReplace, ID: itemID, Item: newItem}}, nil
+	})
+}
+
+//DeleteItem implements storage.CollectionHandler.DeleteItem
+func (fch *FileCollectionHandler) DeleteItem(ctx context.Context, itemID string) error {
+	return fch.write(ctx, func() ([]fileLogEntry, error) {
+		if err := fch.memory.deleteItem(itemID); err != nil {
+			return nil, err
+		}
+		return []fileLogEntry{{Operation: fileOperationDelete, ID: itemID}}, nil
+	})
+}
+
+//UpdateMany implements storage.CollectionHandler.UpdateMany, an update operation is logged for each updated item
+func (fch *FileCollectionHandler) UpdateMany(ctx context.Context, filter Filter, item map[string]interface{}) (int64, error) {
+	var updated int64
+	err := fch.write(ctx, func() ([]fileLogEntry, error) {
+		ids, err := fch.memory.updateMatching(filter, item)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]fileLogEntry, len(ids))
+		for i, id := range ids {
+			entries[i] = fileLogEntry{Operation: fileOperationUpdate, ID: id, Item: item}
+		}
+		updated = int64(len(ids))
+		return entries, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+//DeleteMany implements storage.CollectionHandler.DeleteMany, a delete operation is logged for each deleted item
+func (fch *FileCollectionHandler) DeleteMany(ctx context.Context, filter Filter) (int64, error) {
+	var deleted int64
+	err := fch.write(ctx, func() ([]fileLogEntry, error) {
+		ids := fch.memory.deleteMatching(filter)
+		entries := make([]fileLogEntry, len(ids))
+		for i, id := range ids {
+			entries[i] = fileLogEntry{Operation: fileOperationDelete, ID: id}
+		}
+		deleted = int64(len(ids))
+		return entries, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+//BulkWrite implements storage.CollectionHandler.BulkWrite, the successful operations are appended to the log with a
+//single write
+func (fch *FileCollectionHandler) BulkWrite(ctx context.Context, operations []BulkOperation) ([]BulkResult, error) {
+	var results []BulkResult
+	err := fch.write(ctx, func() ([]fileLogEntry, error) {
+		results = fch.memory.bulkWrite(operations)
+		var entries []fileLogEntry
+		for i, result := range results {
+			if result.Err != nil {
+				continue
+			}
+			entry := fileLogEntry{ID: result.ID, Item: operations[i].Item}
+			switch operations[i].Type {
+			case BulkCreate:
+				entry.Operation = fileOperationAdd
+			case BulkUpdate:
+				entry.Operation = fileOperationUpdate
+			case BulkDelete:
+				entry.Operation = fileOperationDelete
+			}
+			entries = append(entries, entry)
+		}
+		return entries, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// write apply the changes to the in-memory collection and append the log entries returned by apply. The in-memory
+// collection is locked during the whole write, so other requests never see changes missing in the log, and the
+// changes are reverted when the log can't be written
+func (fch *FileCollectionHandler) write(ctx context.Context, apply func() ([]fileLogEntry, error)) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+	fch.mutex.Lock()
+	defer fch.mutex.Unlock()
+
+	fch.memory.mutex.Lock()
+	fch.memory.trackChanges()
+	entries, err := apply()
+	if err == nil {
+		err = fch.appendLog(entries...)
+	}
+	fch.memory.endChanges(err != nil)
+	fch.memory.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if fch.compactThreshold > 0 && fch.logEntries >= fch.compactThreshold {
+		if err := fch.compact(); err != nil {
+			// the log is still valid, compaction is retried on next write
+			log.Errorf("unable to compact log for collection %s. err: %s", fch.definition.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+//Query implements storage.CollectionHandler.Query
+func (fch *FileCollectionHandler) Query(ctx context.Context, query QueryParams) (QueryResult, error) {
+	return fch.memory.Query(ctx, query)
+}
+
+//Search implements storage.CollectionHandler.Search
+func (fch *FileCollectionHandler) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	return fch.memory.Search(ctx, query)
+}
+
+//Aggregate implements storage.CollectionHandler.Aggregate
+func (fch *FileCollectionHandler) Aggregate(ctx context.Context, query AggregateQuery) ([]AggregateGroup, error) {
+	return fch.memory.Aggregate(ctx, query)
+}
+
+//Count implements storage.CollectionHandler.Count
+func (fch *FileCollectionHandler) Count(ctx context.Context, filter Filter) (int64, error) {
+	return fch.memory.Count(ctx, filter)
+}
+
+// appendLog write the operations at the end of the log. When the write fails the log is truncated to its previous
+// size, so an incomplete entry is never followed by new entries. The mutex must be locked by the caller
+func (fch *FileCollectionHandler) appendLog(entries ...fileLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var encoded []byte
+	for _, entry := range entries {
+		encodedEntry, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		encoded = append(append(encoded, encodedEntry...), '\n')
+	}
+	if _, err := fch.logFile.Write(encoded); err != nil {
+		log.Errorf("unable to write log for collection %s. err: %s", fch.definition.Name, err.Error())
+		if err := fch.logFile.Truncate(fch.logSize); err != nil {
+			log.Errorf("unable to truncate log for collection %s. err: %s", fch.definition.Name, err.Error())
+		}
+		fch.logFile.Seek(fch.logSize, io.SeekStart)
+		return fmt.Errorf("%w: unable to write log", ErrUnavailable)
+	}
+	fch.logSize += int64(len(encoded))
+	fch.logEntries += len(entries)
+	return nil
+}
+
+// recover load the last snapshot and apply the operations found in the log, then the log is compacted
+func (fch *FileCollectionHandler) recover() error {
+	if err := fch.loadSnapshot(); err != nil {
+		return err
+	}
+	if err := fch.replayLog(); err != nil {
+		return err
+	}
+	return fch.compact()
+}
+
+func (fch *FileCollectionHandler) loadSnapshot() error {
+	content, err := ioutil.ReadFile(fch.snapshotPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snapshot fileSnapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return fmt.Errorf("invalid snapshot file %s. err: %s", fch.snapshotPath, err.Error())
+	}
+	for id, item := range snapshot.Items {
+		fch.definition.ToNative(item)
+		if err := fch.memory.insertItem(id, item); err != nil {
+			return err
+		}
+	}
+	fch.memory.lastID = snapshot.LastID
+	return nil
+}
+
+// replayLog apply all the log operations. An incomplete last entry, e.g. caused by a crash while writing, is ignored
+func (fch *FileCollectionHandler) replayLog() error {
+	file, err := os.Open(fch.logPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if len(line) > 0 {
+				log.Warnf("ignoring incomplete log entry for collection %s", fch.definition.Name)
+			}
+			return nil
+		}
+		var entry fileLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("invalid log entry in %s. err: %s", fch.logPath, err.Error())
+		}
+		if err := fch.applyLogEntry(entry); err != nil {
+			log.Warnf("ignoring log entry %s %s for collection %s. err: %s", entry.Operation, entry.ID, fch.definition.Name, err.Error())
+		}
+	}
+}
+
+func (fch *FileCollectionHandler) applyLogEntry(entry fileLogEntry) error {
+	fch.definition.ToNative(entry.Item)
+	switch entry.Operation {
+	case fileOperationAdd:
+		return fch.memory.insertItem(entry.ID, entry.Item)
+	case fileOperationUpdate:
+		return fch.memory.UpdateItem(context.Background(), entry.ID, entry.Item)
+	case fileOperationReplace:
+		return fch.memory.ReplaceItem(context.Background(), entry.ID, entry.Item)
+	case fileOperationDelete:
+		return fch.memory.DeleteItem(context.Background(), entry.ID)
+	}
+	return fmt.Errorf("unknown operation '%s'", entry.Operation)
+}
+
+// compact write a new snapshot with the whole collection content and start a new empty log. The snapshot is written
+// to a temporary file first, so a crash while compacting never loses the previous snapshot and log
+func (fch *FileCollectionHandler) compact() error {
+	fch.memory.mutex.RLock()
+	snapshot := fileSnapshot{LastID: fch.memory.lastID, Items: map[string]map[string]interface{}{}}
+	for id, item := range fch.memory.collection {
+		snapshot.Items[id] = item.(map[string]interface{})
+	}
+	encoded, err := json.Marshal(snapshot)
+	fch.memory.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := fch.snapshotPath + ".tmp"
+	if err := writeFileSync(tmpPath, encoded); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, fch.snapshotPath); err != nil {
+		return err
+	}
+	// the rename must be persisted before the log is truncated, otherwise a crash could lose both of them
+	if err := syncDir(filepath.Dir(fch.snapshotPath)); err != nil {
+		return err
+	}
+
+	// the new log is opened before closing the current one, so the handler always keeps a usable log
+	logFile, err := os.OpenFile(fch.logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if fch.logFile != nil {
+		fch.logFile.Close()
+	}
+	fch.logFile = logFile
+	fch.logSize = 0
+	fch.logEntries = 0
+	log.Debugf("compacted collection %s, %d items", fch.definition.Name, len(snapshot.Items))
+	return nil
+}
+
+// writeFileSync write the content to a new file, the content is flushed to disk before the file is closed
+func writeFileSync(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncDir flush the directory entries to disk, so created and renamed files survive a crash
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const fileStorageManifest = `[{"name": "books", "fields": {"title": {"type": "string", "unique": true}, "pages": "integer", "published": "datetime"}}]`
+
+func createFileStorage(t *testing.T, path string, compactThreshold int) CollectionHandler {
+	storage := newFileStorage(path, compactThreshold)
+	storage.Initialize(fileStorageManifest)
+	handler, err := storage.GetCollection("books")
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	return handler
+}
+
+func TestFileStorage_recover(t *testing.T) {
+	path, err := ioutil.TempDir("", "apio")
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	defer os.RemoveAll(path)
+
+	published := time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC)
+	handler := createFileStorage(t, path, 100)
+	hobbitID, _ := handler.AddItem(context.Background(), map[string]interface{}{"title": "The Hobbit", "pages": int64(300), "published": published})
+	silmarillionID, _ := handler.AddItem(context.Background(), map[string]interface{}{"title": "The Silmarillion"})
+	deletedID, _ := handler.AddItem(context.Background(), map[string]interface{}{"title": "Deleted"})
+	if err := handler.UpdateItem(context.Background(), hobbitID, map[string]interface{}{"pages": int64(310)}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if err := handler.ReplaceItem(context.Background(), silmarillionID, map[string]interface{}{"title": "The Silmarillion", "pages": int64(365)}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if err := handler.DeleteItem(context.Background(), deletedID); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+
+	recovered := createFileStorage(t, path, 100)
+	item, err := recovered.GetItem(context.Background(), hobbitID)
+	expected := map[string]interface{}{"id": hobbitID, "title": "The Hobbit", "pages": int64(310), "published": published}
+	if err != nil || !reflect.DeepEqual(item, expected) {
+		t.Fatalf("unexpected recovered item %v", item)
+	}
+	item, err = recovered.GetItem(context.Background(), silmarillionID)
+	expected = map[string]interface{}{"id": silmarillionID, "title": "The Silmarillion", "pages": int64(365)}
+	if err != nil || !reflect.DeepEqual(item, expected) {
+		t.Fatalf("unexpected recovered item %v", item)
+	}
+	if _, err := recovered.GetItem(context.Background(), deletedID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected deleted item found")
+	}
+	// IDs are never reused and unique fields are indexed again
+	if id, _ := recovered.AddItem(context.Background(), map[string]interface{}{"title": "Unfinished Tales"}); id != "4" {
+		t.Fatalf("unexpected id %s", id)
+	}
+	if _, err := recovered.AddItem(context.Background(), map[string]interface{}{"title": "The Hobbit"}); err == nil {
+		t.Fatalf("expected conflict error")
+	}
+}
+
+func TestFileStorage_recoverBulkWrite(t *testing.T) {
+	path, err := ioutil.TempDir("", "apio")
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	defer os.RemoveAll(path)
+
+	handler := createFileStorage(t, path, 100)
+	hobbitID, _ := handler.AddItem(context.Background(), map[string]interface{}{"title": "The Hobbit"})
+	results, err := handler.BulkWrite(context.Background(), []BulkOperation{
+		{Type: BulkCreate, Item: map[string]interface{}{"title": "The Silmarillion"}},
+		{Type: BulkCreate, Item: map[string]interface{}{"title": "The Hobbit"}},
+		{Type: BulkUpdate, ID: hobbitID, Item: map[string]interface{}{"pages": int64(310)}},
+	})
+	if err != nil || results[0].Err != nil || results[1].Err == nil || results[2].Err != nil {
+		t.Fatalf("unexpected results %v, err: %v", results, err)
+	}
+
+	// only the successful operations are logged
+	recovered := createFileStorage(t, path, 100)
+	if count, _ := recovered.Count(context.Background(), nil); count != 2 {
+		t.Fatalf("unexpected recovered items count %d", count)
+	}
+	item, err := recovered.GetItem(context.Background(), hobbitID)
+	if err != nil || item.(map[string]interface{})["pages"] != int64(310) {
+		t.Fatalf("unexpected recovered item %v", item)
+	}
+}
+
+func TestFileStorage_compact(t *testing.T) {
+	path, err := ioutil.TempDir("", "apio")
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	defer os.RemoveAll(path)
+
+	handler := createFileStorage(t, path, 3)
+	for _, title := range []string{"a", "b", "c", "d"} {
+		if _, err := handler.AddItem(context.Background(), map[string]interface{}{"title": title}); err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+	}
+	content, _ := ioutil.ReadFile(filepath.Join(path, "books.log"))
+	if string(content) != `{"op":"add","id":"4","item":{"title":"d"}}`+"\n" {
+		t.Fatalf("unexpected log content %s", string(content))
+	}
+
+	recovered := createFileStorage(t, path, 3)
+	if count, _ := recovered.Count(context.Background(), nil); count != 4 {
+		t.Fatalf("unexpected items count %d", count)
+	}
+}
+
+func TestFileStorage_incompleteLogEntry(t *testing.T) {
+	path, err := ioutil.TempDir("", "apio")
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	defer os.RemoveAll(path)
+
+	log := `{"op":"add","id":"1","item":{"title":"a"}}` + "\n" + `{"op":"add","id":"2","item":{"ti`
+	if err := ioutil.WriteFile(filepath.Join(path, "books.log"), []byte(log), 0644); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	handler := createFileStorage(t, path, 100)
+	if count, _ := handler.Count(context.Background(), nil); count != 1 {
+		t.Fatalf("unexpected items count %d", count)
+	}
+}
+
+func TestFileStorage_logWriteError(t *testing.T) {
+	path, err := ioutil.TempDir("", "apio")
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	defer os.RemoveAll(path)
+
+	handler := createFileStorage(t, path, 100)
+	hobbitID, _ := handler.AddItem(context.Background(), map[string]interface{}{"title": "The Hobbit"})
+	silmarillionID, _ := handler.AddItem(context.Background(), map[string]interface{}{"title": "The Silmarillion"})
+	// writes fail once the log is closed, changes must not be kept in memory
+	handler.(*FileCollectionHandler).logFile.Close()
+
+	if _, err := handler.AddItem(context.Background(), map[string]interface{}{"title": "Unfinished Tales"}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	if err := handler.ReplaceItem(context.Background(), hobbitID, map[string]interface{}{"title": "Unfinished Tales"}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	if _, err := handler.DeleteMany(context.Background(), nil); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	if count, _ := handler.Count(context.Background(), nil); count != 2 {
+		t.Fatalf("unexpected items count %d", count)
+	}
+	item, _ := handler.GetItem(context.Background(), hobbitID)
+	if !reflect.DeepEqual(item, map[string]interface{}{"id": hobbitID, "title": "The Hobbit"}) {
+		t.Fatalf("unexpected item %v", item)
+	}
+	// unique values and IDs of the reverted changes are released
+	if err := handler.UpdateItem(context.Background(), silmarillionID, map[string]interface{}{"title": "Unfinished Tales"}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	memory := handler.(*FileCollectionHandler).memory
+	if _, err := memory.AddItem(context.Background(), map[string]interface{}{"title": "Unfinished Tales"}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if _, found := memory.getItem("3"); !found {
+		t.Fatalf("expected reverted id to be reused")
+	}
+}
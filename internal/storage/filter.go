@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"strings"
+)
+
+// FilterOperator comparison operator used in a filter condition
+type FilterOperator string
+
+const (
+	//FilterEqual field value must be equal to the condition value
+	FilterEqual FilterOperator = "eq"
+	//FilterNotEqual field value must be different to the condition value, missing fields are also matched
+	FilterNotEqual FilterOperator = "ne"
+	//FilterGreaterThan field value must be greater than the condition value
+	FilterGreaterThan FilterOperator = "gt"
+	//FilterGreaterThanOrEqual field value must be greater or equal than the condition value
+	FilterGreaterThanOrEqual FilterOperator = "gte"
+	//FilterLowerThan field value must be lower than the condition value
+	FilterLowerThan FilterOperator = "lt"
+	//FilterLowerThanOrEqual field value must be lower or equal than the condition value
+	FilterLowerThanOrEqual FilterOperator = "lte"
+	//FilterIn field value must be equal to any of the condition values
+	FilterIn FilterOperator = "in"
+	//FilterNotIn field value must be different to all the condition values
+	FilterNotIn FilterOperator = "nin"
+	//FilterContains field value must be a string containing the condition value (case insensitive)
+	FilterContains FilterOperator = "contains"
+)
+
+// FilterCondition single condition applied over an item field. Value must be a []interface{} for
+// FilterIn and FilterNotIn operators, and a string for FilterContains
+type FilterCondition struct {
+	Field    string
+	Operator FilterOperator
+	Value    interface{}
+}
+
+// Filter list of conditions used to filter items, an item matches the filter when all conditions are satisfied
+type Filter []FilterCondition
+
+// Match check if the item satisfies all the filter conditions
+func (f Filter) Match(item map[string]interface{}) bool {
+	for _, condition := range f {
+		if !condition.Match(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match check if the item satisfies the condition. Array fields satisfy the condition when any of their
+// elements does, the same way MongoDB does. Condition field can be a dot separated path for nested objects
+func (fc FilterCondition) Match(item map[string]interface{}) bool {
+	value, exists := lookupValue(item, fc.Field)
+	switch fc.Operator {
+	case FilterNotEqual:
+		return !exists || !matchAny(value, fc.Value, isEqual)
+	case FilterNotIn:
+		return !exists || !matchAny(value, fc.Value, isIn)
+	}
+	if !exists {
+		return false
+	}
+	switch fc.Operator {
+	case FilterEqual:
+		return matchAny(value, fc.Value, isEqual)
+	case FilterIn:
+		return matchAny(value, fc.Value, isIn)
+	case FilterGreaterThan:
+		return matchAny(value, fc.Value, comparisonMatcher(func(result int) bool { return result > 0 }))
+	case FilterGreaterThanOrEqual:
+		return matchAny(value, fc.Value, comparisonMatcher(func(result int) bool { return result >= 0 }))
+	case FilterLowerThan:
+		return matchAny(value, fc.Value, comparisonMatcher(func(result int) bool { return result < 0 }))
+	case FilterLowerThanOrEqual:
+		return matchAny(value, fc.Value, comparisonMatcher(func(result int) bool { return result <= 0 }))
+	case FilterContains:
+		return matchAny(value, fc.Value, contains)
+	}
+	return false
+}
+
+type matcher func(value interface{}, conditionValue interface{}) bool
+
+// matchAny apply the matcher over the value, or over each element if the value is an array
+func matchAny(value interface{}, conditionValue interface{}, match matcher) bool {
+	if match(value, conditionValue) {
+		return true
+	}
+	if list, ok := value.([]interface{}); ok {
+		for _, element := range list {
+			if match(element, conditionValue) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isEqual(value interface{}, conditionValue interface{}) bool {
+	return typeOrder(value) == typeOrder(conditionValue) && compareValues(value, conditionValue) == 0
+}
+
+func isIn(value interface{}, conditionValue interface{}) bool {
+	list, _ := conditionValue.([]interface{})
+	for _, element := range list {
+		if isEqual(value, element) {
+			return true
+		}
+	}
+	return false
+}
+
+// comparisonMatcher values with different types are never matched, same as MongoDB type bracketing
+func comparisonMatcher(check func(result int) bool) matcher {
+	return func(value interface{}, conditionValue interface{}) bool {
+		return typeOrder(value) == typeOrder(conditionValue) && check(compareValues(value, conditionValue))
+	}
+}
+
+func contains(value interface{}, conditionValue interface{}) bool {
+	text, ok := value.(string)
+	search, _ := conditionValue.(string)
+	return ok && strings.Contains(strings.ToLower(text), strings.ToLower(search))
+}
+
+// lookupValue get the value for a dot separated path, e.g. "address.zip". When an array is found in the middle of
+// the path, the path is resolved for each element and a list with all the found values is returned
+func lookupValue(item map[string]interface{}, path string) (interface{}, bool) {
+	return lookupPath(item, strings.Split(path, "."))
+}
+
+func lookupPath(value interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return value, true
+	}
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		child, exists := typed[path[0]]
+		if !exists {
+			return nil, false
+		}
+		return lookupPath(child, path[1:])
+	case []interface{}:
+		var values []interface{}
+		for _, element := range typed {
+			if elementValue, exists := lookupPath(element, path); exists {
+				values = append(values, elementValue)
+			}
+		}
+		return values, values != nil
+	}
+	return nil, false
+}
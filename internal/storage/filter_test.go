@@ -0,0 +1,80 @@
+package storage
+
+import "testing"
+
+func TestFilter_Match(t *testing.T) {
+	item := map[string]interface{}{
+		"title":  "The Lord of the Rings",
+		"author": "Tolkien",
+		"year":   1954.0,
+		"tags":   []interface{}{"fantasy", "classic"},
+	}
+
+	cases := []struct {
+		description string
+		filter      Filter
+		expected    bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"equal", Filter{{Field: "author", Operator: FilterEqual, Value: "Tolkien"}}, true},
+		{"equal mismatch", Filter{{Field: "author", Operator: FilterEqual, Value: "Lewis"}}, false},
+		{"equal different type", Filter{{Field: "year", Operator: FilterEqual, Value: "1954"}}, false},
+		{"equal array element", Filter{{Field: "tags", Operator: FilterEqual, Value: "classic"}}, true},
+		{"not equal", Filter{{Field: "author", Operator: FilterNotEqual, Value: "Lewis"}}, true},
+		{"not equal missing field", Filter{{Field: "missing", Operator: FilterNotEqual, Value: "Lewis"}}, true},
+		{"greater than", Filter{{Field: "year", Operator: FilterGreaterThan, Value: 1950.0}}, true},
+		{"greater than equal value", Filter{{Field: "year", Operator: FilterGreaterThan, Value: 1954.0}}, false},
+		{"greater or equal", Filter{{Field: "year", Operator: FilterGreaterThanOrEqual, Value: 1954.0}}, true},
+		{"lower than", Filter{{Field: "year", Operator: FilterLowerThan, Value: 1954.0}}, false},
+		{"lower or equal", Filter{{Field: "year", Operator: FilterLowerThanOrEqual, Value: 1954.0}}, true},
+		{"comparison different type", Filter{{Field: "year", Operator: FilterGreaterThan, Value: "1000"}}, false},
+		{"comparison missing field", Filter{{Field: "missing", Operator: FilterLowerThan, Value: 1000.0}}, false},
+		{"in", Filter{{Field: "author", Operator: FilterIn, Value: []interface{}{"Lewis", "Tolkien"}}}, true},
+		{"not in", Filter{{Field: "author", Operator: FilterNotIn, Value: []interface{}{"Lewis", "Tolkien"}}}, false},
+		{"contains", Filter{{Field: "title", Operator: FilterContains, Value: "RING"}}, true},
+		{"contains mismatch", Filter{{Field: "title", Operator: FilterContains, Value: "hobbit"}}, false},
+		{"multiple conditions", Filter{
+			{Field: "year", Operator: FilterGreaterThanOrEqual, Value: 1950.0},
+			{Field: "year", Operator: FilterLowerThan, Value: 1960.0},
+			{Field: "author", Operator: FilterEqual, Value: "Tolkien"},
+		}, true},
+		{"multiple conditions failing", Filter{
+			{Field: "year", Operator: FilterGreaterThanOrEqual, Value: 1950.0},
+			{Field: "author", Operator: FilterEqual, Value: "Lewis"},
+		}, false},
+	}
+
+	for _, c := range cases {
+		if c.filter.Match(item) != c.expected {
+			t.Errorf("unexpected result for case '%s'", c.description)
+		}
+	}
+}
+
+func TestFilter_Match_nested(t *testing.T) {
+	item := map[string]interface{}{
+		"address": map[string]interface{}{"zip": "1234"},
+		"authors": []interface{}{
+			map[string]interface{}{"name": "Tolkien"},
+			map[string]interface{}{"name": "Lewis"},
+		},
+	}
+
+	cases := []struct {
+		description string
+		filter      Filter
+		expected    bool
+	}{
+		{"nested object", Filter{{Field: "address.zip", Operator: FilterEqual, Value: "1234"}}, true},
+		{"nested object mismatch", Filter{{Field: "address.zip", Operator: FilterEqual, Value: "0000"}}, false},
+		{"missing nested field", Filter{{Field: "address.street", Operator: FilterEqual, Value: "Bag End"}}, false},
+		{"array of objects", Filter{{Field: "authors.name", Operator: FilterEqual, Value: "Lewis"}}, true},
+		{"array of objects not equal", Filter{{Field: "authors.name", Operator: FilterNotEqual, Value: "Lewis"}}, false},
+	}
+
+	for _, c := range cases {
+		if c.filter.Match(item) != c.expected {
+			t.Errorf("unexpected result for case '%s'", c.description)
+		}
+	}
+}
@@ -1,27 +1,46 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"log"
 	"monkiato/apio/internal/data"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 type collectionData map[string]interface{}
 
-//MemoryStorage structure for the storage using in-memory data (ideal for testing, not for production)
+//MemoryStorage structure for the storage using in-memory data (ideal for testing, not for production).
+//It's safe for concurrent use
 type MemoryStorage struct {
 	collectionsDefinitions []data.CollectionDefinition
 	dataCollections        map[string]collectionData
 	collectionHandlers     map[string]CollectionHandler
+	// mutex protects collectionHandlers, lazily populated by GetCollection
+	mutex sync.Mutex
 }
 
-//MemoryCollectionHandler data handler used for a specific collection
+//MemoryCollectionHandler data handler used for a specific collection. It's safe for concurrent use, stored items
+//are never modified in place, so items obtained from the handler can be read while other requests update them
 type MemoryCollectionHandler struct {
+	// mutex protects all the handler data, write operations lock it exclusively
+	mutex      sync.RWMutex
 	collection collectionData
+	definition data.CollectionDefinition
 	lastID     int64
+	// uniqueIndex item ID for each value used in unique fields, indexed by field name
+	uniqueIndex map[string]map[interface{}]string
+	// searchIndex inverted index for the searchable fields
+	searchIndex *searchIndex
+	// changes previous content of the items modified while changes are tracked, nil for created items
+	changes map[string]interface{}
+	// changesLastID last generated ID when changes tracking started
+	changesLastID int64
 }
 
 //NewMemoryStorage create a new MemoryStarage instance
@@ -32,70 +51,596 @@ func NewMemoryStorage() Storage {
 	}
 }
 
-func newMemoryStorageCollectionHandler(collection collectionData) CollectionHandler {
+func newMemoryStorageCollectionHandler(collection collectionData, definition data.CollectionDefinition) CollectionHandler {
+	uniqueIndex := map[string]map[interface{}]string{}
+	for _, name := range definition.UniqueFields() {
+		uniqueIndex[name] = map[interface{}]string{}
+	}
 	return &MemoryCollectionHandler{
-		collection: collection,
+		collection:  collection,
+		definition:  definition,
+		uniqueIndex: uniqueIndex,
+		searchIndex: newSearchIndex(definition.SearchableFields()),
 	}
 }
 
 //GetItem implements storage.CollectionHandler.GetItem
-func (msc *MemoryCollectionHandler) GetItem(itemID string) (interface{}, bool) {
+func (msc *MemoryCollectionHandler) GetItem(ctx context.Context, itemID string) (interface{}, error) {
+	return msc.GetItemFields(ctx, itemID, Projection{})
+}
+
+//GetItemFields implements storage.CollectionHandler.GetItemFields
+func (msc *MemoryCollectionHandler) GetItemFields(ctx context.Context, itemID string, fields Projection) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(err)
+	}
+	msc.mutex.RLock()
+	defer msc.mutex.RUnlock()
+	if item, found := msc.getItem(itemID); found {
+		return fields.Apply(withID(item.(map[string]interface{}), itemID)), nil
+	}
+	return nil, notFoundError(itemID)
+}
+
+func (msc *MemoryCollectionHandler) getItem(itemID string) (interface{}, bool) {
 	if data, ok := msc.collection[itemID]; ok {
 		return data, true
 	}
 	return nil, false
 }
 
+//ValidateID implements storage.CollectionHandler.ValidateID
+func (msc *MemoryCollectionHandler) ValidateID(itemID string) error {
+	if msc.definition.IDStrategy == "" {
+		if _, err := strconv.ParseUint(itemID, 16, 63); err != nil {
+			return invalidIDError(itemID)
+		}
+		return nil
+	}
+	if !msc.definition.IsIDValid(itemID) {
+		return invalidIDError(itemID)
+	}
+	return nil
+}
+
+// idBase numeric base used for incremental IDs, hex IDs are used when the collection doesn't declare an ID strategy.
+// Zero is returned for non incremental IDs
+func (msc *MemoryCollectionHandler) idBase() int {
+	switch msc.definition.IDStrategy {
+	case "":
+		return 16
+	case data.IDStrategyIncrement:
+		return 10
+	}
+	return 0
+}
+
 //AddItem implements storage.CollectionHandler.AddItem
-func (msc *MemoryCollectionHandler) AddItem(item map[string]interface{}) (string, error) {
-	msc.lastID++
-	id := strconv.FormatInt(msc.lastID, 16)
-	msc.collection[id] = item
+func (msc *MemoryCollectionHandler) AddItem(ctx context.Context, item map[string]interface{}) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", contextError(err)
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	return msc.addItem(item)
+}
+
+// addItem store a new item using a generated ID. The mutex must be locked by the caller
+func (msc *MemoryCollectionHandler) addItem(item map[string]interface{}) (string, error) {
+	var id string
+	switch msc.definition.IDStrategy {
+	case data.IDStrategyClient:
+		return "", missingClientIDError()
+	case data.IDStrategyUUID:
+		id = data.NewUUID()
+	case data.IDStrategyObjectID:
+		id = primitive.NewObjectID().Hex()
+	default:
+		id = strconv.FormatInt(msc.lastID+1, msc.idBase())
+	}
+	if err := msc.insertItem(id, item); err != nil {
+		return "", err
+	}
 	return id, nil
 }
 
+//InsertItem implements storage.CollectionHandler.InsertItem
+func (msc *MemoryCollectionHandler) InsertItem(ctx context.Context, itemID string, item map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	return msc.createItem(itemID, item)
+}
+
+// createItem store a new item using the specified ID, it fails if the ID is already used. The mutex must be locked
+// by the caller
+func (msc *MemoryCollectionHandler) createItem(itemID string, item map[string]interface{}) error {
+	if err := msc.ValidateID(itemID); err != nil {
+		return err
+	}
+	if _, found := msc.getItem(itemID); found {
+		return existingItemError(itemID)
+	}
+	return msc.insertItem(itemID, item)
+}
+
+// insertItem store a new item using the specified ID, the last generated ID is updated so new IDs are never reused
+func (msc *MemoryCollectionHandler) insertItem(itemID string, item map[string]interface{}) error {
+	if err := msc.checkUnique(itemID, item); err != nil {
+		return err
+	}
+	msc.trackChange(itemID)
+	if base := msc.idBase(); base > 0 {
+		if numericID, err := strconv.ParseInt(itemID, base, 64); err == nil && numericID > msc.lastID {
+			msc.lastID = numericID
+		}
+	}
+	msc.collection[itemID] = item
+	msc.indexItem(itemID, item)
+	return nil
+}
+
+//UpsertItem implements storage.CollectionHandler.UpsertItem
+func (msc *MemoryCollectionHandler) UpsertItem(ctx context.Context, itemID string, item map[string]interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, contextError(err)
+	}
+	if err := msc.ValidateID(itemID); err != nil {
+		return false, err
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	return msc.upsertItem(itemID, item)
+}
+
+// upsertItem replace the item content or insert it if it doesn't exist. The mutex must be locked by the caller
+func (msc *MemoryCollectionHandler) upsertItem(itemID string, item map[string]interface{}) (bool, error) {
+	if _, found := msc.getItem(itemID); found {
+		return false, msc.storeItem(itemID, item)
+	}
+	return true, msc.insertItem(itemID, item)
+}
+
 //UpdateItem implements storage.CollectionHandler.UpdateItem
-func (msc *MemoryCollectionHandler) UpdateItem(itemID string, newItem map[string]interface{}) error {
-	_, found := msc.GetItem(itemID)
+func (msc *MemoryCollectionHandler) UpdateItem(ctx context.Context, itemID string, newItem map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	return msc.updateItem(itemID, newItem)
+}
+
+// updateItem store a copy of the item with the new field values. The mutex must be locked by the caller
+func (msc *MemoryCollectionHandler) updateItem(itemID string, newItem map[string]interface{}) error {
+	item, found := msc.getItem(itemID)
 	if !found {
-		return fmt.Errorf("item '%s' not found", itemID)
+		return notFoundError(itemID)
 	}
-	msc.collection[itemID] = newItem
-	return nil
+	return msc.storeItem(itemID, mergeItem(item.(map[string]interface{}), newItem))
+}
+
+// mergeItem copy of the item including the new field values
+func mergeItem(item map[string]interface{}, newItem map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(item)+len(newItem))
+	for key, value := range item {
+		merged[key] = value
+	}
+	for key, value := range newItem {
+		merged[key] = value
+	}
+	return merged
+}
+
+//UpdateMany implements storage.CollectionHandler.UpdateMany
+func (msc *MemoryCollectionHandler) UpdateMany(ctx context.Context, filter Filter, newItem map[string]interface{}) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(err)
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	ids, err := msc.updateMatching(filter, newItem)
+	return int64(len(ids)), err
+}
+
+// updateMatching update all the items matching the filter, the IDs of the updated items are returned. Unique fields
+// are checked for all the items first, so the update is applied to every item or to none. The mutex must be locked by
+// the caller
+func (msc *MemoryCollectionHandler) updateMatching(filter Filter, newItem map[string]interface{}) ([]string, error) {
+	ids := msc.matchingIDs(filter)
+	if len(ids) > 1 {
+		for name := range msc.uniqueIndex {
+			if _, exists := newItem[name]; exists {
+				return nil, fmt.Errorf("%w: duplicated value for unique field '%s'", ErrConflict, name)
+			}
+		}
+	}
+	updatedItems := make([]map[string]interface{}, len(ids))
+	for i, id := range ids {
+		updatedItems[i] = mergeItem(msc.collection[id].(map[string]interface{}), newItem)
+		if err := msc.checkUnique(id, updatedItems[i]); err != nil {
+			return nil, err
+		}
+	}
+	for i, id := range ids {
+		msc.storeItem(id, updatedItems[i])
+	}
+	return ids, nil
+}
+
+//DeleteMany implements storage.CollectionHandler.DeleteMany
+func (msc *MemoryCollectionHandler) DeleteMany(ctx context.Context, filter Filter) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(err)
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	return int64(len(msc.deleteMatching(filter))), nil
+}
+
+// deleteMatching remove all the items matching the filter, the IDs of the deleted items are returned. The mutex must
+// be locked by the caller
+func (msc *MemoryCollectionHandler) deleteMatching(filter Filter) []string {
+	ids := msc.matchingIDs(filter)
+	for _, id := range ids {
+		msc.deleteItem(id)
+	}
+	return ids
+}
+
+// matchingIDs IDs of the items matching the filter, sorted by ID. The mutex must be locked by the caller
+func (msc *MemoryCollectionHandler) matchingIDs(filter Filter) []string {
+	var ids []string
+	for id, value := range msc.collection {
+		if item, ok := value.(map[string]interface{}); ok && filter.Match(item) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return msc.compareIDs(ids[i], ids[j]) < 0
+	})
+	return ids
+}
+
+//ReplaceItem implements storage.CollectionHandler.ReplaceItem
+func (msc *MemoryCollectionHandler) ReplaceItem(ctx context.Context, itemID string, newItem map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	return msc.replaceItem(itemID, newItem)
+}
+
+// replaceItem replace the content of an existing item. The mutex must be locked by the caller
+func (msc *MemoryCollectionHandler) replaceItem(itemID string, newItem map[string]interface{}) error {
+	if _, found := msc.getItem(itemID); !found {
+		return notFoundError(itemID)
+	}
+	return msc.storeItem(itemID, newItem)
+}
+
+//PatchItem implements storage.CollectionHandler.PatchItem, the patch is applied while the mutex is locked
+func (msc *MemoryCollectionHandler) PatchItem(ctx context.Context, itemID string, patch ItemPatch) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	_, err := msc.patchItem(itemID, patch)
+	return err
+}
+
+// patchItem store the result of the patch over the current item content, the new content is returned.
+// The mutex must be locked by the caller
+func (msc *MemoryCollectionHandler) patchItem(itemID string, patch ItemPatch) (map[string]interface{}, error) {
+	item, found := msc.getItem(itemID)
+	if !found {
+		return nil, notFoundError(itemID)
+	}
+	newItem, err := patch(withID(item.(map[string]interface{}), itemID))
+	if err != nil {
+		return nil, err
+	}
+	if err := msc.storeItem(itemID, newItem); err != nil {
+		return nil, err
+	}
+	return newItem, nil
 }
 
 //DeleteItem implements storage.CollectionHandler.DeleteItem
-func (msc *MemoryCollectionHandler) DeleteItem(itemID string) error {
-	_, found := msc.GetItem(itemID)
+func (msc *MemoryCollectionHandler) DeleteItem(ctx context.Context, itemID string) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	return msc.deleteItem(itemID)
+}
+
+// deleteItem remove the item and its unique fields values. The mutex must be locked by the caller
+func (msc *MemoryCollectionHandler) deleteItem(itemID string) error {
+	item, found := msc.getItem(itemID)
 	if !found {
-		return fmt.Errorf("item '%s' not found", itemID)
+		return notFoundError(itemID)
 	}
+	msc.trackChange(itemID)
+	msc.unindexItem(itemID, item.(map[string]interface{}))
 	delete(msc.collection, itemID)
 	return nil
 }
 
+//BulkWrite implements storage.CollectionHandler.BulkWrite, the whole batch is applied while the mutex is locked,
+//so other requests never see a partially applied batch
+func (msc *MemoryCollectionHandler) BulkWrite(ctx context.Context, operations []BulkOperation) ([]BulkResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(err)
+	}
+	msc.mutex.Lock()
+	defer msc.mutex.Unlock()
+	return msc.bulkWrite(operations), nil
+}
+
+// bulkWrite apply the operations in the same order, the result of each one is returned. The mutex must be locked by
+// the caller
+func (msc *MemoryCollectionHandler) bulkWrite(operations []BulkOperation) []BulkResult {
+	results := make([]BulkResult, len(operations))
+	for i, operation := range operations {
+		results[i] = BulkResult{ID: operation.ID}
+		switch operation.Type {
+		case BulkCreate:
+			if operation.ID == "" {
+				results[i].ID, results[i].Err = msc.addItem(operation.Item)
+			} else {
+				results[i].Err = msc.createItem(operation.ID, operation.Item)
+			}
+		case BulkUpdate:
+			if results[i].Err = msc.ValidateID(operation.ID); results[i].Err == nil {
+				results[i].Err = msc.updateItem(operation.ID, operation.Item)
+			}
+		case BulkDelete:
+			if results[i].Err = msc.ValidateID(operation.ID); results[i].Err == nil {
+				results[i].Err = msc.deleteItem(operation.ID)
+			}
+		default:
+			results[i].Err = unknownBulkOperationError(operation.Type)
+		}
+	}
+	return results
+}
+
+// storeItem replace the content of an existing item, unique fields index is updated
+func (msc *MemoryCollectionHandler) storeItem(itemID string, item map[string]interface{}) error {
+	if err := msc.checkUnique(itemID, item); err != nil {
+		return err
+	}
+	msc.trackChange(itemID)
+	msc.unindexItem(itemID, msc.collection[itemID].(map[string]interface{}))
+	msc.collection[itemID] = item
+	msc.indexItem(itemID, item)
+	return nil
+}
+
+// trackChanges start keeping the previous content of the modified items, so the changes can be reverted.
+// The mutex must be locked by the caller until the tracking ends
+func (msc *MemoryCollectionHandler) trackChanges() {
+	msc.changes = map[string]interface{}{}
+	msc.changesLastID = msc.lastID
+}
+
+// trackChange keep the current content of the item if changes are being tracked and it wasn't modified yet
+func (msc *MemoryCollectionHandler) trackChange(itemID string) {
+	if msc.changes == nil {
+		return
+	}
+	if _, tracked := msc.changes[itemID]; !tracked {
+		msc.changes[itemID] = msc.collection[itemID]
+	}
+}
+
+// endChanges stop tracking changes, the items modified since trackChanges was called are restored when revert is true
+func (msc *MemoryCollectionHandler) endChanges(revert bool) {
+	changes := msc.changes
+	msc.changes = nil
+	if !revert {
+		return
+	}
+	// current values are unindexed first, so unique values moved between items are indexed again
+	for id := range changes {
+		if item, found := msc.getItem(id); found {
+			msc.unindexItem(id, item.(map[string]interface{}))
+			delete(msc.collection, id)
+		}
+	}
+	for id, item := range changes {
+		if item != nil {
+			msc.collection[id] = item
+			msc.indexItem(id, item.(map[string]interface{}))
+		}
+	}
+	msc.lastID = msc.changesLastID
+}
+
+// checkUnique check the values for unique fields are not used by other items. Missing fields are not indexed,
+// the same way a sparse index works in MongoDB
+func (msc *MemoryCollectionHandler) checkUnique(itemID string, item map[string]interface{}) error {
+	for name, index := range msc.uniqueIndex {
+		value, exists := item[name]
+		if !exists {
+			continue
+		}
+		if ownerID, used := index[value]; used && ownerID != itemID {
+			return fmt.Errorf("%w: duplicated value for unique field '%s'", ErrConflict, name)
+		}
+	}
+	return nil
+}
+
+func (msc *MemoryCollectionHandler) indexItem(itemID string, item map[string]interface{}) {
+	for name, index := range msc.uniqueIndex {
+		if value, exists := item[name]; exists {
+			index[value] = itemID
+		}
+	}
+	msc.searchIndex.add(itemID, item)
+}
+
+func (msc *MemoryCollectionHandler) unindexItem(itemID string, item map[string]interface{}) {
+	for name, index := range msc.uniqueIndex {
+		if value, exists := item[name]; exists {
+			delete(index, value)
+		}
+	}
+	msc.searchIndex.remove(itemID, item)
+}
+
 //Query implements storage.CollectionHandler.Query
-func (msc *MemoryCollectionHandler) Query(query QueryParams) ([]interface{}, error) {
-	var items []interface{}
+func (msc *MemoryCollectionHandler) Query(ctx context.Context, query QueryParams) (QueryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return QueryResult{}, contextError(err)
+	}
+	if query.After != nil && msc.ValidateID(query.After.ID) != nil {
+		return QueryResult{}, invalidCursorError(query.After.ID)
+	}
+	msc.mutex.RLock()
+	defer msc.mutex.RUnlock()
+	result := QueryResult{}
 	var count int64 = 0
+	var lastKey string
 
 	keys := make([]string, 0, len(msc.collection))
 	for k := range msc.collection {
 		keys = append(keys, k)
 	}
-	sort.Strings(keys)
+	sort.Slice(keys, func(i, j int) bool {
+		return msc.compareItems(keys[i], keys[j], query.SortBy) < 0
+	})
 
 	for _, key := range keys {
+		item, _ := msc.collection[key].(map[string]interface{})
+		if !query.Filter.Match(item) {
+			continue
+		}
+		if query.After != nil && msc.compareToCursor(item, key, query.After, query.SortBy) <= 0 {
+			continue
+		}
 		count++
 		if query.Skip >= count {
 			continue
 		}
-		items = append(items, msc.collection[key])
-		if query.Limit == int64(len(items)) {
+		if query.Limit > 0 && query.Limit == int64(len(result.Items)) {
+			// there are more items after the last one
+			lastItem, _ := msc.collection[lastKey].(map[string]interface{})
+			result.Next = NewCursor(query.SortBy, lastKey, lastItem)
 			break
 		}
+		result.Items = append(result.Items, query.Fields.Apply(withID(item, key)))
+		lastKey = key
+	}
+	return result, nil
+}
+
+//Search implements storage.CollectionHandler.Search, using the inverted index of the searchable fields
+func (msc *MemoryCollectionHandler) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(err)
+	}
+	msc.mutex.RLock()
+	defer msc.mutex.RUnlock()
+	scores := msc.searchIndex.search(query.Text, len(msc.collection))
+	for id := range scores {
+		if !query.Filter.Match(msc.collection[id].(map[string]interface{})) {
+			delete(scores, id)
+		}
+	}
+	ids := rankedIDs(scores, func(idA string, idB string) bool {
+		return msc.compareIDs(idA, idB) < 0
+	}, query.Skip, query.Limit)
+	results := make([]SearchResult, len(ids))
+	for i, id := range ids {
+		results[i] = SearchResult{
+			Item:  withID(msc.collection[id].(map[string]interface{}), id),
+			Score: scores[id],
+		}
+	}
+	return results, nil
+}
+
+//Aggregate implements storage.CollectionHandler.Aggregate
+func (msc *MemoryCollectionHandler) Aggregate(ctx context.Context, query AggregateQuery) ([]AggregateGroup, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(err)
+	}
+	msc.mutex.RLock()
+	defer msc.mutex.RUnlock()
+	aggregator := newAggregator(msc.definition, query)
+	for _, value := range msc.collection {
+		if item, ok := value.(map[string]interface{}); ok && query.Filter.Match(item) {
+			aggregator.add(item)
+		}
 	}
-	return items, nil
+	return aggregator.result(), nil
+}
+
+//Count implements storage.CollectionHandler.Count
+func (msc *MemoryCollectionHandler) Count(ctx context.Context, filter Filter) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, contextError(err)
+	}
+	msc.mutex.RLock()
+	defer msc.mutex.RUnlock()
+	var count int64 = 0
+	for _, value := range msc.collection {
+		if item, ok := value.(map[string]interface{}); ok && !filter.Match(item) {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// compareItems compare two items using the sorting criteria, the item ID is used as the last criteria
+// so the final order is always deterministic
+func (msc *MemoryCollectionHandler) compareItems(idA string, idB string, sortBy []SortField) int {
+	itemA, _ := msc.collection[idA].(map[string]interface{})
+	itemB, _ := msc.collection[idB].(map[string]interface{})
+	for _, sortField := range sortBy {
+		valueA, _ := lookupValue(itemA, sortField.Name)
+		valueB, _ := lookupValue(itemB, sortField.Name)
+		result := compareValues(valueA, valueB)
+		if sortField.Descending {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return msc.compareIDs(idA, idB)
+}
+
+// compareToCursor compare the item position with the position pointed by the cursor
+func (msc *MemoryCollectionHandler) compareToCursor(item map[string]interface{}, itemID string, cursor *Cursor, sortBy []SortField) int {
+	for i, sortField := range sortBy {
+		value, _ := lookupValue(item, sortField.Name)
+		result := compareValues(value, cursor.Values[i])
+		if sortField.Descending {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return msc.compareIDs(itemID, cursor.ID)
+}
+
+// compareIDs incremental IDs are compared as numbers, so shorter IDs are always lower. Other IDs are compared as text
+func (msc *MemoryCollectionHandler) compareIDs(idA string, idB string) int {
+	if len(idA) != len(idB) && msc.idBase() > 0 {
+		return compareInts(len(idA), len(idB))
+	}
+	return strings.Compare(idA, idB)
 }
 
 //Initialize implements storage.Storage.Initialize
@@ -111,10 +656,12 @@ func (ms *MemoryStorage) GetCollectionDefinitions() []data.CollectionDefinition
 
 //GetCollection implements storage.Storage.GetCollection
 func (ms *MemoryStorage) GetCollection(collectionName string) (CollectionHandler, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
 	if collection, ok := ms.dataCollections[collectionName]; ok {
 		storageCollection, exists := ms.collectionHandlers[collectionName]
 		if !exists {
-			storageCollection = newMemoryStorageCollectionHandler(collection)
+			storageCollection = newMemoryStorageCollectionHandler(collection, ms.collectionDefinition(collectionName))
 			ms.collectionHandlers[collectionName] = storageCollection
 		}
 		return storageCollection, nil
@@ -122,6 +669,15 @@ func (ms *MemoryStorage) GetCollection(collectionName string) (CollectionHandler
 	return nil, fmt.Errorf("collection %s not found", collectionName)
 }
 
+func (ms *MemoryStorage) collectionDefinition(collectionName string) data.CollectionDefinition {
+	for _, collectionDefinition := range ms.collectionsDefinitions {
+		if collectionDefinition.Name == collectionName {
+			return collectionDefinition
+		}
+	}
+	return data.CollectionDefinition{}
+}
+
 func (ms *MemoryStorage) initializeCollectionDefinitions(manifest string) {
 	err := json.Unmarshal([]byte(manifest), &ms.collectionsDefinitions)
 	if err != nil {
@@ -1,9 +1,14 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"monkiato/apio/internal/data"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func createCollection() collectionData {
@@ -25,11 +30,11 @@ func createManifest(t *testing.T) string {
 	definition := []data.CollectionDefinition{
 		{
 			Name: "test",
-			Fields: map[string]string{
-				"name":      "string",
-				"lastname":  "string",
-				"age":       "float",
-				"is_active": "bool",
+			Fields: map[string]data.FieldDefinition{
+				"name":      {Type: "string"},
+				"lastname":  {Type: "string"},
+				"age":       {Type: "float"},
+				"is_active": {Type: "bool"},
 			},
 		},
 	}
@@ -51,7 +56,7 @@ func TestMemoryCollectionHandler_AddItem(t *testing.T) {
 	handler := &MemoryCollectionHandler{
 		collection: map[string]interface{}{},
 	}
-	id, err := handler.AddItem(createItem())
+	id, err := handler.AddItem(context.Background(), createItem())
 	if err != nil {
 		t.Errorf("unexpected error: " + err.Error())
 	}
@@ -64,7 +69,7 @@ func TestMemoryCollectionHandler_DeleteItem(t *testing.T) {
 	handler := &MemoryCollectionHandler{
 		collection: createCollection(),
 	}
-	if err := handler.DeleteItem("1"); err != nil {
+	if err := handler.DeleteItem(context.Background(), "1"); err != nil {
 		t.Fatalf("unexpected error: " + err.Error())
 	}
 }
@@ -73,7 +78,7 @@ func TestMemoryCollectionHandler_DeleteItem_notFound(t *testing.T) {
 	handler := &MemoryCollectionHandler{
 		collection: createCollection(),
 	}
-	if err := handler.DeleteItem("2"); err == nil {
+	if err := handler.DeleteItem(context.Background(), "2"); err == nil {
 		t.Fatalf("unexpected success result")
 	}
 }
@@ -82,14 +87,15 @@ func TestMemoryCollectionHandler_GetItem(t *testing.T) {
 	handler := &MemoryCollectionHandler{
 		collection: createCollection(),
 	}
-	data, found := handler.GetItem("1")
-	if !found {
-		t.Errorf("item not found")
+	data, err := handler.GetItem(context.Background(), "1")
+	if err != nil {
+		t.Errorf("unexpected error: " + err.Error())
 	}
 	if data == nil {
 		t.Fatalf("unexpected nil data")
 	}
-	if len(data.(map[string]interface{})) != 4 {
+	// stored properties plus the item ID
+	if len(data.(map[string]interface{})) != 5 || data.(map[string]interface{})["id"] != "1" {
 		t.Fatalf("unexpected properties in data")
 	}
 }
@@ -98,9 +104,9 @@ func TestMemoryCollectionHandler_GetItem_notFound(t *testing.T) {
 	handler := &MemoryCollectionHandler{
 		collection: createCollection(),
 	}
-	data, found := handler.GetItem("2")
-	if found {
-		t.Errorf("unexpected item found")
+	data, err := handler.GetItem(context.Background(), "2")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
 	}
 	if data != nil {
 		t.Fatalf("unexpected valid data")
@@ -112,24 +118,169 @@ func TestMemoryCollectionHandler_Query(t *testing.T) {
 	handler := &MemoryCollectionHandler{
 		collection: createCollection(),
 	}
-	handler.AddItem(createItem())
-	handler.AddItem(createItem())
-	handler.AddItem(createItem())
-	handler.AddItem(createItem())
-	list, err := handler.Query(QueryParams{})
+	handler.AddItem(context.Background(), createItem())
+	handler.AddItem(context.Background(), createItem())
+	handler.AddItem(context.Background(), createItem())
+	handler.AddItem(context.Background(), createItem())
+	result, err := handler.Query(context.Background(), QueryParams{})
 	if err != nil {
 		t.Fatalf("unexpected error: " + err.Error())
 	}
-	if len(list) != 4 {
+	if len(result.Items) != 4 {
 		t.Fatalf("unexpected list length")
 	}
 }
 
+func TestMemoryCollectionHandler_Query_sortBy(t *testing.T) {
+	handler := &MemoryCollectionHandler{
+		collection: map[string]interface{}{},
+	}
+	for _, item := range []map[string]interface{}{
+		{"name": "Bob", "age": 20.0},
+		{"name": "Alice", "age": 30.0},
+		{"name": "Carl", "age": 20.0},
+		{"name": "Dan"},
+	} {
+		handler.AddItem(context.Background(), item)
+	}
+	result, err := handler.Query(context.Background(), QueryParams{
+		SortBy: []SortField{
+			{Name: "age", Descending: true},
+			{Name: "name"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	expected := []string{"Alice", "Bob", "Carl", "Dan"}
+	for i, name := range expected {
+		if result.Items[i].(map[string]interface{})["name"] != name {
+			t.Fatalf("unexpected item at position %d: %v", i, result.Items[i])
+		}
+	}
+}
+
+func TestMemoryCollectionHandler_Query_defaultOrder(t *testing.T) {
+	handler := &MemoryCollectionHandler{
+		collection: map[string]interface{}{},
+	}
+	for i := 0; i < 20; i++ {
+		handler.AddItem(context.Background(), map[string]interface{}{"age": float64(i)})
+	}
+	result, _ := handler.Query(context.Background(), QueryParams{})
+	for i, item := range result.Items {
+		if item.(map[string]interface{})["age"] != float64(i) {
+			t.Fatalf("unexpected item at position %d: %v", i, item)
+		}
+	}
+}
+
+func TestMemoryCollectionHandler_Query_filter(t *testing.T) {
+	handler := &MemoryCollectionHandler{
+		collection: map[string]interface{}{},
+	}
+	for _, item := range []map[string]interface{}{
+		{"name": "Bob", "age": 20.0},
+		{"name": "Alice", "age": 30.0},
+		{"name": "Carl", "age": 40.0},
+		{"name": "Dan", "age": 50.0},
+	} {
+		handler.AddItem(context.Background(), item)
+	}
+	result, err := handler.Query(context.Background(), QueryParams{
+		Skip:  1,
+		Limit: 1,
+		Filter: Filter{
+			{Field: "age", Operator: FilterGreaterThan, Value: 20.0},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if len(result.Items) != 1 || result.Items[0].(map[string]interface{})["name"] != "Carl" {
+		t.Fatalf("unexpected result %v", result.Items)
+	}
+}
+
+func TestMemoryCollectionHandler_Query_cursor(t *testing.T) {
+	handler := &MemoryCollectionHandler{
+		collection: map[string]interface{}{},
+	}
+	for _, item := range []map[string]interface{}{
+		{"name": "Bob", "age": 20.0},
+		{"name": "Alice", "age": 30.0},
+		{"name": "Carl", "age": 20.0},
+		{"name": "Dan"},
+		{"name": "Eve", "age": 30.0},
+	} {
+		handler.AddItem(context.Background(), item)
+	}
+	sortBy := []SortField{{Name: "age", Descending: true}}
+
+	var names []interface{}
+	var after *Cursor
+	for page := 0; page < 3; page++ {
+		result, err := handler.Query(context.Background(), QueryParams{Limit: 2, SortBy: sortBy, After: after})
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		for _, item := range result.Items {
+			names = append(names, item.(map[string]interface{})["name"])
+		}
+		if result.Next == nil {
+			break
+		}
+		// cursor must survive the encoding round trip
+		if after, err = DecodeCursor(result.Next.Encode(), sortBy); err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+	}
+	expected := []interface{}{"Alice", "Eve", "Bob", "Carl", "Dan"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("unexpected items %v", names)
+	}
+}
+
+func TestMemoryCollectionHandler_Query_lastPageWithoutCursor(t *testing.T) {
+	handler := &MemoryCollectionHandler{
+		collection: map[string]interface{}{},
+	}
+	handler.AddItem(context.Background(), createItem())
+	handler.AddItem(context.Background(), createItem())
+	result, _ := handler.Query(context.Background(), QueryParams{Limit: 2})
+	if result.Next != nil {
+		t.Fatalf("unexpected next cursor")
+	}
+	result, _ = handler.Query(context.Background(), QueryParams{Limit: 1})
+	if result.Next == nil {
+		t.Fatalf("next cursor expected")
+	}
+}
+
+func TestMemoryCollectionHandler_Count(t *testing.T) {
+	handler := &MemoryCollectionHandler{
+		collection: map[string]interface{}{},
+	}
+	handler.AddItem(context.Background(), createItem())
+	handler.AddItem(context.Background(), map[string]interface{}{"name": "Alice"})
+	count, err := handler.Count(context.Background(), Filter{})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if count != 2 {
+		t.Fatalf("unexpected count %d", count)
+	}
+	count, _ = handler.Count(context.Background(), Filter{{Field: "name", Operator: FilterEqual, Value: "Alice"}})
+	if count != 1 {
+		t.Fatalf("unexpected filtered count %d", count)
+	}
+}
+
 func TestMemoryCollectionHandler_UpdateItem(t *testing.T) {
 	handler := &MemoryCollectionHandler{
 		collection: createCollection(),
 	}
-	if err := handler.UpdateItem("1", map[string]interface{} {
+	if err := handler.UpdateItem(context.Background(), "1", map[string]interface{} {
 		"name": "Bob updated",
 		"lastname": "Howards updated",
 		"age": 10.0,
@@ -143,7 +294,7 @@ func TestMemoryCollectionHandler_UpdateItem_wrongId(t *testing.T) {
 	handler := &MemoryCollectionHandler{
 		collection: createCollection(),
 	}
-	if err := handler.UpdateItem("2", map[string]interface{} {
+	if err := handler.UpdateItem(context.Background(), "2", map[string]interface{} {
 		"name": "Bob updated",
 		"lastname": "Howards updated",
 		"age": 10.0,
@@ -153,6 +304,45 @@ func TestMemoryCollectionHandler_UpdateItem_wrongId(t *testing.T) {
 	}
 }
 
+func TestMemoryCollectionHandler_UpdateItem_partial(t *testing.T) {
+	handler := &MemoryCollectionHandler{
+		collection: createCollection(),
+	}
+	if err := handler.UpdateItem(context.Background(), "1", map[string]interface{}{
+		"name": "Bob updated",
+	}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	item, _ := handler.GetItem(context.Background(), "1")
+	if len(item.(map[string]interface{})) != 5 || item.(map[string]interface{})["name"] != "Bob updated" {
+		t.Fatalf("unexpected item data %v", item)
+	}
+}
+
+func TestMemoryCollectionHandler_ReplaceItem(t *testing.T) {
+	handler := &MemoryCollectionHandler{
+		collection: createCollection(),
+	}
+	if err := handler.ReplaceItem(context.Background(), "1", map[string]interface{}{
+		"name": "Bob replaced",
+	}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	item, _ := handler.GetItem(context.Background(), "1")
+	if len(item.(map[string]interface{})) != 2 || item.(map[string]interface{})["name"] != "Bob replaced" {
+		t.Fatalf("unexpected item data %v", item)
+	}
+}
+
+func TestMemoryCollectionHandler_ReplaceItem_wrongId(t *testing.T) {
+	handler := &MemoryCollectionHandler{
+		collection: createCollection(),
+	}
+	if err := handler.ReplaceItem(context.Background(), "2", createItem()); err == nil {
+		t.Fatalf("expected error for unexisting id 2")
+	}
+}
+
 func TestMemoryStorage_Initialize(t *testing.T) {
 	storage := NewMemoryStorage()
 	if storage == nil {
@@ -193,4 +383,113 @@ func TestMemoryStorage_GetCollection_NotFound(t *testing.T) {
 	if collection != nil {
 		t.Fatalf("unexpected valid collection")
 	}
-}
\ No newline at end of file
+}
+func TestMemoryCollectionHandler_uniqueFields(t *testing.T) {
+	handler := newMemoryStorageCollectionHandler(collectionData{}, data.CollectionDefinition{
+		Name: "test",
+		Fields: map[string]data.FieldDefinition{
+			"name": {Type: "string", Unique: true},
+		},
+	})
+	id, err := handler.AddItem(context.Background(), map[string]interface{}{"name": "Bob"})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if _, err := handler.AddItem(context.Background(), map[string]interface{}{"name": "Bob"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	otherID, err := handler.AddItem(context.Background(), map[string]interface{}{"lastname": "Howards"})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if err := handler.UpdateItem(context.Background(), otherID, map[string]interface{}{"name": "Bob"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	// the item can keep its own value
+	if err := handler.ReplaceItem(context.Background(), id, map[string]interface{}{"name": "Bob", "age": 20.0}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	// the value is released once the item is deleted
+	if err := handler.DeleteItem(context.Background(), id); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if err := handler.UpdateItem(context.Background(), otherID, map[string]interface{}{"name": "Bob"}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+}
+
+func TestMemoryCollectionHandler_cancelledContext(t *testing.T) {
+	handler := newMemoryStorageCollectionHandler(collectionData{}, data.CollectionDefinition{Name: "test"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := handler.AddItem(ctx, map[string]interface{}{"name": "Bob"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancelled error, got %v", err)
+	}
+	if _, err := handler.Query(ctx, QueryParams{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancelled error, got %v", err)
+	}
+	// cancelled operations are never applied
+	if count, _ := handler.Count(context.Background(), nil); count != 0 {
+		t.Fatalf("unexpected amount of items: %d", count)
+	}
+	// timed out operations are reported as unavailable storage
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := handler.GetItem(ctx, "1"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+}
+
+func TestMemoryStorage_concurrentAccess(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.Initialize(createManifest(t))
+
+	const workers = 20
+	const iterations = 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler, err := storage.GetCollection("test")
+			if err != nil {
+				t.Errorf("unexpected error: " + err.Error())
+				return
+			}
+			for i := 0; i < iterations; i++ {
+				id, err := handler.AddItem(context.Background(), createItem())
+				if err != nil {
+					t.Errorf("unexpected error: " + err.Error())
+					return
+				}
+				if err := handler.UpdateItem(context.Background(), id, map[string]interface{}{"age": float64(i)}); err != nil {
+					t.Errorf("unexpected error: " + err.Error())
+				}
+				if err := handler.ReplaceItem(context.Background(), id, createItem()); err != nil {
+					t.Errorf("unexpected error: " + err.Error())
+				}
+				if _, err := handler.GetItem(context.Background(), id); err != nil {
+					t.Errorf("unexpected error: " + err.Error())
+				}
+				if _, err := handler.Query(context.Background(), QueryParams{Limit: 10, SortBy: []SortField{{Name: "age"}}}); err != nil {
+					t.Errorf("unexpected error: " + err.Error())
+				}
+				if _, err := handler.Count(context.Background(), Filter{{Field: "name", Operator: FilterEqual, Value: "Bob"}}); err != nil {
+					t.Errorf("unexpected error: " + err.Error())
+				}
+				if i%2 == 0 {
+					if err := handler.DeleteItem(context.Background(), id); err != nil {
+						t.Errorf("unexpected error: " + err.Error())
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	handler, _ := storage.GetCollection("test")
+	count, _ := handler.Count(context.Background(), nil)
+	if count != workers*iterations/2 {
+		t.Fatalf("unexpected items count %d", count)
+	}
+}
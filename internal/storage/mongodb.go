@@ -12,12 +12,30 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"monkiato/apio/internal/data"
 	mk_os "monkiato/apio/internal/os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	defaultMongodbHost = "localhost:27017"
 	defaultMongodbName = "apio"
+
+	duplicateKeyErrorCode  = 11000
+	mongoNetworkErrorLabel = "NetworkError"
+	// mongoCountersCollection collection keeping the last ID generated for collections using incremental IDs
+	mongoCountersCollection = "_apio_counters"
+	// mongoTextIndex name of the text index created for the searchable fields, a collection can only have one
+	mongoTextIndex = "text_search"
+	// mongoScoreField field used to obtain the text search score, it's removed from the returned items
+	mongoScoreField = "_apio_score"
+	// index conflict error codes, returned when an index with the same name but different keys or options exists
+	indexOptionsConflictErrorCode  = 85
+	indexKeySpecsConflictErrorCode = 86
+	// mongoPatchAttempts max amount of times a patch is applied when the item is modified concurrently
+	mongoPatchAttempts = 5
 )
 
 //MongoStorage structure for the storage using a MongoDB
@@ -30,6 +48,8 @@ type MongoStorage struct {
 	dbName                    string
 	username                  string
 	password                  string
+	// mutex protects collectionHandlers, lazily populated by GetCollection
+	mutex sync.Mutex
 }
 
 //MongoCollectionHandler  data handler used for a specific collection
@@ -68,107 +88,793 @@ func newMongoStorageCollectionHandler(db *mongo.Database, collection data.Collec
 }
 
 //GetItem implements storage.CollectionHandler.GetItem
-func (msc *MongoCollectionHandler) GetItem(itemID string) (interface{}, bool) {
-	objID, _ := primitive.ObjectIDFromHex(itemID)
+func (msc *MongoCollectionHandler) GetItem(ctx context.Context, itemID string) (interface{}, error) {
+	return msc.GetItemFields(ctx, itemID, Projection{})
+}
+
+//GetItemFields implements storage.CollectionHandler.GetItemFields, the projection is applied by MongoDB
+func (msc *MongoCollectionHandler) GetItemFields(ctx context.Context, itemID string, fields Projection) (interface{}, error) {
+	objID, err := msc.documentID(itemID)
+	if err != nil {
+		return nil, err
+	}
+	// the _id is never fetched, the item ID is already known
+	projection := bson.M{}
+	if !fields.IsEmpty() {
+		projection = createProjection(fields)
+	}
+	projection["_id"] = 0
+
 	// fetch item
 	res := msc.db.Collection(msc.collection.Name).
 		FindOne(
-			createContext(),
+			ctx,
 			bson.M{"_id": objID},
-			options.FindOne().SetProjection(bson.D{{"_id", 0}}))
+			options.FindOne().SetProjection(projection))
 
 	// check fetching errors
+	if res.Err() == mongo.ErrNoDocuments {
+		return nil, notFoundError(itemID)
+	}
 	if res.Err() != nil {
-		fmt.Printf("unable to fetch item id %s. err: %s", itemID, res.Err().Error())
-		return nil, false
+		log.Errorf("unable to fetch item id %s: %s", itemID, res.Err())
+		return nil, toStorageError(res.Err())
 	}
 
 	// decode data
 	var itemBson interface{}
 	if err := res.Decode(&itemBson); err != nil {
-		fmt.Printf("unable to decode DB data for item id %s. err: %s", itemID, err)
-		return nil, false
+		log.Errorf("unable to decode DB data for item id %s: %s", itemID, err)
+		return nil, err
 	}
 
 	// convert bson data to go map
 	var item map[string]interface{}
 	b, _ := bson.Marshal(itemBson)
 	bson.Unmarshal(b, &item)
-	return item, true
+	item = fromBson(item)
+	item[data.IDField] = formatDocumentID(objID)
+	return item, nil
+}
+
+//ValidateID implements storage.CollectionHandler.ValidateID
+func (msc *MongoCollectionHandler) ValidateID(itemID string) error {
+	_, err := msc.documentID(itemID)
+	return err
+}
+
+// documentID get the _id value for the item ID, ObjectIDs are used when the collection doesn't declare an ID strategy
+func (msc *MongoCollectionHandler) documentID(itemID string) (interface{}, error) {
+	if msc.collection.IDStrategy != "" && !msc.collection.IsIDValid(itemID) {
+		return nil, invalidIDError(itemID)
+	}
+	switch msc.collection.IDStrategy {
+	case "", data.IDStrategyObjectID:
+		objID, err := primitive.ObjectIDFromHex(itemID)
+		if err != nil {
+			return nil, invalidIDError(itemID)
+		}
+		return objID, nil
+	case data.IDStrategyIncrement:
+		return strconv.ParseInt(itemID, 10, 64)
+	}
+	return itemID, nil
+}
+
+// nextSequence increments the collection counter used to generate incremental IDs, the amount of IDs reserved is
+// specified by count and the last reserved ID is returned
+func (msc *MongoCollectionHandler) nextSequence(ctx context.Context, count int64) (int64, error) {
+	res := msc.db.Collection(mongoCountersCollection).FindOneAndUpdate(ctx,
+		bson.M{"_id": msc.collection.Name},
+		bson.M{"$inc": bson.M{"seq": count}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	if err := res.Decode(&counter); err != nil {
+		return 0, toStorageError(err)
+	}
+	return counter.Seq, nil
+}
+
+// advanceSequence move the collection counter to the ID used by an item inserted with a specific ID, so
+// incremental IDs generated later never collide with it
+func (msc *MongoCollectionHandler) advanceSequence(ctx context.Context, id interface{}) error {
+	if msc.collection.IDStrategy != data.IDStrategyIncrement {
+		return nil
+	}
+	_, err := msc.db.Collection(mongoCountersCollection).UpdateOne(ctx,
+		bson.M{"_id": msc.collection.Name},
+		bson.M{"$max": bson.M{"seq": id}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return toStorageError(err)
+	}
+	return nil
 }
 
 //AddItem implements storage.CollectionHandler.AddItem
-func (msc *MongoCollectionHandler) AddItem(item map[string]interface{}) (string, error) {
-	res, err := msc.db.Collection(msc.collection.Name).InsertOne(createContext(), item)
+func (msc *MongoCollectionHandler) AddItem(ctx context.Context, item map[string]interface{}) (string, error) {
+	switch msc.collection.IDStrategy {
+	case data.IDStrategyClient:
+		return "", missingClientIDError()
+	case data.IDStrategyUUID:
+		id := data.NewUUID()
+		return id, msc.InsertItem(ctx, id, item)
+	case data.IDStrategyIncrement:
+		seq, err := msc.nextSequence(ctx, 1)
+		if err != nil {
+			return "", err
+		}
+		id := strconv.FormatInt(seq, 10)
+		return id, msc.InsertItem(ctx, id, item)
+	}
+	res, err := msc.db.Collection(msc.collection.Name).InsertOne(ctx, item)
 	if err != nil {
-		fmt.Printf("unable to add new item. err: " + err.Error())
-		return "", err
+		log.Errorf("unable to add new item: %s", err)
+		return "", toStorageError(err)
 	}
 	id := res.InsertedID.(primitive.ObjectID).Hex()
 	log.Debugf("created new item %s.%s", msc.collection.Name, id)
 	return id, nil
 }
 
+//InsertItem implements storage.CollectionHandler.InsertItem
+func (msc *MongoCollectionHandler) InsertItem(ctx context.Context, itemID string, item map[string]interface{}) error {
+	objID, err := msc.documentID(itemID)
+	if err != nil {
+		return err
+	}
+	if err := msc.advanceSequence(ctx, objID); err != nil {
+		return err
+	}
+	document := map[string]interface{}{"_id": objID}
+	for key, value := range item {
+		document[key] = value
+	}
+	if _, err := msc.db.Collection(msc.collection.Name).InsertOne(ctx, document); err != nil {
+		log.Errorf("unable to insert item: %s", err)
+		if isDuplicatedIDError(err) {
+			return existingItemError(itemID)
+		}
+		return toStorageError(err)
+	}
+	log.Debugf("created new item %s.%s", msc.collection.Name, itemID)
+	return nil
+}
+
+//UpsertItem implements storage.CollectionHandler.UpsertItem
+func (msc *MongoCollectionHandler) UpsertItem(ctx context.Context, itemID string, item map[string]interface{}) (bool, error) {
+	objID, err := msc.documentID(itemID)
+	if err != nil {
+		return false, err
+	}
+	if err := msc.advanceSequence(ctx, objID); err != nil {
+		return false, err
+	}
+	res, err := msc.db.Collection(msc.collection.Name).ReplaceOne(ctx, bson.M{"_id": objID}, item, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Errorf("unable to upsert item: %s", err)
+		return false, toStorageError(err)
+	}
+	log.Debugf("upserted item %s.%s", msc.collection.Name, itemID)
+	return res.UpsertedCount > 0, nil
+}
+
 //UpdateItem implements storage.CollectionHandler.UpdateItem
-func (msc *MongoCollectionHandler) UpdateItem(itemID string, newItem map[string]interface{}) error {
-	objID, _ := primitive.ObjectIDFromHex(itemID)
-	_, err := msc.db.Collection(msc.collection.Name).UpdateOne(createContext(), bson.D{{"_id", objID}}, bson.D{{"$set", newItem}})
+func (msc *MongoCollectionHandler) UpdateItem(ctx context.Context, itemID string, newItem map[string]interface{}) error {
+	objID, err := msc.documentID(itemID)
 	if err != nil {
-		fmt.Printf("unable to update item. err: " + err.Error())
 		return err
 	}
+	res, err := msc.db.Collection(msc.collection.Name).UpdateOne(ctx, bson.D{{Key: "_id", Value: objID}}, bson.D{{Key: "$set", Value: newItem}})
+	if err != nil {
+		log.Errorf("unable to update item: %s", err)
+		return toStorageError(err)
+	}
+	if res.MatchedCount == 0 {
+		return notFoundError(itemID)
+	}
 	log.Debugf("updated item %s.%s", msc.collection.Name, itemID)
 	return nil
 }
 
+//ReplaceItem implements storage.CollectionHandler.ReplaceItem
+func (msc *MongoCollectionHandler) ReplaceItem(ctx context.Context, itemID string, newItem map[string]interface{}) error {
+	objID, err := msc.documentID(itemID)
+	if err != nil {
+		return err
+	}
+	res, err := msc.db.Collection(msc.collection.Name).ReplaceOne(ctx, bson.M{"_id": objID}, newItem)
+	if err != nil {
+		log.Errorf("unable to replace item: %s", err)
+		return toStorageError(err)
+	}
+	if res.MatchedCount == 0 {
+		return notFoundError(itemID)
+	}
+	log.Debugf("replaced item %s.%s", msc.collection.Name, itemID)
+	return nil
+}
+
+//PatchItem implements storage.CollectionHandler.PatchItem, the item is only replaced if it wasn't modified since it
+//was read, otherwise the patch is applied again over the new content. ErrConflict is returned when the item keeps
+//being modified
+func (msc *MongoCollectionHandler) PatchItem(ctx context.Context, itemID string, patch ItemPatch) error {
+	objID, err := msc.documentID(itemID)
+	if err != nil {
+		return err
+	}
+	collection := msc.db.Collection(msc.collection.Name)
+	for attempt := 0; attempt < mongoPatchAttempts; attempt++ {
+		raw, err := collection.FindOne(ctx, bson.M{"_id": objID}).DecodeBytes()
+		if err == mongo.ErrNoDocuments {
+			return notFoundError(itemID)
+		}
+		if err != nil {
+			log.Errorf("unable to fetch item id %s. err: %s", itemID, err)
+			return toStorageError(err)
+		}
+		var item map[string]interface{}
+		if err := bson.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		delete(item, "_id")
+		item = fromBson(item)
+		item[data.IDField] = formatDocumentID(objID)
+		newItem, err := patch(item)
+		if err != nil {
+			return err
+		}
+
+		// the whole document is compared, so any change made after it was read prevents the replacement
+		unchanged := bson.M{"_id": objID, "$expr": bson.M{"$eq": bson.A{"$$ROOT", bson.M{"$literal": raw}}}}
+		res, err := collection.ReplaceOne(ctx, unchanged, newItem)
+		if err != nil {
+			log.Errorf("unable to patch item id %s. err: %s", itemID, err)
+			return toStorageError(err)
+		}
+		if res.MatchedCount > 0 {
+			log.Debugf("patched item %s.%s", msc.collection.Name, itemID)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: item %s is being modified concurrently", ErrConflict, itemID)
+}
+
 //DeleteItem implements storage.CollectionHandler.DeleteItem
-func (msc *MongoCollectionHandler) DeleteItem(itemID string) error {
-	objID, _ := primitive.ObjectIDFromHex(itemID)
-	_, err := msc.db.Collection(msc.collection.Name).DeleteOne(createContext(), bson.M{"_id": objID})
+func (msc *MongoCollectionHandler) DeleteItem(ctx context.Context, itemID string) error {
+	objID, err := msc.documentID(itemID)
 	if err != nil {
-		fmt.Printf("unable to delete item. err: " + err.Error())
 		return err
 	}
+	res, err := msc.db.Collection(msc.collection.Name).DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		log.Errorf("unable to delete item: %s", err)
+		return toStorageError(err)
+	}
+	if res.DeletedCount == 0 {
+		return notFoundError(itemID)
+	}
 	log.Debugf("deleted item %s.%s", msc.collection.Name, itemID)
 	return nil
 }
 
-//Query implements storage.CollectionHandler.Query
-func (msc *MongoCollectionHandler) Query(query QueryParams) ([]interface{}, error) {
-	ctx := createContext()
-	cursor, err := msc.db.Collection(msc.collection.Name).Find(
-		ctx,
-		bson.M{},
-		options.Find().SetSkip(query.Skip).SetLimit(query.Limit),
-	)
+//UpdateMany implements storage.CollectionHandler.UpdateMany. Unique fields can only be set when a single item matches,
+//so the update is rejected before writing anything instead of failing after some items are updated
+func (msc *MongoCollectionHandler) UpdateMany(ctx context.Context, filter Filter, item map[string]interface{}) (int64, error) {
+	if len(item) == 0 {
+		return msc.Count(ctx, filter)
+	}
+	collection := msc.db.Collection(msc.collection.Name)
+	for _, name := range msc.collection.UniqueFields() {
+		if _, exists := item[name]; !exists {
+			continue
+		}
+		matched, err := collection.CountDocuments(ctx, createFilter(filter), options.Count().SetLimit(2))
+		if err != nil {
+			return 0, toStorageError(err)
+		}
+		if matched > 1 {
+			return 0, fmt.Errorf("%w: duplicated value for unique field '%s'", ErrConflict, name)
+		}
+		// a single item is updated even if other items match the filter after counting them
+		res, err := collection.UpdateOne(ctx, createFilter(filter), bson.M{"$set": item})
+		if err != nil {
+			return 0, toStorageError(err)
+		}
+		log.Debugf("updated %d items %s", res.MatchedCount, msc.collection.Name)
+		return res.MatchedCount, nil
+	}
+	res, err := collection.UpdateMany(ctx, createFilter(filter), bson.M{"$set": item})
+	if err != nil {
+		log.Errorf("unable to update items: %s", err)
+		return 0, toStorageError(err)
+	}
+	log.Debugf("updated %d items %s", res.MatchedCount, msc.collection.Name)
+	return res.MatchedCount, nil
+}
+
+//DeleteMany implements storage.CollectionHandler.DeleteMany
+func (msc *MongoCollectionHandler) DeleteMany(ctx context.Context, filter Filter) (int64, error) {
+	res, err := msc.db.Collection(msc.collection.Name).DeleteMany(ctx, createFilter(filter))
+	if err != nil {
+		log.Errorf("unable to delete items: %s", err)
+		return 0, toStorageError(err)
+	}
+	log.Debugf("deleted %d items %s", res.DeletedCount, msc.collection.Name)
+	return res.DeletedCount, nil
+}
+
+//BulkWrite implements storage.CollectionHandler.BulkWrite, the operations are sent in a single unordered bulk write.
+//Missing items are detected before the write, since bulk write results only include the total amount of matched items
+func (msc *MongoCollectionHandler) BulkWrite(ctx context.Context, operations []BulkOperation) ([]BulkResult, error) {
+	results := make([]BulkResult, len(operations))
+	documentIDs := make([]interface{}, len(operations))
+	var generated []int
+	var existing []interface{}
+	var maxID int64
+	for i, operation := range operations {
+		results[i] = BulkResult{ID: operation.ID}
+		switch {
+		case operation.Type != BulkCreate && operation.Type != BulkUpdate && operation.Type != BulkDelete:
+			results[i].Err = unknownBulkOperationError(operation.Type)
+		case operation.Type == BulkCreate && operation.ID == "":
+			generated = append(generated, i)
+		default:
+			documentIDs[i], results[i].Err = msc.documentID(operation.ID)
+			if results[i].Err != nil {
+				continue
+			}
+			if operation.Type != BulkCreate {
+				existing = append(existing, documentIDs[i])
+			} else if id, ok := documentIDs[i].(int64); ok && id > maxID {
+				maxID = id
+			}
+		}
+	}
+	if err := msc.generateDocumentIDs(ctx, generated, documentIDs, results); err != nil {
+		return nil, err
+	}
+	if maxID > 0 {
+		if err := msc.advanceSequence(ctx, maxID); err != nil {
+			return nil, err
+		}
+	}
+	found, err := msc.existingDocumentIDs(ctx, existing)
 	if err != nil {
 		return nil, err
 	}
 
-	var results []interface{}
+	var models []mongo.WriteModel
+	// operation index for each write model
+	var modelOperations []int
+	for i, operation := range operations {
+		if results[i].Err != nil {
+			continue
+		}
+		filter := bson.M{"_id": documentIDs[i]}
+		if operation.Type != BulkCreate && !found[formatDocumentID(documentIDs[i])] {
+			results[i].Err = notFoundError(operation.ID)
+			continue
+		}
+		switch operation.Type {
+		case BulkCreate:
+			document := map[string]interface{}{"_id": documentIDs[i]}
+			for key, value := range operation.Item {
+				document[key] = value
+			}
+			models = append(models, mongo.NewInsertOneModel().SetDocument(document))
+		case BulkUpdate:
+			models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.M{"$set": operation.Item}))
+		case BulkDelete:
+			models = append(models, mongo.NewDeleteOneModel().SetFilter(filter))
+		}
+		modelOperations = append(modelOperations, i)
+	}
+	if len(models) == 0 {
+		return results, nil
+	}
+
+	_, err = msc.db.Collection(msc.collection.Name).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if bulkException, ok := err.(mongo.BulkWriteException); ok && bulkException.WriteConcernError == nil {
+		for _, writeError := range bulkException.WriteErrors {
+			i := modelOperations[writeError.Index]
+			results[i].Err = toBulkStorageError(writeError.WriteError, results[i].ID)
+		}
+	} else if err != nil {
+		log.Errorf("unable to execute bulk write: %s", err)
+		return nil, toStorageError(err)
+	}
+	log.Debugf("executed %d bulk operations for %s", len(models), msc.collection.Name)
+	return results, nil
+}
+
+// generateDocumentIDs set the _id for the create operations without ID, specified by their index. Incremental IDs
+// are reserved with a single counter update
+func (msc *MongoCollectionHandler) generateDocumentIDs(ctx context.Context, indexes []int, documentIDs []interface{}, results []BulkResult) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	var lastSeq int64
+	if msc.collection.IDStrategy == data.IDStrategyIncrement {
+		var err error
+		if lastSeq, err = msc.nextSequence(ctx, int64(len(indexes))); err != nil {
+			return err
+		}
+	}
+	for n, i := range indexes {
+		switch msc.collection.IDStrategy {
+		case data.IDStrategyClient:
+			results[i].Err = missingClientIDError()
+			continue
+		case data.IDStrategyUUID:
+			documentIDs[i] = data.NewUUID()
+		case data.IDStrategyIncrement:
+			documentIDs[i] = lastSeq - int64(len(indexes)-1-n)
+		default:
+			documentIDs[i] = primitive.NewObjectID()
+		}
+		results[i].ID = formatDocumentID(documentIDs[i])
+	}
+	return nil
+}
+
+// existingDocumentIDs find which of the specified _id values are used, the result is indexed by formatted ID
+func (msc *MongoCollectionHandler) existingDocumentIDs(ctx context.Context, documentIDs []interface{}) (map[string]bool, error) {
+	found := map[string]bool{}
+	if len(documentIDs) == 0 {
+		return found, nil
+	}
+	cursor, err := msc.db.Collection(msc.collection.Name).Find(ctx,
+		bson.M{"_id": bson.M{"$in": documentIDs}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var document struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.Decode(&document); err != nil {
+			return nil, err
+		}
+		found[formatDocumentID(document.ID)] = true
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, toStorageError(err)
+	}
+	return found, nil
+}
+
+//Query implements storage.CollectionHandler.Query
+func (msc *MongoCollectionHandler) Query(ctx context.Context, query QueryParams) (QueryResult, error) {
+	filter := createFilter(query.Filter)
+	if query.After != nil {
+		cursorID, err := msc.documentID(query.After.ID)
+		if err != nil {
+			return QueryResult{}, invalidCursorError(query.After.ID)
+		}
+		cursorFilter := createCursorFilter(cursorID, query.After, query.SortBy)
+		filter = bson.M{"$and": bson.A{filter, cursorFilter}}
+	}
+
+	findOptions := options.Find().SetSkip(query.Skip).SetSort(createSort(query.SortBy))
+	// sort fields are always fetched to build the cursor, they are removed later if they were not requested. The
+	// projection is empty when every excluded field is a sort field, whole documents are fetched in that case
+	if projection := query.Fields.withSortFields(query.SortBy); !projection.IsEmpty() {
+		findOptions.SetProjection(createProjection(projection))
+	}
+	if query.Limit > 0 {
+		// fetch an extra item to know if there are more items after the last one
+		findOptions.SetLimit(query.Limit + 1)
+	}
+	cursor, err := msc.db.Collection(msc.collection.Name).Find(ctx, filter, findOptions)
+	if err != nil {
+		return QueryResult{}, toStorageError(err)
+	}
+	defer cursor.Close(ctx)
+
+	result := QueryResult{}
+	var lastID interface{}
+	var lastItem map[string]interface{}
 
 	for cursor.Next(ctx) {
 		// decode data
 		var itemBson interface{}
 		if err := cursor.Decode(&itemBson); err != nil {
-			fmt.Printf("unable to decode DB data for query results. err: %s", err)
-			return nil, err
+			log.Errorf("unable to decode DB data for query results: %s", err)
+			return QueryResult{}, err
 		}
 
 		// convert bson data to go map
 		var item map[string]interface{}
 		b, _ := bson.Marshal(itemBson)
 		bson.Unmarshal(b, &item)
+		item = fromBson(item)
+		// _id is returned as the canonical ID, the same way GetItem does
+		id := item["_id"]
+		delete(item, "_id")
+		item[data.IDField] = formatDocumentID(id)
 
-		results = append(results, item)
+		if query.Limit > 0 && query.Limit == int64(len(result.Items)) {
+			result.Next = NewCursor(query.SortBy, formatDocumentID(lastID), lastItem)
+			break
+		}
+		result.Items = append(result.Items, query.Fields.Apply(item))
+		lastID, lastItem = id, item
+	}
+	// a cancelled context stops the iteration, so partial results are never returned as complete
+	if err := cursor.Err(); err != nil {
+		return QueryResult{}, toStorageError(err)
 	}
 
+	return result, nil
+}
+
+//Search implements storage.CollectionHandler.Search, using the text index created for the searchable fields
+func (msc *MongoCollectionHandler) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	filter := bson.M{"$and": bson.A{
+		bson.M{"$text": bson.M{"$search": query.Text}},
+		createFilter(query.Filter),
+	}}
+	score := bson.M{"$meta": "textScore"}
+	findOptions := options.Find().
+		SetProjection(bson.M{mongoScoreField: score}).
+		SetSort(bson.D{{Key: mongoScoreField, Value: score}, {Key: "_id", Value: 1}}).
+		SetSkip(query.Skip)
+	if query.Limit > 0 {
+		findOptions.SetLimit(query.Limit)
+	}
+	cursor, err := msc.db.Collection(msc.collection.Name).Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []SearchResult
+	for cursor.Next(ctx) {
+		// decode data
+		var itemBson interface{}
+		if err := cursor.Decode(&itemBson); err != nil {
+			return nil, err
+		}
+
+		// convert bson data to go map
+		var item map[string]interface{}
+		b, _ := bson.Marshal(itemBson)
+		bson.Unmarshal(b, &item)
+		item = fromBson(item)
+		itemScore, _ := item[mongoScoreField].(float64)
+		delete(item, mongoScoreField)
+		item[data.IDField] = formatDocumentID(item["_id"])
+		delete(item, "_id")
+		results = append(results, SearchResult{Item: item, Score: itemScore})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, toStorageError(err)
+	}
 	return results, nil
 }
 
+//Aggregate implements storage.CollectionHandler.Aggregate using an aggregation pipeline. Field paths can't be used as
+//names in the pipeline documents, so group keys and accumulators are named by their position in the query
+func (msc *MongoCollectionHandler) Aggregate(ctx context.Context, query AggregateQuery) ([]AggregateGroup, error) {
+	var groupKey interface{}
+	if len(query.GroupBy) > 0 {
+		key := bson.D{}
+		for i, field := range query.GroupBy {
+			// missing fields are grouped with null values, the same way the memory storage does
+			key = append(key, bson.E{Key: fmt.Sprintf("k%d", i), Value: bson.M{"$ifNull": bson.A{"$" + field, nil}}})
+		}
+		groupKey = key
+	}
+	group := bson.M{
+		"_id":   groupKey,
+		"count": bson.M{"$sum": 1},
+	}
+	accumulators := []struct {
+		operator string
+		fields   []string
+	}{
+		{"sum", query.Sum},
+		{"avg", query.Avg},
+		{"min", query.Min},
+		{"max", query.Max},
+	}
+	for _, accumulator := range accumulators {
+		for i, field := range accumulator.fields {
+			group[fmt.Sprintf("%s%d", accumulator.operator, i)] = bson.M{"$" + accumulator.operator: "$" + field}
+		}
+	}
+	pipeline := bson.A{
+		bson.M{"$match": createFilter(query.Filter)},
+		bson.M{"$group": group},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	}
+	cursor, err := msc.db.Collection(msc.collection.Name).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, toStorageError(err)
+	}
+	defer cursor.Close(ctx)
+
+	groups := []AggregateGroup{}
+	for cursor.Next(ctx) {
+		// decode data
+		var resultBson interface{}
+		if err := cursor.Decode(&resultBson); err != nil {
+			return nil, err
+		}
+
+		// convert bson data to go map
+		var result map[string]interface{}
+		b, _ := bson.Marshal(resultBson)
+		bson.Unmarshal(b, &result)
+		result = fromBson(result)
+
+		// counts are returned as int32 or int64 depending on their size
+		aggregateGroup := newAggregateGroup(query, int64(toFloat(result["count"])))
+		key, _ := result["_id"].(map[string]interface{})
+		for i, field := range query.GroupBy {
+			aggregateGroup.Key[field] = key[fmt.Sprintf("k%d", i)]
+		}
+		for i, field := range query.Sum {
+			aggregateGroup.Sum[field] = typedSum(msc.collection, field, result[fmt.Sprintf("sum%d", i)])
+		}
+		for i, field := range query.Avg {
+			if avg := result[fmt.Sprintf("avg%d", i)]; avg != nil {
+				aggregateGroup.Avg[field] = toFloat(avg)
+			} else {
+				aggregateGroup.Avg[field] = nil
+			}
+		}
+		for i, field := range query.Min {
+			aggregateGroup.Min[field] = result[fmt.Sprintf("min%d", i)]
+		}
+		for i, field := range query.Max {
+			aggregateGroup.Max[field] = result[fmt.Sprintf("max%d", i)]
+		}
+		groups = append(groups, aggregateGroup)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, toStorageError(err)
+	}
+	return groups, nil
+}
+
+//Count implements storage.CollectionHandler.Count
+func (msc *MongoCollectionHandler) Count(ctx context.Context, filter Filter) (int64, error) {
+	count, err := msc.db.Collection(msc.collection.Name).CountDocuments(ctx, createFilter(filter))
+	if err != nil {
+		return 0, toStorageError(err)
+	}
+	return count, nil
+}
+
+// fromBson converts the decoded bson types into the plain go types used by the rest of storages, e.g. dates
+// are converted into time.Time and nested arrays into []interface{}
+func fromBson(item map[string]interface{}) map[string]interface{} {
+	for key, value := range item {
+		item[key] = fromBsonValue(value)
+	}
+	return item
+}
+
+func fromBsonValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return fromBson(typed)
+	case primitive.M:
+		return fromBson(typed)
+	case primitive.D:
+		return fromBson(typed.Map())
+	case primitive.A:
+		return fromBsonValue([]interface{}(typed))
+	case []interface{}:
+		for i, element := range typed {
+			typed[i] = fromBsonValue(element)
+		}
+		return typed
+	case primitive.DateTime:
+		return time.Unix(0, int64(typed)*int64(time.Millisecond)).UTC()
+	}
+	return value
+}
+
+// createFilter converts the filter conditions into a MongoDB query document
+func createFilter(filter Filter) bson.M {
+	if len(filter) == 0 {
+		return bson.M{}
+	}
+	conditions := bson.A{}
+	for _, condition := range filter {
+		var expression interface{}
+		switch condition.Operator {
+		case FilterContains:
+			expression = bson.M{
+				"$regex":   regexp.QuoteMeta(fmt.Sprint(condition.Value)),
+				"$options": "i",
+			}
+		default:
+			expression = bson.M{"$" + string(condition.Operator): condition.Value}
+		}
+		conditions = append(conditions, bson.M{condition.Field: expression})
+	}
+	return bson.M{"$and": conditions}
+}
+
+// createCursorFilter creates a query document matching only the items placed after the cursor position for
+// the sorting criteria. For sort fields [a, b] the result is equivalent to:
+// a > cursor.a OR (a == cursor.a AND b > cursor.b) OR (a == cursor.a AND b == cursor.b AND _id > cursor.id)
+// using lower than comparisons for descending fields. Null values are always placed first in ascending order
+func createCursorFilter(cursorID interface{}, cursor *Cursor, sortBy []SortField) bson.M {
+	alternatives := bson.A{}
+	previousEquals := bson.A{}
+	for i, sortField := range sortBy {
+		value := cursor.Values[i]
+		var after bson.M
+		switch {
+		case value == nil && !sortField.Descending:
+			after = bson.M{sortField.Name: bson.M{"$ne": nil}}
+		case value == nil && sortField.Descending:
+			// nothing is placed after null values in descending order
+			after = nil
+		case sortField.Descending:
+			after = bson.M{"$or": bson.A{
+				bson.M{sortField.Name: bson.M{"$lt": value}},
+				bson.M{sortField.Name: nil},
+			}}
+		default:
+			after = bson.M{sortField.Name: bson.M{"$gt": value}}
+		}
+		if after != nil {
+			alternatives = append(alternatives, bson.M{"$and": append(append(bson.A{}, previousEquals...), after)})
+		}
+		previousEquals = append(previousEquals, bson.M{sortField.Name: value})
+	}
+	after := bson.M{"_id": bson.M{"$gt": cursorID}}
+	alternatives = append(alternatives, bson.M{"$and": append(previousEquals, after)})
+	return bson.M{"$or": alternatives}
+}
+
+// createSort converts the sorting criteria into a MongoDB sort document, '_id' is always added as the last
+// criteria so the order is deterministic for items with the same values
+func createSort(sortBy []SortField) bson.D {
+	sort := bson.D{}
+	for _, sortField := range sortBy {
+		direction := 1
+		if sortField.Descending {
+			direction = -1
+		}
+		sort = append(sort, bson.E{Key: sortField.Name, Value: direction})
+	}
+	return append(sort, bson.E{Key: "_id", Value: 1})
+}
+
+// createProjection converts the projection into a MongoDB projection document. Item IDs are stored in '_id', which
+// is returned by default, so it's only declared when fields are included, in case only the ID is requested
+func createProjection(projection Projection) bson.M {
+	value := 1
+	if projection.Exclude {
+		value = 0
+	}
+	document := bson.M{}
+	for _, field := range projection.Fields {
+		if field != data.IDField {
+			document[field] = value
+		}
+	}
+	if !projection.Exclude {
+		document["_id"] = 1
+	}
+	return document
+}
+
 //Initialize implements storage.Storage.Initialize
 func (ms *MongoStorage) Initialize(manifest string) {
-	ctx := createContext()
+	ctx, cancel := createContext()
+	defer cancel()
 	uri := fmt.Sprintf("mongodb://%s", ms.host)
 
 	log.Debugf("connecting to mongoDB: %s", uri)
@@ -192,9 +898,10 @@ func (ms *MongoStorage) Initialize(manifest string) {
 	ms.initializeCollections()
 }
 
-func createContext() context.Context {
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	return ctx
+// createContext used for connection and initialization tasks, collection operations use the context provided by
+// the caller instead
+func createContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 5*time.Second)
 }
 
 //GetCollectionDefinitions implements storage.Storage.GetCollectionDefinitions
@@ -204,6 +911,8 @@ func (ms *MongoStorage) GetCollectionDefinitions() []data.CollectionDefinition {
 
 //GetCollection implements storage.Storage.GetCollection
 func (ms *MongoStorage) GetCollection(collectionName string) (CollectionHandler, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
 	if collection, ok := ms.collectionsDefinitionsMap[collectionName]; ok {
 		collectionHandler, exists := ms.collectionHandlers[collectionName]
 		if !exists {
@@ -227,5 +936,110 @@ func (ms *MongoStorage) initializeCollectionDefinitions(manifest string) {
 func (ms *MongoStorage) initializeCollections() {
 	for _, collectionDefinition := range ms.collectionsDefinitions {
 		ms.collectionsDefinitionsMap[collectionDefinition.Name] = collectionDefinition
+		ms.createUniqueIndexes(collectionDefinition)
+		ms.createTextIndex(collectionDefinition)
+	}
+}
+
+// createTextIndex create the text index used by the full text search over the searchable fields. The index is
+// replaced when the searchable fields declared in the manifest are changed
+func (ms *MongoStorage) createTextIndex(collectionDefinition data.CollectionDefinition) {
+	searchableFields := collectionDefinition.SearchableFields()
+	if len(searchableFields) == 0 {
+		return
+	}
+	keys := bson.D{}
+	for _, name := range searchableFields {
+		keys = append(keys, bson.E{Key: name, Value: "text"})
+	}
+	index := mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetName(mongoTextIndex),
+	}
+	ctx, cancel := createContext()
+	defer cancel()
+	indexes := ms.client.Database(ms.dbName).Collection(collectionDefinition.Name).Indexes()
+	_, err := indexes.CreateOne(ctx, index)
+	if commandError, ok := err.(mongo.CommandError); ok &&
+		(commandError.Code == indexOptionsConflictErrorCode || commandError.Code == indexKeySpecsConflictErrorCode) {
+		log.Infof("replacing text index for collection %s", collectionDefinition.Name)
+		if _, err = indexes.DropOne(ctx, mongoTextIndex); err == nil {
+			_, err = indexes.CreateOne(ctx, index)
+		}
+	}
+	if err != nil {
+		log.Fatalf("unable to create text index for collection %s. err: %s", collectionDefinition.Name, err.Error())
+	}
+	log.Debugf("text index ready for collection %s", collectionDefinition.Name)
+}
+
+// createUniqueIndexes create a unique index for each unique field. Indexes are sparse, so items without the field
+// are allowed
+func (ms *MongoStorage) createUniqueIndexes(collectionDefinition data.CollectionDefinition) {
+	uniqueFields := collectionDefinition.UniqueFields()
+	if len(uniqueFields) == 0 {
+		return
+	}
+	indexes := make([]mongo.IndexModel, len(uniqueFields))
+	for i, name := range uniqueFields {
+		indexes[i] = mongo.IndexModel{
+			Keys:    bson.D{{Key: name, Value: 1}},
+			Options: options.Index().SetName("unique_" + name).SetUnique(true).SetSparse(true),
+		}
+	}
+	ctx, cancel := createContext()
+	defer cancel()
+	if _, err := ms.client.Database(ms.dbName).Collection(collectionDefinition.Name).Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Fatalf("unable to create unique indexes for collection %s. err: %s", collectionDefinition.Name, err.Error())
+	}
+	log.Debugf("unique indexes ready for collection %s", collectionDefinition.Name)
+}
+
+// formatDocumentID item ID for the _id value, the hex representation is used for ObjectIDs
+func formatDocumentID(id interface{}) string {
+	if objID, ok := id.(primitive.ObjectID); ok {
+		return objID.Hex()
+	}
+	return fmt.Sprint(id)
+}
+
+// toBulkStorageError storage error for a single failed operation of a bulk write
+func toBulkStorageError(writeError mongo.WriteError, itemID string) error {
+	if writeError.Code == duplicateKeyErrorCode {
+		if strings.Contains(writeError.Message, "index: _id_") {
+			return existingItemError(itemID)
+		}
+		return fmt.Errorf("%w: duplicated value for unique field", ErrConflict)
+	}
+	return writeError
+}
+
+// isDuplicatedIDError true when the write failed because the _id is already used
+func isDuplicatedIDError(err error) bool {
+	if writeException, ok := err.(mongo.WriteException); ok {
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == duplicateKeyErrorCode && strings.Contains(writeError.Message, "index: _id_") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toStorageError wraps duplicated key errors with ErrConflict, and connection errors and timeouts with ErrUnavailable
+func toStorageError(err error) error {
+	if writeException, ok := err.(mongo.WriteException); ok {
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == duplicateKeyErrorCode {
+				return fmt.Errorf("%w: duplicated value for unique field", ErrConflict)
+			}
+		}
+	}
+	if commandError, ok := err.(mongo.CommandError); ok && commandError.HasErrorLabel(mongoNetworkErrorLabel) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	if err == mongo.ErrClientDisconnected {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
 	}
+	return contextError(err)
 }
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFromBson(t *testing.T) {
+	date := time.Date(2020, 5, 1, 10, 30, 0, 0, time.UTC)
+	encoded, _ := bson.Marshal(map[string]interface{}{
+		"title":     "The Hobbit",
+		"published": date,
+		"pages":     int64(310),
+		"tags":      []interface{}{"fantasy", "classic"},
+		"address": map[string]interface{}{
+			"zip":     "1234",
+			"updated": date,
+		},
+		"authors": []interface{}{
+			map[string]interface{}{"name": "Tolkien"},
+		},
+	})
+	var item map[string]interface{}
+	bson.Unmarshal(encoded, &item)
+
+	expected := map[string]interface{}{
+		"title":     "The Hobbit",
+		"published": date,
+		"pages":     int64(310),
+		"tags":      []interface{}{"fantasy", "classic"},
+		"address": map[string]interface{}{
+			"zip":     "1234",
+			"updated": date,
+		},
+		"authors": []interface{}{
+			map[string]interface{}{"name": "Tolkien"},
+		},
+	}
+	if result := fromBson(item); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("unexpected converted item %#v", result)
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"monkiato/apio/internal/data"
+	"strings"
+)
+
+// Projection fields included in the items returned by a query, or excluded from them when Exclude is set. Fields can
+// be dot separated paths for nested objects, and they must not overlap, e.g. "address" and "address.zip".
+// Items always include their ID, and every field is returned when the projection is empty
+type Projection struct {
+	Fields  []string
+	Exclude bool
+}
+
+// projectionTree fields included or excluded by a projection, organized by path segments. Leaves are whole fields
+type projectionTree map[string]projectionTree
+
+// IsEmpty check if the projection returns the whole items
+func (p Projection) IsEmpty() bool {
+	return len(p.Fields) == 0
+}
+
+// Apply get a copy of the item with the projected fields, the item is returned as it is when the projection is empty.
+// Arrays of objects are projected element by element, the same way MongoDB does
+func (p Projection) Apply(item map[string]interface{}) map[string]interface{} {
+	if p.IsEmpty() {
+		return item
+	}
+	tree := p.tree()
+	if p.Exclude {
+		return excludeFields(item, tree)
+	}
+	projected := includeFields(item, tree)
+	if id, exists := item[data.IDField]; exists {
+		projected[data.IDField] = id
+	}
+	return projected
+}
+
+// withSortFields projection also returning the fields used to sort a query, required to build the query cursor.
+// Sort fields not requested by the client must be removed from the results afterwards applying the original projection
+func (p Projection) withSortFields(sortBy []SortField) Projection {
+	if p.IsEmpty() {
+		return p
+	}
+	fields := append([]string{}, p.Fields...)
+	for _, sortField := range sortBy {
+		if p.Exclude {
+			fields = removeOverlappingPaths(fields, sortField.Name)
+			continue
+		}
+		if !containsPathPrefix(fields, sortField.Name) {
+			fields = append(removeOverlappingPaths(fields, sortField.Name), sortField.Name)
+		}
+	}
+	if p.Exclude && len(fields) == 0 {
+		// every excluded field is needed by the cursor
+		return Projection{}
+	}
+	return Projection{Fields: fields, Exclude: p.Exclude}
+}
+
+func (p Projection) tree() projectionTree {
+	tree := projectionTree{}
+	for _, field := range p.Fields {
+		node := tree
+		for _, segment := range strings.Split(field, ".") {
+			if node[segment] == nil {
+				node[segment] = projectionTree{}
+			}
+			node = node[segment]
+		}
+	}
+	return tree
+}
+
+func includeFields(item map[string]interface{}, tree projectionTree) map[string]interface{} {
+	projected := map[string]interface{}{}
+	for name, children := range tree {
+		value, exists := item[name]
+		if !exists {
+			continue
+		}
+		if len(children) == 0 {
+			projected[name] = value
+			continue
+		}
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			projected[name] = includeFields(typed, children)
+		case []interface{}:
+			// only object elements contain nested fields
+			elements := []interface{}{}
+			for _, element := range typed {
+				if object, ok := element.(map[string]interface{}); ok {
+					elements = append(elements, includeFields(object, children))
+				}
+			}
+			projected[name] = elements
+		}
+	}
+	return projected
+}
+
+func excludeFields(item map[string]interface{}, tree projectionTree) map[string]interface{} {
+	projected := make(map[string]interface{}, len(item))
+	for name, value := range item {
+		children, found := tree[name]
+		if !found {
+			projected[name] = value
+			continue
+		}
+		if len(children) == 0 {
+			continue
+		}
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			projected[name] = excludeFields(typed, children)
+		case []interface{}:
+			elements := make([]interface{}, len(typed))
+			for i, element := range typed {
+				if object, ok := element.(map[string]interface{}); ok {
+					elements[i] = excludeFields(object, children)
+				} else {
+					elements[i] = element
+				}
+			}
+			projected[name] = elements
+		default:
+			projected[name] = value
+		}
+	}
+	return projected
+}
+
+// containsPathPrefix check if any of the paths is the specified path or one of its parents
+func containsPathPrefix(paths []string, path string) bool {
+	for _, candidate := range paths {
+		if candidate == path || strings.HasPrefix(path, candidate+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// removeOverlappingPaths remove the paths equal to the specified path, its parents and its nested fields
+func removeOverlappingPaths(paths []string, path string) []string {
+	var kept []string
+	for _, candidate := range paths {
+		if candidate == path || strings.HasPrefix(path, candidate+".") || strings.HasPrefix(candidate, path+".") {
+			continue
+		}
+		kept = append(kept, candidate)
+	}
+	return kept
+}
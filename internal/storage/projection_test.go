@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProjection_Apply(t *testing.T) {
+	item := map[string]interface{}{
+		"id":      "1",
+		"title":   "Good Omens",
+		"year":    1990.0,
+		"address": map[string]interface{}{"street": "Main", "zip": "1234"},
+		"authors": []interface{}{map[string]interface{}{"name": "Terry", "born": 1948.0}, "anonymous"},
+	}
+	cases := []struct {
+		projection Projection
+		expected   map[string]interface{}
+	}{
+		{Projection{}, item},
+		{Projection{Fields: []string{"title", "missing"}}, map[string]interface{}{"id": "1", "title": "Good Omens"}},
+		{Projection{Fields: []string{"id"}}, map[string]interface{}{"id": "1"}},
+		{Projection{Fields: []string{"address.zip", "authors.name"}}, map[string]interface{}{
+			"id":      "1",
+			"address": map[string]interface{}{"zip": "1234"},
+			"authors": []interface{}{map[string]interface{}{"name": "Terry"}},
+		}},
+		{Projection{Fields: []string{"year", "address.street", "authors.born", "title.nested"}, Exclude: true}, map[string]interface{}{
+			"id":      "1",
+			"title":   "Good Omens",
+			"address": map[string]interface{}{"zip": "1234"},
+			"authors": []interface{}{map[string]interface{}{"name": "Terry"}, "anonymous"},
+		}},
+	}
+	for _, c := range cases {
+		if projected := c.projection.Apply(item); !reflect.DeepEqual(projected, c.expected) {
+			t.Errorf("unexpected projection %v for %v", projected, c.projection)
+		}
+	}
+	// the original item is never modified
+	if _, exists := item["year"]; !exists {
+		t.Fatalf("unexpected modified item %v", item)
+	}
+}
+
+func TestProjection_withSortFields(t *testing.T) {
+	sortBy := []SortField{{Name: "address.zip"}, {Name: "year"}}
+	cases := []struct {
+		projection Projection
+		expected   Projection
+	}{
+		{Projection{}, Projection{}},
+		{Projection{Fields: []string{"title", "address"}}, Projection{Fields: []string{"title", "address", "year"}}},
+		{Projection{Fields: []string{"address.zip.code"}}, Projection{Fields: []string{"address.zip", "year"}}},
+		{Projection{Fields: []string{"address", "notes"}, Exclude: true}, Projection{Fields: []string{"notes"}, Exclude: true}},
+		{Projection{Fields: []string{"year"}, Exclude: true}, Projection{}},
+	}
+	for _, c := range cases {
+		if projection := c.projection.withSortFields(sortBy); !reflect.DeepEqual(projection, c.expected) {
+			t.Errorf("unexpected projection %v for %v", projection, c.projection)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchQuery full text search criteria, items containing any of the words in Text are returned sorted by relevance.
+// Only the fields declared as searchable are used, and results can be narrowed using a filter
+type SearchQuery struct {
+	Text   string
+	Filter Filter
+	Skip   int64
+	Limit  int64
+}
+
+// SearchResult item found by a full text search and its relevance score, higher scores are more relevant. Scores
+// depend on the storage, so they are only comparable between results of the same search
+type SearchResult struct {
+	Item  map[string]interface{}
+	Score float64
+}
+
+// searchIndex inverted index for the searchable fields of a collection, the frequency of each term is indexed by
+// term and item ID. A nil index is used for collections without searchable fields, nothing is indexed or found
+type searchIndex struct {
+	fields []string
+	terms  map[string]map[string]int
+}
+
+func newSearchIndex(fields []string) *searchIndex {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &searchIndex{
+		fields: fields,
+		terms:  map[string]map[string]int{},
+	}
+}
+
+func (si *searchIndex) add(itemID string, item map[string]interface{}) {
+	if si == nil {
+		return
+	}
+	for term, frequency := range si.itemTerms(item) {
+		if si.terms[term] == nil {
+			si.terms[term] = map[string]int{}
+		}
+		si.terms[term][itemID] = frequency
+	}
+}
+
+func (si *searchIndex) remove(itemID string, item map[string]interface{}) {
+	if si == nil {
+		return
+	}
+	for term := range si.itemTerms(item) {
+		delete(si.terms[term], itemID)
+		if len(si.terms[term]) == 0 {
+			delete(si.terms, term)
+		}
+	}
+}
+
+// search score for each item containing any of the text terms, using TF-IDF: terms found many times in an item are
+// more relevant, and terms used by few items are more relevant than common ones. total is the amount of indexed items
+func (si *searchIndex) search(text string, total int) map[string]float64 {
+	scores := map[string]float64{}
+	if si == nil {
+		return scores
+	}
+	for term := range termFrequencies(text) {
+		items := si.terms[term]
+		if len(items) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(total)/float64(len(items)))
+		for itemID, frequency := range items {
+			scores[itemID] += float64(frequency) * idf
+		}
+	}
+	return scores
+}
+
+// rankedIDs IDs sorted by descending score, items with the same score are sorted using the storage order.
+// Skip and limit are applied after sorting
+func rankedIDs(scores map[string]float64, before func(idA string, idB string) bool, skip int64, limit int64) []string {
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return before(ids[i], ids[j])
+	})
+	if skip >= int64(len(ids)) {
+		return nil
+	}
+	ids = ids[skip:]
+	if limit > 0 && limit < int64(len(ids)) {
+		ids = ids[:limit]
+	}
+	return ids
+}
+
+// itemTerms frequency of the terms found in the searchable fields of the item
+func (si *searchIndex) itemTerms(item map[string]interface{}) map[string]int {
+	var text []string
+	for _, field := range si.fields {
+		if value, exists := lookupValue(item, field); exists {
+			text = appendText(text, value)
+		}
+	}
+	return termFrequencies(strings.Join(text, " "))
+}
+
+// appendText append all the strings found in the value, arrays are flattened
+func appendText(text []string, value interface{}) []string {
+	switch typed := value.(type) {
+	case string:
+		return append(text, typed)
+	case []interface{}:
+		for _, element := range typed {
+			text = appendText(text, element)
+		}
+	}
+	return text
+}
+
+// termFrequencies split the text into lowercase words, and count how many times each one is used
+func termFrequencies(text string) map[string]int {
+	frequencies := map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		frequencies[word]++
+	}
+	return frequencies
+}
@@ -0,0 +1,1141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"monkiato/apio/internal/data"
+	mk_os "monkiato/apio/internal/os"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// pure go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultSQLitePath = "/app/data/apio.db"
+	sqliteMemoryPath  = ":memory:"
+
+	// sqliteDateFormat dates are stored as fixed width UTC strings, so they are sorted and compared as text
+	sqliteDateFormat = "2006-01-02T15:04:05.000Z"
+	// sqliteConstraintUnique and sqliteConstraintPrimaryKey extended result codes for unique and primary key
+	// constraint violations
+	sqliteConstraintUnique     = 2067
+	sqliteConstraintPrimaryKey = 1555
+	// sqliteBusy and sqliteLocked primary result codes returned when the database is being used by another connection
+	sqliteBusy   = 5
+	sqliteLocked = 6
+	// sqliteSearchFieldsTable table with the searchable fields indexed for each collection and its amount of items,
+	// the terms tables are rebuilt when the fields change
+	sqliteSearchFieldsTable = `"_search_fields"`
+)
+
+//SQLiteStorage structure for the storage using an embedded SQLite database. Each collection is stored in its own
+//table, items are kept as JSON documents and queried using the SQLite JSON functions
+type SQLiteStorage struct {
+	collectionsDefinitions []data.CollectionDefinition
+	collectionHandlers     map[string]CollectionHandler
+	db                     *sql.DB
+	path                   string
+}
+
+//SQLiteCollectionHandler data handler used for a specific collection
+type SQLiteCollectionHandler struct {
+	db         *sql.DB
+	collection data.CollectionDefinition
+	table      string
+	// terms table with the frequency of the terms found in the searchable fields of each item, the search index is
+	// only used to extract the terms of the items
+	terms       string
+	searchIndex *searchIndex
+}
+
+//NewSQLiteStorage create a new SQLiteStorage instance
+//Database file can be set by environment variable SQLITE_PATH
+func NewSQLiteStorage() Storage {
+	return newSQLiteStorage(mk_os.GetEnv("SQLITE_PATH", defaultSQLitePath))
+}
+
+func newSQLiteStorage(path string) *SQLiteStorage {
+	return &SQLiteStorage{
+		collectionHandlers: map[string]CollectionHandler{},
+		path:               path,
+	}
+}
+
+//Initialize implements storage.Storage.Initialize
+func (ss *SQLiteStorage) Initialize(manifest string) {
+	if err := json.Unmarshal([]byte(manifest), &ss.collectionsDefinitions); err != nil {
+		log.Fatal("Unable to parse manifest")
+	}
+
+	if ss.path != sqliteMemoryPath {
+		if err := os.MkdirAll(filepath.Dir(ss.path), 0755); err != nil {
+			log.Fatalf("unable to create data directory for %s. err: %s", ss.path, err.Error())
+		}
+	}
+	log.Debugf("opening SQLite database: %s", ss.path)
+	db, err := sql.Open("sqlite", ss.path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		log.Fatalf("unable to open SQLite database %s. err: %s", ss.path, err.Error())
+	}
+	// a single connection is used, so writes are serialized and in-memory databases are shared by all requests
+	db.SetMaxOpenConns(1)
+	ss.db = db
+
+	// all handlers are created on initialization, so the handlers map is never modified later
+	for _, collectionDefinition := range ss.collectionsDefinitions {
+		handler := &SQLiteCollectionHandler{
+			db:          db,
+			collection:  collectionDefinition,
+			table:       quoteIdentifier(collectionDefinition.Name),
+			terms:       quoteIdentifier(collectionDefinition.Name + "_terms"),
+			searchIndex: newSearchIndex(collectionDefinition.SearchableFields()),
+		}
+		if err := handler.createTable(); err != nil {
+			log.Fatalf("unable to create table for collection %s. err: %s", collectionDefinition.Name, err.Error())
+		}
+		ss.collectionHandlers[collectionDefinition.Name] = handler
+	}
+}
+
+//GetCollectionDefinitions implements storage.Storage.GetCollectionDefinitions
+func (ss *SQLiteStorage) GetCollectionDefinitions() []data.CollectionDefinition {
+	return ss.collectionsDefinitions
+}
+
+//GetCollection implements storage.Storage.GetCollection
+func (ss *SQLiteStorage) GetCollection(collectionName string) (CollectionHandler, error) {
+	if collectionHandler, ok := ss.collectionHandlers[collectionName]; ok {
+		return collectionHandler, nil
+	}
+	return nil, fmt.Errorf("collection %s not found", collectionName)
+}
+
+// createTable create the collection table and a unique index for each unique field
+func (sch *SQLiteCollectionHandler) createTable() error {
+	ctx, cancel := createContext()
+	defer cancel()
+	idColumn := "id TEXT PRIMARY KEY NOT NULL"
+	if sch.hasIntegerIDs() {
+		idColumn = "id INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+	statement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s, data TEXT NOT NULL)", sch.table, idColumn)
+	if _, err := sch.db.ExecContext(ctx, statement); err != nil {
+		return err
+	}
+	for _, name := range sch.collection.UniqueFields() {
+		// expression indexes can't use parameters, field names come from the manifest
+		statement := fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (json_extract(data, '%s'))",
+			quoteIdentifier(sch.collection.Name+"_unique_"+name), sch.table, strings.ReplaceAll(jsonPath([]string{name}), "'", "''"))
+		if _, err := sch.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	// indexing existing items may take longer than the usual timeout, it's only done when the searchable fields change
+	return sch.createTermsTable(context.Background())
+}
+
+// createTermsTable create the terms table for the searchable fields, terms are deleted with their items. Existing
+// items are indexed when the table is created or the searchable fields are changed
+func (sch *SQLiteCollectionHandler) createTermsTable(ctx context.Context) error {
+	statement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (collection TEXT PRIMARY KEY NOT NULL, fields TEXT NOT NULL, "+
+		"items INTEGER NOT NULL)", sqliteSearchFieldsTable)
+	if _, err := sch.db.ExecContext(ctx, statement); err != nil {
+		return err
+	}
+	var fields []string
+	if sch.searchIndex != nil {
+		fields = sch.searchIndex.fields
+	}
+	encodedFields, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	var indexedFields string
+	err = sch.db.QueryRowContext(ctx, fmt.Sprintf("SELECT fields FROM %s WHERE collection = ?", sqliteSearchFieldsTable),
+		sch.collection.Name).Scan(&indexedFields)
+	if err == nil && indexedFields == string(encodedFields) {
+		return nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	tx, err := sch.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insertTrigger := quoteIdentifier(sch.collection.Name + "_terms_insert")
+	deleteTrigger := quoteIdentifier(sch.collection.Name + "_terms_delete")
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", sch.terms),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s", insertTrigger),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s", deleteTrigger),
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if sch.searchIndex != nil {
+		idType := "TEXT"
+		if sch.hasIntegerIDs() {
+			idType = "INTEGER"
+		}
+		// the amount of items is used to score the terms, triggers keep it without counting the whole table
+		collection := "'" + strings.ReplaceAll(sch.collection.Name, "'", "''") + "'"
+		statements := []string{
+			fmt.Sprintf("CREATE TABLE %s (term TEXT NOT NULL, id %s NOT NULL REFERENCES %s (id) ON DELETE CASCADE, "+
+				"frequency INTEGER NOT NULL, PRIMARY KEY (term, id)) WITHOUT ROWID", sch.terms, idType, sch.table),
+			fmt.Sprintf("CREATE INDEX %s ON %s (id)", quoteIdentifier(sch.collection.Name+"_terms_id"), sch.terms),
+			fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s BEGIN UPDATE %s SET items = items + 1 WHERE collection = %s; END",
+				insertTrigger, sch.table, sqliteSearchFieldsTable, collection),
+			fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s BEGIN UPDATE %s SET items = items - 1 WHERE collection = %s; END",
+				deleteTrigger, sch.table, sqliteSearchFieldsTable, collection),
+		}
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+		if err := sch.indexItems(ctx, tx); err != nil {
+			return err
+		}
+	}
+	statement = fmt.Sprintf("INSERT OR REPLACE INTO %s (collection, fields, items) VALUES (?, ?, (SELECT COUNT(*) FROM %s))",
+		sqliteSearchFieldsTable, sch.table)
+	if _, err := tx.ExecContext(ctx, statement, sch.collection.Name, string(encodedFields)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Debugf("indexed searchable fields %v of %s", fields, sch.collection.Name)
+	return nil
+}
+
+// indexItems index the terms of all the stored items
+func (sch *SQLiteCollectionHandler) indexItems(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, data FROM %s", sch.table))
+	if err != nil {
+		return err
+	}
+	// items are read before indexing them, so the statements don't run while the rows are open
+	items := map[string]map[string]interface{}{}
+	for rows.Next() {
+		var id string
+		var encoded string
+		if err := rows.Scan(&id, &encoded); err != nil {
+			rows.Close()
+			return err
+		}
+		item, err := sch.decodeItem(encoded)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		items[id] = item
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for itemID, item := range items {
+		id, err := sch.rowID(itemID)
+		if err != nil {
+			return err
+		}
+		if err := sch.indexItem(ctx, tx, id, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexItem replace the indexed terms of the item, the querier should be the transaction used to write the item
+func (sch *SQLiteCollectionHandler) indexItem(ctx context.Context, querier sqlQuerier, id interface{}, item map[string]interface{}) error {
+	if sch.searchIndex == nil {
+		return nil
+	}
+	if _, err := querier.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ?", sch.terms), id); err != nil {
+		return err
+	}
+	statement := fmt.Sprintf("INSERT INTO %s (term, id, frequency) VALUES (?, ?, ?)", sch.terms)
+	for term, frequency := range sch.searchIndex.itemTerms(item) {
+		if _, err := querier.ExecContext(ctx, statement, term, id, frequency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inTransaction run the write in a transaction, so the item and its terms are stored together
+func (sch *SQLiteCollectionHandler) inTransaction(ctx context.Context, write func(tx *sql.Tx) error) error {
+	tx, err := sch.db.BeginTx(ctx, nil)
+	if err != nil {
+		return toSQLiteStorageError(err)
+	}
+	defer tx.Rollback()
+
+	if err := write(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return toSQLiteStorageError(err)
+	}
+	return nil
+}
+
+//GetItem implements storage.CollectionHandler.GetItem
+func (sch *SQLiteCollectionHandler) GetItem(ctx context.Context, itemID string) (interface{}, error) {
+	return sch.GetItemFields(ctx, itemID, Projection{})
+}
+
+//GetItemFields implements storage.CollectionHandler.GetItemFields, the projection is applied once the item is decoded
+func (sch *SQLiteCollectionHandler) GetItemFields(ctx context.Context, itemID string, fields Projection) (interface{}, error) {
+	id, err := sch.rowID(itemID)
+	if err != nil {
+		return nil, err
+	}
+	item, err := sch.getItem(ctx, sch.db, id)
+	if err == sql.ErrNoRows {
+		return nil, notFoundError(itemID)
+	}
+	if err != nil {
+		log.Errorf("unable to fetch item id %s. err: %s", itemID, err.Error())
+		return nil, toSQLiteStorageError(err)
+	}
+	item[data.IDField] = fmt.Sprint(id)
+	return fields.Apply(item), nil
+}
+
+//ValidateID implements storage.CollectionHandler.ValidateID
+func (sch *SQLiteCollectionHandler) ValidateID(itemID string) error {
+	_, err := sch.rowID(itemID)
+	return err
+}
+
+// hasIntegerIDs true when the id column is an autoincrement integer, the default when the collection doesn't declare
+// an ID strategy
+func (sch *SQLiteCollectionHandler) hasIntegerIDs() bool {
+	return sch.collection.IDStrategy == "" || sch.collection.IDStrategy == data.IDStrategyIncrement
+}
+
+// rowID get the id column value for the item ID
+func (sch *SQLiteCollectionHandler) rowID(itemID string) (interface{}, error) {
+	if sch.collection.IDStrategy != "" && !sch.collection.IsIDValid(itemID) {
+		return nil, invalidIDError(itemID)
+	}
+	if !sch.hasIntegerIDs() {
+		return itemID, nil
+	}
+	id, err := strconv.ParseInt(itemID, 10, 64)
+	if err != nil || id <= 0 {
+		return nil, invalidIDError(itemID)
+	}
+	return id, nil
+}
+
+//AddItem implements storage.CollectionHandler.AddItem
+func (sch *SQLiteCollectionHandler) AddItem(ctx context.Context, item map[string]interface{}) (string, error) {
+	var itemID string
+	err := sch.inTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		itemID, err = sch.addItem(ctx, tx, item)
+		return err
+	})
+	return itemID, err
+}
+
+func (sch *SQLiteCollectionHandler) addItem(ctx context.Context, querier sqlQuerier, item map[string]interface{}) (string, error) {
+	switch sch.collection.IDStrategy {
+	case data.IDStrategyClient:
+		return "", missingClientIDError()
+	case data.IDStrategyUUID:
+		id := data.NewUUID()
+		return id, sch.insertItem(ctx, querier, id, item)
+	case data.IDStrategyObjectID:
+		id := primitive.NewObjectID().Hex()
+		return id, sch.insertItem(ctx, querier, id, item)
+	}
+	encoded, err := encodeSQLiteItem(item)
+	if err != nil {
+		return "", err
+	}
+	res, err := querier.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (data) VALUES (?)", sch.table), encoded)
+	if err != nil {
+		return "", toSQLiteStorageError(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	if err := sch.indexItem(ctx, querier, id, item); err != nil {
+		return "", toSQLiteStorageError(err)
+	}
+	log.Debugf("created new item %s.%d", sch.collection.Name, id)
+	return strconv.FormatInt(id, 10), nil
+}
+
+//InsertItem implements storage.CollectionHandler.InsertItem
+func (sch *SQLiteCollectionHandler) InsertItem(ctx context.Context, itemID string, item map[string]interface{}) error {
+	return sch.inTransaction(ctx, func(tx *sql.Tx) error {
+		return sch.insertItem(ctx, tx, itemID, item)
+	})
+}
+
+func (sch *SQLiteCollectionHandler) insertItem(ctx context.Context, querier sqlQuerier, itemID string, item map[string]interface{}) error {
+	id, err := sch.rowID(itemID)
+	if err != nil {
+		return err
+	}
+	encoded, err := encodeSQLiteItem(item)
+	if err != nil {
+		return err
+	}
+	if _, err := querier.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id, data) VALUES (?, ?)", sch.table), id, encoded); err != nil {
+		var sqliteError interface{ Code() int }
+		if errors.As(err, &sqliteError) && sqliteError.Code() == sqliteConstraintPrimaryKey {
+			return existingItemError(itemID)
+		}
+		return toSQLiteStorageError(err)
+	}
+	if err := sch.indexItem(ctx, querier, id, item); err != nil {
+		return toSQLiteStorageError(err)
+	}
+	log.Debugf("created new item %s.%s", sch.collection.Name, itemID)
+	return nil
+}
+
+//UpsertItem implements storage.CollectionHandler.UpsertItem
+func (sch *SQLiteCollectionHandler) UpsertItem(ctx context.Context, itemID string, item map[string]interface{}) (bool, error) {
+	id, err := sch.rowID(itemID)
+	if err != nil {
+		return false, err
+	}
+	encoded, err := encodeSQLiteItem(item)
+	if err != nil {
+		return false, err
+	}
+	tx, err := sch.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, toSQLiteStorageError(err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = ?)", sch.table), id).Scan(&exists); err != nil {
+		return false, toSQLiteStorageError(err)
+	}
+	statement := fmt.Sprintf("INSERT INTO %s (id, data) VALUES (?, ?)", sch.table)
+	args := []interface{}{id, encoded}
+	if exists {
+		statement = fmt.Sprintf("UPDATE %s SET data = ? WHERE id = ?", sch.table)
+		args = []interface{}{encoded, id}
+	}
+	if _, err := tx.ExecContext(ctx, statement, args...); err != nil {
+		return false, toSQLiteStorageError(err)
+	}
+	if err := sch.indexItem(ctx, tx, id, item); err != nil {
+		return false, toSQLiteStorageError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, toSQLiteStorageError(err)
+	}
+	log.Debugf("upserted item %s.%s", sch.collection.Name, itemID)
+	return !exists, nil
+}
+
+//UpdateItem implements storage.CollectionHandler.UpdateItem
+func (sch *SQLiteCollectionHandler) UpdateItem(ctx context.Context, itemID string, newItem map[string]interface{}) error {
+	tx, err := sch.db.BeginTx(ctx, nil)
+	if err != nil {
+		return toSQLiteStorageError(err)
+	}
+	defer tx.Rollback()
+
+	if err := sch.updateItem(ctx, tx, itemID, newItem); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return toSQLiteStorageError(err)
+	}
+	return nil
+}
+
+// updateItem merge the new field values into the stored item, the querier must be a transaction so the item can't
+// be modified between the read and the write
+func (sch *SQLiteCollectionHandler) updateItem(ctx context.Context, querier sqlQuerier, itemID string, newItem map[string]interface{}) error {
+	id, err := sch.rowID(itemID)
+	if err != nil {
+		return err
+	}
+	item, err := sch.getItem(ctx, querier, id)
+	if err == sql.ErrNoRows {
+		return notFoundError(itemID)
+	}
+	if err != nil {
+		return toSQLiteStorageError(err)
+	}
+	for key, value := range newItem {
+		item[key] = value
+	}
+	encoded, err := encodeSQLiteItem(item)
+	if err != nil {
+		return err
+	}
+	if _, err := querier.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET data = ? WHERE id = ?", sch.table), encoded, id); err != nil {
+		return toSQLiteStorageError(err)
+	}
+	if err := sch.indexItem(ctx, querier, id, item); err != nil {
+		return toSQLiteStorageError(err)
+	}
+	log.Debugf("updated item %s.%s", sch.collection.Name, itemID)
+	return nil
+}
+
+//ReplaceItem implements storage.CollectionHandler.ReplaceItem
+func (sch *SQLiteCollectionHandler) ReplaceItem(ctx context.Context, itemID string, newItem map[string]interface{}) error {
+	id, err := sch.rowID(itemID)
+	if err != nil {
+		return err
+	}
+	encoded, err := encodeSQLiteItem(newItem)
+	if err != nil {
+		return err
+	}
+	err = sch.inTransaction(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET data = ? WHERE id = ?", sch.table), encoded, id)
+		if err != nil {
+			return toSQLiteStorageError(err)
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			return notFoundError(itemID)
+		}
+		if err := sch.indexItem(ctx, tx, id, newItem); err != nil {
+			return toSQLiteStorageError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Debugf("replaced item %s.%s", sch.collection.Name, itemID)
+	return nil
+}
+
+//PatchItem implements storage.CollectionHandler.PatchItem, the item is read and replaced in the same transaction
+func (sch *SQLiteCollectionHandler) PatchItem(ctx context.Context, itemID string, patch ItemPatch) error {
+	id, err := sch.rowID(itemID)
+	if err != nil {
+		return err
+	}
+	tx, err := sch.db.BeginTx(ctx, nil)
+	if err != nil {
+		return toSQLiteStorageError(err)
+	}
+	defer tx.Rollback()
+
+	item, err := sch.getItem(ctx, tx, id)
+	if err == sql.ErrNoRows {
+		return notFoundError(itemID)
+	}
+	if err != nil {
+		return toSQLiteStorageError(err)
+	}
+	item[data.IDField] = fmt.Sprint(id)
+	newItem, err := patch(item)
+	if err != nil {
+		return err
+	}
+	encoded, err := encodeSQLiteItem(newItem)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET data = ? WHERE id = ?", sch.table), encoded, id); err != nil {
+		return toSQLiteStorageError(err)
+	}
+	if err := sch.indexItem(ctx, tx, id, newItem); err != nil {
+		return toSQLiteStorageError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return toSQLiteStorageError(err)
+	}
+	log.Debugf("patched item %s.%s", sch.collection.Name, itemID)
+	return nil
+}
+
+//DeleteItem implements storage.CollectionHandler.DeleteItem
+func (sch *SQLiteCollectionHandler) DeleteItem(ctx context.Context, itemID string) error {
+	return sch.deleteItem(ctx, sch.db, itemID)
+}
+
+func (sch *SQLiteCollectionHandler) deleteItem(ctx context.Context, querier sqlQuerier, itemID string) error {
+	id, err := sch.rowID(itemID)
+	if err != nil {
+		return err
+	}
+	res, err := querier.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ?", sch.table), id)
+	if err != nil {
+		return toSQLiteStorageError(err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return notFoundError(itemID)
+	}
+	log.Debugf("deleted item %s.%s", sch.collection.Name, itemID)
+	return nil
+}
+
+//UpdateMany implements storage.CollectionHandler.UpdateMany, the fields are set with a single statement, so unique
+//fields conflicts abort the whole update
+func (sch *SQLiteCollectionHandler) UpdateMany(ctx context.Context, filter Filter, item map[string]interface{}) (int64, error) {
+	if len(item) == 0 {
+		return sch.Count(ctx, filter)
+	}
+	// sort keys so the statement is always the same for the same fields
+	keys := make([]string, 0, len(item))
+	for key := range item {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	assignments := make([]string, len(keys))
+	var args []interface{}
+	for i, key := range keys {
+		encoded, err := json.Marshal(toSQLiteValue(item[key]))
+		if err != nil {
+			return 0, err
+		}
+		assignments[i] = "?, json(?)"
+		args = append(args, jsonPath([]string{key}), string(encoded))
+	}
+	where, whereArgs := sch.createWhere(filter)
+	var updated int64
+	err := sch.inTransaction(ctx, func(tx *sql.Tx) error {
+		// the updated items must be found before the update, they may not match the filter anymore
+		var ids []string
+		if sch.updatesSearchableFields(keys) {
+			var err error
+			if ids, err = sch.matchingIDs(ctx, tx, where, whereArgs); err != nil {
+				return toSQLiteStorageError(err)
+			}
+		}
+		statement := fmt.Sprintf("UPDATE %s SET data = json_set(data, %s) WHERE %s", sch.table, strings.Join(assignments, ", "), where)
+		res, err := tx.ExecContext(ctx, statement, append(args, whereArgs...)...)
+		if err != nil {
+			return toSQLiteStorageError(err)
+		}
+		if updated, err = res.RowsAffected(); err != nil {
+			return err
+		}
+		for _, itemID := range ids {
+			id, err := sch.rowID(itemID)
+			if err != nil {
+				return err
+			}
+			item, err := sch.getItem(ctx, tx, id)
+			if err != nil {
+				return toSQLiteStorageError(err)
+			}
+			if err := sch.indexItem(ctx, tx, id, item); err != nil {
+				return toSQLiteStorageError(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.Debugf("updated %d items %s", updated, sch.collection.Name)
+	return updated, nil
+}
+
+// updatesSearchableFields whether setting the fields modifies any searchable field
+func (sch *SQLiteCollectionHandler) updatesSearchableFields(keys []string) bool {
+	if sch.searchIndex == nil {
+		return false
+	}
+	for _, key := range keys {
+		for _, field := range sch.searchIndex.fields {
+			if field == key || strings.HasPrefix(field, key+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchingIDs IDs of the items matching the condition, sorted by ID
+func (sch *SQLiteCollectionHandler) matchingIDs(ctx context.Context, querier sqlQuerier, where string, args []interface{}) ([]string, error) {
+	rows, err := querier.QueryContext(ctx, fmt.Sprintf("SELECT id FROM %s WHERE %s ORDER BY id ASC", sch.table, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+//DeleteMany implements storage.CollectionHandler.DeleteMany, terms of the deleted items are removed by the foreign key
+func (sch *SQLiteCollectionHandler) DeleteMany(ctx context.Context, filter Filter) (int64, error) {
+	where, args := sch.createWhere(filter)
+	res, err := sch.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", sch.table, where), args...)
+	if err != nil {
+		return 0, toSQLiteStorageError(err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	log.Debugf("deleted %d items %s", deleted, sch.collection.Name)
+	return deleted, nil
+}
+
+//BulkWrite implements storage.CollectionHandler.BulkWrite, the batch is applied in a single transaction. Failed
+//operations don't abort the transaction, SQLite only rolls back the failing statement
+func (sch *SQLiteCollectionHandler) BulkWrite(ctx context.Context, operations []BulkOperation) ([]BulkResult, error) {
+	tx, err := sch.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, toSQLiteStorageError(err)
+	}
+	defer tx.Rollback()
+
+	results := make([]BulkResult, len(operations))
+	for i, operation := range operations {
+		results[i] = BulkResult{ID: operation.ID}
+		switch operation.Type {
+		case BulkCreate:
+			if operation.ID == "" {
+				results[i].ID, results[i].Err = sch.addItem(ctx, tx, operation.Item)
+			} else {
+				results[i].Err = sch.insertItem(ctx, tx, operation.ID, operation.Item)
+			}
+		case BulkUpdate:
+			results[i].Err = sch.updateItem(ctx, tx, operation.ID, operation.Item)
+		case BulkDelete:
+			results[i].Err = sch.deleteItem(ctx, tx, operation.ID)
+		default:
+			results[i].Err = unknownBulkOperationError(operation.Type)
+		}
+		// the transaction can't continue once the storage fails or the request is cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, contextError(err)
+		}
+		if errors.Is(results[i].Err, ErrUnavailable) {
+			return nil, results[i].Err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, toSQLiteStorageError(err)
+	}
+	return results, nil
+}
+
+//Query implements storage.CollectionHandler.Query
+func (sch *SQLiteCollectionHandler) Query(ctx context.Context, query QueryParams) (QueryResult, error) {
+	where, args := sch.createWhere(query.Filter)
+	if query.After != nil {
+		cursorID, err := sch.rowID(query.After.ID)
+		if err != nil {
+			return QueryResult{}, invalidCursorError(query.After.ID)
+		}
+		cursorWhere, cursorArgs := createSQLiteCursorWhere(cursorID, query.After, query.SortBy)
+		where = fmt.Sprintf("(%s) AND (%s)", where, cursorWhere)
+		args = append(args, cursorArgs...)
+	}
+	orderBy, orderArgs := createSQLiteOrderBy(query.SortBy)
+	args = append(args, orderArgs...)
+
+	limit := int64(-1)
+	if query.Limit > 0 {
+		// fetch an extra item to know if there are more items after the last one
+		limit = query.Limit + 1
+	}
+	args = append(args, limit, query.Skip)
+
+	rows, err := sch.db.QueryContext(ctx,
+		fmt.Sprintf("SELECT id, data FROM %s WHERE %s ORDER BY %s LIMIT ? OFFSET ?", sch.table, where, orderBy), args...)
+	if err != nil {
+		return QueryResult{}, toSQLiteStorageError(err)
+	}
+	defer rows.Close()
+
+	result := QueryResult{}
+	var lastID string
+	var lastItem map[string]interface{}
+	for rows.Next() {
+		// integer IDs are converted into their decimal representation
+		var id string
+		var encoded string
+		if err := rows.Scan(&id, &encoded); err != nil {
+			return QueryResult{}, toSQLiteStorageError(err)
+		}
+		if query.Limit > 0 && query.Limit == int64(len(result.Items)) {
+			result.Next = NewCursor(query.SortBy, lastID, lastItem)
+			break
+		}
+		item, err := sch.decodeItem(encoded)
+		if err != nil {
+			return QueryResult{}, err
+		}
+		item[data.IDField] = id
+		// the whole item is kept for the cursor, since the projection may not include the sort fields
+		result.Items = append(result.Items, query.Fields.Apply(item))
+		lastID, lastItem = id, item
+	}
+	if err := rows.Err(); err != nil {
+		return QueryResult{}, toSQLiteStorageError(err)
+	}
+	return result, nil
+}
+
+//Count implements storage.CollectionHandler.Count
+func (sch *SQLiteCollectionHandler) Count(ctx context.Context, filter Filter) (int64, error) {
+	where, args := sch.createWhere(filter)
+	var count int64
+	if err := sch.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", sch.table, where), args...).Scan(&count); err != nil {
+		return 0, toSQLiteStorageError(err)
+	}
+	return count, nil
+}
+
+//Search implements storage.CollectionHandler.Search. Items containing the text terms are found in the terms table,
+//only the returned items are read. The ranking is the same as the memory storage
+func (sch *SQLiteCollectionHandler) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	terms := termFrequencies(query.Text)
+	if sch.searchIndex == nil || len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+	placeholders := make([]string, 0, len(terms))
+	termArgs := make([]interface{}, 0, len(terms))
+	for term := range terms {
+		placeholders = append(placeholders, "?")
+		termArgs = append(termArgs, term)
+	}
+	inTerms := strings.Join(placeholders, ", ")
+
+	// all items are used to score the terms, so term relevance doesn't depend on the filter
+	var total int
+	err := sch.db.QueryRowContext(ctx, fmt.Sprintf("SELECT items FROM %s WHERE collection = ?", sqliteSearchFieldsTable),
+		sch.collection.Name).Scan(&total)
+	if err != nil {
+		return nil, toSQLiteStorageError(err)
+	}
+	rows, err := sch.db.QueryContext(ctx,
+		fmt.Sprintf("SELECT term, id, frequency FROM %s WHERE term IN (%s)", sch.terms, inTerms), termArgs...)
+	if err != nil {
+		return nil, toSQLiteStorageError(err)
+	}
+	index := &searchIndex{fields: sch.searchIndex.fields, terms: map[string]map[string]int{}}
+	for rows.Next() {
+		var term string
+		var id string
+		var frequency int
+		if err := rows.Scan(&term, &id, &frequency); err != nil {
+			rows.Close()
+			return nil, toSQLiteStorageError(err)
+		}
+		if index.terms[term] == nil {
+			index.terms[term] = map[string]int{}
+		}
+		index.terms[term][id] = frequency
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, toSQLiteStorageError(err)
+	}
+
+	where, args := sch.createWhere(query.Filter)
+	matchingArgs := append(append([]interface{}{}, termArgs...), args...)
+	ids, err := sch.matchingIDs(ctx, sch.db,
+		fmt.Sprintf("id IN (SELECT id FROM %s WHERE term IN (%s)) AND %s", sch.terms, inTerms, where), matchingArgs)
+	if err != nil {
+		return nil, toSQLiteStorageError(err)
+	}
+	// position of each item in the table, used to sort items with the same score
+	positions := make(map[string]int, len(ids))
+	for position, id := range ids {
+		positions[id] = position
+	}
+	scores := index.search(query.Text, total)
+	for id := range scores {
+		if _, matched := positions[id]; !matched {
+			delete(scores, id)
+		}
+	}
+	ids = rankedIDs(scores, func(idA string, idB string) bool {
+		return positions[idA] < positions[idB]
+	}, query.Skip, query.Limit)
+	results := make([]SearchResult, len(ids))
+	for i, itemID := range ids {
+		id, err := sch.rowID(itemID)
+		if err != nil {
+			return nil, err
+		}
+		item, err := sch.getItem(ctx, sch.db, id)
+		if err != nil {
+			return nil, toSQLiteStorageError(err)
+		}
+		item[data.IDField] = itemID
+		results[i] = SearchResult{Item: item, Score: scores[itemID]}
+	}
+	return results, nil
+}
+
+//Aggregate implements storage.CollectionHandler.Aggregate. Items are filtered by SQLite and aggregated while they
+//are read, so stored dates are compared as dates instead of strings
+func (sch *SQLiteCollectionHandler) Aggregate(ctx context.Context, query AggregateQuery) ([]AggregateGroup, error) {
+	where, args := sch.createWhere(query.Filter)
+	rows, err := sch.db.QueryContext(ctx, fmt.Sprintf("SELECT data FROM %s WHERE %s", sch.table, where), args...)
+	if err != nil {
+		return nil, toSQLiteStorageError(err)
+	}
+	defer rows.Close()
+
+	aggregator := newAggregator(sch.collection, query)
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, toSQLiteStorageError(err)
+		}
+		item, err := sch.decodeItem(encoded)
+		if err != nil {
+			return nil, err
+		}
+		aggregator.add(item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, toSQLiteStorageError(err)
+	}
+	return aggregator.result(), nil
+}
+
+type sqlQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (sch *SQLiteCollectionHandler) getItem(ctx context.Context, querier sqlQuerier, id interface{}) (map[string]interface{}, error) {
+	var encoded string
+	err := querier.QueryRowContext(ctx, fmt.Sprintf("SELECT data FROM %s WHERE id = ?", sch.table), id).Scan(&encoded)
+	if err != nil {
+		return nil, err
+	}
+	return sch.decodeItem(encoded)
+}
+
+// decodeItem decode the JSON document and convert the values to the native types declared in the collection
+func (sch *SQLiteCollectionHandler) decodeItem(encoded string) (map[string]interface{}, error) {
+	var item map[string]interface{}
+	if err := json.Unmarshal([]byte(encoded), &item); err != nil {
+		return nil, err
+	}
+	sch.collection.ToNative(item)
+	return item, nil
+}
+
+// createWhere converts the filter into a SQL condition, all conditions must be satisfied
+func (sch *SQLiteCollectionHandler) createWhere(filter Filter) (string, []interface{}) {
+	conditions := []string{"1"}
+	var args []interface{}
+	for _, condition := range filter {
+		sqlCondition, conditionArgs := sch.createCondition(condition)
+		conditions = append(conditions, sqlCondition)
+		args = append(args, conditionArgs...)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (sch *SQLiteCollectionHandler) createCondition(condition FilterCondition) (string, []interface{}) {
+	path := strings.Split(condition.Field, ".")
+	switch condition.Operator {
+	case FilterNotEqual:
+		// missing fields are matched too
+		sqlCondition, args := matchSQLitePath("data", sch.collection.Fields, path, 0, sqliteMatcher(FilterEqual, condition.Value))
+		return fmt.Sprintf("NOT COALESCE(%s, 0)", sqlCondition), args
+	case FilterNotIn:
+		sqlCondition, args := matchSQLitePath("data", sch.collection.Fields, path, 0, sqliteMatcher(FilterIn, condition.Value))
+		return fmt.Sprintf("NOT COALESCE(%s, 0)", sqlCondition), args
+	}
+	sqlCondition, args := matchSQLitePath("data", sch.collection.Fields, path, 0, sqliteMatcher(condition.Operator, condition.Value))
+	return fmt.Sprintf("COALESCE(%s, 0)", sqlCondition), args
+}
+
+// sqlMatcher builds the SQL condition for a value expression, expression args must be placed before the condition args
+type sqlMatcher func(expression string, expressionArgs []interface{}) (string, []interface{})
+
+func sqliteMatcher(operator FilterOperator, value interface{}) sqlMatcher {
+	return func(expression string, expressionArgs []interface{}) (string, []interface{}) {
+		args := append([]interface{}{}, expressionArgs...)
+		switch operator {
+		case FilterEqual:
+			return expression + " = ?", append(args, toSQLiteValue(value))
+		case FilterGreaterThan:
+			return expression + " > ?", append(args, toSQLiteValue(value))
+		case FilterGreaterThanOrEqual:
+			return expression + " >= ?", append(args, toSQLiteValue(value))
+		case FilterLowerThan:
+			return expression + " < ?", append(args, toSQLiteValue(value))
+		case FilterLowerThanOrEqual:
+			return expression + " <= ?", append(args, toSQLiteValue(value))
+		case FilterIn:
+			list, _ := value.([]interface{})
+			if len(list) == 0 {
+				return "0", nil
+			}
+			placeholders := make([]string, len(list))
+			for i, element := range list {
+				placeholders[i] = "?"
+				args = append(args, toSQLiteValue(element))
+			}
+			return fmt.Sprintf("%s IN (%s)", expression, strings.Join(placeholders, ", ")), args
+		case FilterContains:
+			return fmt.Sprintf("instr(lower(%s), lower(?)) > 0", expression), append(args, value)
+		}
+		return "0", nil
+	}
+}
+
+// matchSQLitePath builds the condition for the value found in the path of the JSON document. Arrays found in the path
+// are traversed, so the condition is satisfied when any of the elements does, the same way MongoDB does
+func matchSQLitePath(source string, fields map[string]data.FieldDefinition, path []string, depth int, match sqlMatcher) (string, []interface{}) {
+	for i, name := range path {
+		field, exists := fields[name]
+		if !exists {
+			break
+		}
+		if field.Type == data.FieldTypeArray && field.Items != nil {
+			alias := "e" + strconv.Itoa(depth)
+			var condition string
+			var args []interface{}
+			if rest := path[i+1:]; len(rest) == 0 {
+				condition, args = match(alias+".value", nil)
+			} else {
+				condition, args = matchSQLitePath(alias+".value", field.Items.Fields, rest, depth+1, match)
+			}
+			return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s, ?) AS %s WHERE %s)", source, alias, condition),
+				append([]interface{}{jsonPath(path[:i+1])}, args...)
+		}
+		fields = field.Fields
+	}
+	return match(fmt.Sprintf("json_extract(%s, ?)", source), []interface{}{jsonPath(path)})
+}
+
+// createSQLiteCursorWhere condition matching the items placed after the cursor, using the same approach explained
+// in createCursorFilter. Missing values are placed first in ascending order
+func createSQLiteCursorWhere(cursorID interface{}, cursor *Cursor, sortBy []SortField) (string, []interface{}) {
+	var alternatives []string
+	var args []interface{}
+	var equalConditions []string
+	var equalArgs []interface{}
+	for i, sortField := range sortBy {
+		expression := "json_extract(data, ?)"
+		path := jsonPath(strings.Split(sortField.Name, "."))
+		value := toSQLiteValue(cursor.Values[i])
+
+		var condition string
+		var conditionArgs []interface{}
+		switch {
+		case value == nil && !sortField.Descending:
+			condition, conditionArgs = expression+" IS NOT NULL", []interface{}{path}
+		case value != nil && !sortField.Descending:
+			condition, conditionArgs = expression+" > ?", []interface{}{path, value}
+		case value != nil && sortField.Descending:
+			condition, conditionArgs = fmt.Sprintf("(%s < ? OR %s IS NULL)", expression, expression), []interface{}{path, value, path}
+		}
+		if condition != "" {
+			alternatives = append(alternatives, strings.Join(append(append([]string{}, equalConditions...), condition), " AND "))
+			args = append(append(args, equalArgs...), conditionArgs...)
+		}
+		equalConditions = append(equalConditions, expression+" IS ?")
+		equalArgs = append(equalArgs, path, value)
+	}
+	alternatives = append(alternatives, strings.Join(append(equalConditions, "id > ?"), " AND "))
+	args = append(append(args, equalArgs...), cursorID)
+	return "(" + strings.Join(alternatives, ") OR (") + ")", args
+}
+
+func createSQLiteOrderBy(sortBy []SortField) (string, []interface{}) {
+	var orderBy []string
+	var args []interface{}
+	for _, sortField := range sortBy {
+		direction := "ASC"
+		if sortField.Descending {
+			direction = "DESC"
+		}
+		orderBy = append(orderBy, "json_extract(data, ?) "+direction)
+		args = append(args, jsonPath(strings.Split(sortField.Name, ".")))
+	}
+	return strings.Join(append(orderBy, "id ASC"), ", "), args
+}
+
+// encodeSQLiteItem JSON document stored for the item
+func encodeSQLiteItem(item map[string]interface{}) (string, error) {
+	encoded, err := json.Marshal(toSQLiteValue(item))
+	return string(encoded), err
+}
+
+// toSQLiteValue converts dates into fixed width strings, nested objects and arrays are converted recursively
+func toSQLiteValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case time.Time:
+		return typed.UTC().Format(sqliteDateFormat)
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, element := range typed {
+			converted[key] = toSQLiteValue(element)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(typed))
+		for i, element := range typed {
+			converted[i] = toSQLiteValue(element)
+		}
+		return converted
+	}
+	return value
+}
+
+// toSQLiteStorageError wraps unique constraint errors with ErrConflict, and locked database errors and timeouts
+// with ErrUnavailable
+func toSQLiteStorageError(err error) error {
+	var sqliteError interface{ Code() int }
+	if errors.As(err, &sqliteError) {
+		if sqliteError.Code() == sqliteConstraintUnique {
+			return fmt.Errorf("%w: duplicated value for unique field", ErrConflict)
+		}
+		// extended result codes keep the primary code in the lower byte
+		if primaryCode := sqliteError.Code() & 0xff; primaryCode == sqliteBusy || primaryCode == sqliteLocked {
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+	}
+	return contextError(err)
+}
+
+// jsonPath SQLite JSON path for the field path, e.g. $."address"."zip"
+func jsonPath(path []string) string {
+	return `$."` + strings.Join(path, `"."`) + `"`
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
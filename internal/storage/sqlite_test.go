@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const sqliteManifest = `[{"name": "books", "fields": {
+	"title": {"type": "string", "unique": true},
+	"year": "integer",
+	"published": "datetime",
+	"available": "bool",
+	"tags": "[string]",
+	"authors": [{"name": "string"}],
+	"publisher": {"name": "string"}
+}}]`
+
+const sqliteSearchManifest = `[{"name": "books", "fields": {
+	"title": {"type": "string", "searchable": true},
+	"tags": {"type": "array", "items": "string", "searchable": %t},
+	"authors": [{"name": "string"}]
+}}]`
+
+func createSQLiteCollection(t *testing.T) CollectionHandler {
+	storage := newSQLiteStorage(sqliteMemoryPath)
+	storage.Initialize(sqliteManifest)
+	handler, err := storage.GetCollection("books")
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	return handler
+}
+
+func addSQLiteItems(t *testing.T, handler CollectionHandler) []string {
+	items := []map[string]interface{}{
+		{"title": "The Hobbit", "year": int64(1937), "published": time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC),
+			"available": true, "tags": []interface{}{"fantasy", "classic"},
+			"authors": []interface{}{map[string]interface{}{"name": "Tolkien"}}, "publisher": map[string]interface{}{"name": "Allen & Unwin"}},
+		{"title": "Dune", "year": int64(1965), "available": false, "tags": []interface{}{"scifi"},
+			"authors": []interface{}{map[string]interface{}{"name": "Herbert"}}},
+		{"title": "Good Omens", "year": int64(1990), "tags": []interface{}{"fantasy", "comedy"},
+			"authors": []interface{}{map[string]interface{}{"name": "Pratchett"}, map[string]interface{}{"name": "Gaiman"}}},
+		{"title": "Untitled"},
+	}
+	var ids []string
+	for _, item := range items {
+		id, err := handler.AddItem(context.Background(), item)
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func queryTitles(t *testing.T, handler CollectionHandler, query QueryParams) ([]interface{}, *Cursor) {
+	result, err := handler.Query(context.Background(), query)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	var titles []interface{}
+	for _, item := range result.Items {
+		titles = append(titles, item.(map[string]interface{})["title"])
+	}
+	return titles, result.Next
+}
+
+func TestSQLiteCollectionHandler_items(t *testing.T) {
+	handler := createSQLiteCollection(t)
+	ids := addSQLiteItems(t, handler)
+
+	item, err := handler.GetItem(context.Background(), ids[0])
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	published := item.(map[string]interface{})["published"]
+	if published != time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC) || item.(map[string]interface{})["year"] != int64(1937) {
+		t.Fatalf("unexpected item types %v", item)
+	}
+
+	if err := handler.UpdateItem(context.Background(), ids[1], map[string]interface{}{"year": int64(1966)}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	item, _ = handler.GetItem(context.Background(), ids[1])
+	if item.(map[string]interface{})["year"] != int64(1966) || item.(map[string]interface{})["title"] != "Dune" {
+		t.Fatalf("unexpected updated item %v", item)
+	}
+	if err := handler.ReplaceItem(context.Background(), ids[1], map[string]interface{}{"title": "Dune Messiah"}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	item, _ = handler.GetItem(context.Background(), ids[1])
+	if !reflect.DeepEqual(item, map[string]interface{}{"id": ids[1], "title": "Dune Messiah"}) {
+		t.Fatalf("unexpected replaced item %v", item)
+	}
+	if err := handler.DeleteItem(context.Background(), ids[1]); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if _, err := handler.GetItem(context.Background(), ids[1]); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected deleted item found")
+	}
+	if err := handler.DeleteItem(context.Background(), ids[1]); err == nil {
+		t.Fatalf("expected not found error")
+	}
+	if _, err := handler.AddItem(context.Background(), map[string]interface{}{"title": "The Hobbit"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+}
+
+func TestSQLiteCollectionHandler_Query_filter(t *testing.T) {
+	handler := createSQLiteCollection(t)
+	addSQLiteItems(t, handler)
+
+	cases := []struct {
+		filter   Filter
+		expected []interface{}
+	}{
+		{Filter{{Field: "year", Operator: FilterGreaterThan, Value: int64(1950)}}, []interface{}{"Dune", "Good Omens"}},
+		{Filter{{Field: "year", Operator: FilterNotEqual, Value: int64(1937)}}, []interface{}{"Dune", "Good Omens", "Untitled"}},
+		{Filter{{Field: "tags", Operator: FilterEqual, Value: "fantasy"}}, []interface{}{"The Hobbit", "Good Omens"}},
+		{Filter{{Field: "tags", Operator: FilterNotIn, Value: []interface{}{"fantasy", "scifi"}}}, []interface{}{"Untitled"}},
+		{Filter{{Field: "authors.name", Operator: FilterContains, Value: "GAI"}}, []interface{}{"Good Omens"}},
+		{Filter{{Field: "publisher.name", Operator: FilterEqual, Value: "Allen & Unwin"}}, []interface{}{"The Hobbit"}},
+		{Filter{{Field: "available", Operator: FilterEqual, Value: true}}, []interface{}{"The Hobbit"}},
+		{Filter{{Field: "published", Operator: FilterLowerThan, Value: time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC)}}, []interface{}{"The Hobbit"}},
+	}
+	for _, c := range cases {
+		titles, _ := queryTitles(t, handler, QueryParams{Filter: c.filter})
+		if !reflect.DeepEqual(titles, c.expected) {
+			t.Errorf("unexpected result %v for filter %v", titles, c.filter)
+		}
+		if count, _ := handler.Count(context.Background(), c.filter); count != int64(len(c.expected)) {
+			t.Errorf("unexpected count %d for filter %v", count, c.filter)
+		}
+	}
+}
+
+func TestSQLiteCollectionHandler_Query_cursor(t *testing.T) {
+	handler := createSQLiteCollection(t)
+	addSQLiteItems(t, handler)
+
+	for _, c := range []struct {
+		sortBy   []SortField
+		expected []interface{}
+	}{
+		{[]SortField{{Name: "year"}}, []interface{}{"Untitled", "The Hobbit", "Dune", "Good Omens"}},
+		{[]SortField{{Name: "year", Descending: true}}, []interface{}{"Good Omens", "Dune", "The Hobbit", "Untitled"}},
+		{[]SortField{{Name: "published"}, {Name: "title"}}, []interface{}{"Dune", "Good Omens", "Untitled", "The Hobbit"}},
+	} {
+		var titles []interface{}
+		query := QueryParams{Limit: 1, SortBy: c.sortBy}
+		for {
+			page, next := queryTitles(t, handler, query)
+			titles = append(titles, page...)
+			if next == nil {
+				break
+			}
+			query.After = next
+		}
+		if !reflect.DeepEqual(titles, c.expected) {
+			t.Errorf("unexpected result %v for sort %v", titles, c.sortBy)
+		}
+	}
+
+	titles, _ := queryTitles(t, handler, QueryParams{Skip: 1, Limit: 2})
+	if !reflect.DeepEqual(titles, []interface{}{"Dune", "Good Omens"}) {
+		t.Errorf("unexpected result %v", titles)
+	}
+}
+
+func TestSQLiteCollectionHandler_Search_terms(t *testing.T) {
+	path, err := ioutil.TempDir("", "apio")
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	defer os.RemoveAll(path)
+	openCollection := func(searchableTags bool) CollectionHandler {
+		storage := newSQLiteStorage(filepath.Join(path, "apio.db"))
+		storage.Initialize(fmt.Sprintf(sqliteSearchManifest, searchableTags))
+		t.Cleanup(func() { storage.db.Close() })
+		handler, _ := storage.GetCollection("books")
+		return handler
+	}
+	searchTitles := func(handler CollectionHandler, text string) []interface{} {
+		results, err := handler.Search(context.Background(), SearchQuery{Text: text})
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		titles := []interface{}{}
+		for _, result := range results {
+			titles = append(titles, result.Item["title"])
+		}
+		return titles
+	}
+
+	handler := openCollection(false)
+	addSQLiteItems(t, handler)
+	if titles := searchTitles(handler, "fantasy"); len(titles) != 0 {
+		t.Fatalf("unexpected titles %v for a field that is not searchable", titles)
+	}
+
+	// the existing items are indexed when the searchable fields change
+	handler = openCollection(true)
+	if titles := searchTitles(handler, "fantasy"); !reflect.DeepEqual(titles, []interface{}{"The Hobbit", "Good Omens"}) {
+		t.Fatalf("unexpected titles %v after indexing existing items", titles)
+	}
+
+	fantasy := Filter{{Field: "tags", Operator: FilterEqual, Value: "fantasy"}}
+	if _, err := handler.UpdateMany(context.Background(), fantasy, map[string]interface{}{"tags": []interface{}{"novel"}}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if titles := searchTitles(handler, "fantasy"); len(titles) != 0 {
+		t.Fatalf("unexpected titles %v after updating items", titles)
+	}
+	if titles := searchTitles(handler, "novel"); !reflect.DeepEqual(titles, []interface{}{"The Hobbit", "Good Omens"}) {
+		t.Fatalf("unexpected titles %v after updating items", titles)
+	}
+
+	novel := Filter{{Field: "tags", Operator: FilterEqual, Value: "novel"}}
+	if _, err := handler.DeleteMany(context.Background(), novel); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if titles := searchTitles(handler, "novel dune"); !reflect.DeepEqual(titles, []interface{}{"Dune"}) {
+		t.Fatalf("unexpected titles %v after deleting items", titles)
+	}
+	var terms int
+	sqliteHandler := handler.(*SQLiteCollectionHandler)
+	if err := sqliteHandler.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", sqliteHandler.terms)).Scan(&terms); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	// "dune", "scifi" and "untitled"
+	if terms != 3 {
+		t.Fatalf("unexpected %d terms after deleting items", terms)
+	}
+}
@@ -0,0 +1,1121 @@
+// Package storagetest provides a conformance test suite for the storage.Storage implementations of this module, so
+// all storage backends can prove they share the same semantics
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkiato/apio/internal/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Manifest collections used by the suite. The factory must return a storage initialized with this manifest
+const Manifest = `[
+	{
+		"name": "books",
+		"fields": {
+			"title": {"type": "string", "unique": true, "searchable": true},
+			"year": "integer",
+			"rating": "float",
+			"available": "bool",
+			"published": "datetime",
+			"genre": "enum:[fiction,poetry,essay]",
+			"tags": {"type": "array", "items": "string", "searchable": true},
+			"authors": [{"name": {"type": "string", "searchable": true}}],
+			"publisher": {"name": "string", "country": "string"}
+		}
+	},
+	{
+		"name": "authors",
+		"fields": {
+			"name": "string"
+		}
+	},
+	{
+		"name": "editions",
+		"id_strategy": "client",
+		"fields": {
+			"title": "string"
+		}
+	},
+	{
+		"name": "events",
+		"id_strategy": "uuid",
+		"fields": {
+			"name": "string"
+		}
+	},
+	{
+		"name": "tickets",
+		"id_strategy": "increment",
+		"fields": {
+			"title": "string"
+		}
+	},
+	{
+		"name": "logs",
+		"id_strategy": "objectid",
+		"fields": {
+			"message": "string"
+		}
+	}
+]`
+
+// Factory creates a new empty storage initialized with the specified manifest. Every call must return an isolated
+// storage, the factory is responsible for releasing any resource once the test finishes (e.g. using t.Cleanup)
+type Factory func(t *testing.T, manifest string) storage.Storage
+
+// Run runs the whole conformance suite against the storage created by the factory
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.Storage)
+	}{
+		{"Collections", testCollections},
+		{"AddItem", testAddItem},
+		{"GetItem_notFound", testGetItemNotFound},
+		{"UpdateItem", testUpdateItem},
+		{"ReplaceItem", testReplaceItem},
+		{"PatchItem", testPatchItem},
+		{"DeleteItem", testDeleteItem},
+		{"Query_defaultOrder", testQueryDefaultOrder},
+		{"Query_pagination", testQueryPagination},
+		{"Query_sort", testQuerySort},
+		{"Query_filter", testQueryFilter},
+		{"Query_cursor", testQueryCursor},
+		{"Query_ids", testQueryIDs},
+		{"Query_fields", testQueryFields},
+		{"GetItemFields", testGetItemFields},
+		{"Search", testSearch},
+		{"Aggregate", testAggregate},
+		{"Unique", testUnique},
+		{"ValidateID", testValidateID},
+		{"ClientIDs", testClientIDs},
+		{"UUIDs", testUUIDs},
+		{"IncrementIDs", testIncrementIDs},
+		{"ObjectIDs", testObjectIDs},
+		{"UpsertItem", testUpsertItem},
+		{"UpdateMany", testUpdateMany},
+		{"DeleteMany", testDeleteMany},
+		{"BulkWrite", testBulkWrite},
+		{"BulkWrite_ids", testBulkWriteIDs},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, factory(t, Manifest))
+		})
+	}
+}
+
+// Books sample items used by the suite, new maps are created on each call so storages can keep the added items
+func Books() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"title":     "The Hobbit",
+			"year":      int64(1937),
+			"rating":    4.7,
+			"available": true,
+			"published": time.Date(1937, 9, 21, 10, 30, 0, 0, time.UTC),
+			"genre":     "fiction",
+			"tags":      []interface{}{"fantasy", "classic"},
+			"authors":   []interface{}{map[string]interface{}{"name": "J. R. R. Tolkien"}},
+			"publisher": map[string]interface{}{"name": "Allen & Unwin", "country": "UK"},
+		},
+		{
+			"title":     "Dune",
+			"year":      int64(1965),
+			"rating":    4.5,
+			"available": false,
+			"published": time.Date(1965, 8, 1, 0, 0, 0, 0, time.UTC),
+			"genre":     "fiction",
+			"tags":      []interface{}{"scifi"},
+			"authors":   []interface{}{map[string]interface{}{"name": "Frank Herbert"}},
+			"publisher": map[string]interface{}{"name": "Chilton Books", "country": "US"},
+		},
+		{
+			"title":   "Good Omens",
+			"year":    int64(1990),
+			"rating":  4.5,
+			"genre":   "fiction",
+			"tags":    []interface{}{"fantasy", "comedy"},
+			"authors": []interface{}{map[string]interface{}{"name": "Terry Pratchett"}, map[string]interface{}{"name": "Neil Gaiman"}},
+		},
+		{
+			"title":     "Leaves of Grass",
+			"year":      int64(1855),
+			"available": true,
+			"genre":     "poetry",
+		},
+		{
+			"title": "Untitled",
+		},
+	}
+}
+
+func collection(t *testing.T, s storage.Storage, name string) storage.CollectionHandler {
+	handler, err := s.GetCollection(name)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	return handler
+}
+
+// addBooks add all the sample books, the IDs are returned in the same order
+func addBooks(t *testing.T, handler storage.CollectionHandler) []string {
+	var ids []string
+	for _, book := range Books() {
+		id, err := handler.AddItem(context.Background(), book)
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func titles(t *testing.T, handler storage.CollectionHandler, query storage.QueryParams) ([]string, *storage.Cursor) {
+	result, err := handler.Query(context.Background(), query)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	list := []string{}
+	for _, item := range result.Items {
+		title, _ := item.(map[string]interface{})["title"].(string)
+		list = append(list, title)
+	}
+	return list, result.Next
+}
+
+func testCollections(t *testing.T, s storage.Storage) {
+	if definitions := s.GetCollectionDefinitions(); len(definitions) != 6 || definitions[0].Name != "books" {
+		t.Fatalf("unexpected collection definitions %v", definitions)
+	}
+	if _, err := s.GetCollection("unknown"); err == nil {
+		t.Fatalf("expected error for unknown collection")
+	}
+	// collections are isolated
+	addBooks(t, collection(t, s, "books"))
+	if count, _ := collection(t, s, "authors").Count(context.Background(), nil); count != 0 {
+		t.Fatalf("unexpected items count %d", count)
+	}
+}
+
+func testAddItem(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	seen := map[string]bool{}
+	for i, id := range ids {
+		if id == "" || seen[id] {
+			t.Fatalf("unexpected id '%s'", id)
+		}
+		seen[id] = true
+		item, err := handler.GetItem(context.Background(), id)
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		expected := Books()[i]
+		expected["id"] = id
+		if !reflect.DeepEqual(item, expected) {
+			t.Fatalf("unexpected item %v, expected %v", item, expected)
+		}
+	}
+	if count, _ := handler.Count(context.Background(), nil); count != int64(len(ids)) {
+		t.Fatalf("unexpected items count %d", count)
+	}
+}
+
+func testGetItemNotFound(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	id, _ := handler.AddItem(context.Background(), map[string]interface{}{"title": "Deleted"})
+	handler.DeleteItem(context.Background(), id)
+	if item, err := handler.GetItem(context.Background(), id); !errors.Is(err, storage.ErrNotFound) || item != nil {
+		t.Fatalf("expected not found error for id '%s', got %v", id, err)
+	}
+	// each storage decides the IDs format, unknown IDs are either invalid or not found
+	for _, id := range []string{"unknown", ""} {
+		item, err := handler.GetItem(context.Background(), id)
+		if (!errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrInvalidID)) || item != nil {
+			t.Fatalf("expected not found or invalid id error for id '%s', got %v", id, err)
+		}
+	}
+}
+
+func testUpdateItem(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	// only the specified fields are updated
+	if err := handler.UpdateItem(context.Background(), ids[3], map[string]interface{}{"year": int64(1856), "rating": nil}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	item, _ := handler.GetItem(context.Background(), ids[3])
+	expected := map[string]interface{}{"id": ids[3], "title": "Leaves of Grass", "year": int64(1856), "rating": nil, "available": true, "genre": "poetry"}
+	if !reflect.DeepEqual(item, expected) {
+		t.Fatalf("unexpected item %v", item)
+	}
+	handler.DeleteItem(context.Background(), ids[4])
+	if err := handler.UpdateItem(context.Background(), ids[4], map[string]interface{}{"year": int64(2000)}); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func testReplaceItem(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	replacement := map[string]interface{}{"title": "Leaves of Grass", "tags": []interface{}{"poems"}}
+	if err := handler.ReplaceItem(context.Background(), ids[3], replacement); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	item, _ := handler.GetItem(context.Background(), ids[3])
+	if !reflect.DeepEqual(item, map[string]interface{}{"id": ids[3], "title": "Leaves of Grass", "tags": []interface{}{"poems"}}) {
+		t.Fatalf("unexpected item %v", item)
+	}
+	handler.DeleteItem(context.Background(), ids[4])
+	if err := handler.ReplaceItem(context.Background(), ids[4], map[string]interface{}{"title": "Untitled"}); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func testPatchItem(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	err := handler.PatchItem(context.Background(), ids[3], func(item map[string]interface{}) (map[string]interface{}, error) {
+		if item["id"] != ids[3] || item["title"] != "Leaves of Grass" {
+			return nil, fmt.Errorf("unexpected item %v", item)
+		}
+		delete(item, "id")
+		delete(item, "rating")
+		item["year"] = int64(1856)
+		return item, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	item, _ := handler.GetItem(context.Background(), ids[3])
+	expected := map[string]interface{}{"id": ids[3], "title": "Leaves of Grass", "year": int64(1856), "available": true, "genre": "poetry"}
+	if !reflect.DeepEqual(item, expected) {
+		t.Fatalf("unexpected item %v", item)
+	}
+
+	// patch errors abort the operation and are returned as they are
+	errPatch := errors.New("patch error")
+	err = handler.PatchItem(context.Background(), ids[3], func(item map[string]interface{}) (map[string]interface{}, error) {
+		return nil, errPatch
+	})
+	if err != errPatch {
+		t.Fatalf("expected patch error, got %v", err)
+	}
+	handler.DeleteItem(context.Background(), ids[4])
+	err = handler.PatchItem(context.Background(), ids[4], func(item map[string]interface{}) (map[string]interface{}, error) {
+		return item, nil
+	})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	// concurrent patches never lose updates, storages may reject some of them with a conflict
+	const patches = 10
+	errs := make(chan error, patches)
+	for i := 0; i < patches; i++ {
+		go func() {
+			errs <- handler.PatchItem(context.Background(), ids[3], func(item map[string]interface{}) (map[string]interface{}, error) {
+				delete(item, "id")
+				item["year"] = item["year"].(int64) + 1
+				return item, nil
+			})
+		}()
+	}
+	applied := int64(0)
+	for i := 0; i < patches; i++ {
+		err := <-errs
+		if err == nil {
+			applied++
+		} else if !errors.Is(err, storage.ErrConflict) {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+	}
+	item, _ = handler.GetItem(context.Background(), ids[3])
+	if year := item.(map[string]interface{})["year"]; year != int64(1856)+applied {
+		t.Fatalf("expected year %d after %d patches, got %v", int64(1856)+applied, applied, year)
+	}
+}
+
+func testDeleteItem(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	if err := handler.DeleteItem(context.Background(), ids[1]); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if _, err := handler.GetItem(context.Background(), ids[1]); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err := handler.DeleteItem(context.Background(), ids[1]); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if count, _ := handler.Count(context.Background(), nil); count != int64(len(ids)-1) {
+		t.Fatalf("unexpected items count %d", count)
+	}
+	// new items never reuse IDs
+	id, _ := handler.AddItem(context.Background(), map[string]interface{}{"title": "Dune Messiah"})
+	for _, existingID := range ids {
+		if id == existingID {
+			t.Fatalf("reused id '%s'", id)
+		}
+	}
+}
+
+func testQueryDefaultOrder(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	addBooks(t, handler)
+	// items are returned in the same order they were added
+	list, next := titles(t, handler, storage.QueryParams{})
+	expected := []string{"The Hobbit", "Dune", "Good Omens", "Leaves of Grass", "Untitled"}
+	if !reflect.DeepEqual(list, expected) || next != nil {
+		t.Fatalf("unexpected result %v, next %v", list, next)
+	}
+	if list, _ := titles(t, collection(t, s, "authors"), storage.QueryParams{}); len(list) != 0 {
+		t.Fatalf("unexpected result for empty collection %v", list)
+	}
+}
+
+func testQueryPagination(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	addBooks(t, handler)
+	cases := []struct {
+		skip, limit int64
+		expected    []string
+		more        bool
+	}{
+		{0, 2, []string{"The Hobbit", "Dune"}, true},
+		{2, 2, []string{"Good Omens", "Leaves of Grass"}, true},
+		{4, 2, []string{"Untitled"}, false},
+		{3, 2, []string{"Leaves of Grass", "Untitled"}, false},
+		{5, 2, []string{}, false},
+		{1, 0, []string{"Dune", "Good Omens", "Leaves of Grass", "Untitled"}, false},
+	}
+	for _, c := range cases {
+		list, next := titles(t, handler, storage.QueryParams{Skip: c.skip, Limit: c.limit})
+		if !reflect.DeepEqual(list, c.expected) || (next != nil) != c.more {
+			t.Errorf("unexpected result %v, next %v for skip %d limit %d", list, next, c.skip, c.limit)
+		}
+	}
+}
+
+// sortCases sorting criteria and the expected order. Missing values are placed first in ascending order, and
+// the order the items were added is used for ties
+var sortCases = []struct {
+	sortBy   []storage.SortField
+	expected []string
+}{
+	{[]storage.SortField{{Name: "year"}}, []string{"Untitled", "Leaves of Grass", "The Hobbit", "Dune", "Good Omens"}},
+	{[]storage.SortField{{Name: "year", Descending: true}}, []string{"Good Omens", "Dune", "The Hobbit", "Leaves of Grass", "Untitled"}},
+	{[]storage.SortField{{Name: "title"}}, []string{"Dune", "Good Omens", "Leaves of Grass", "The Hobbit", "Untitled"}},
+	{[]storage.SortField{{Name: "rating", Descending: true}}, []string{"The Hobbit", "Dune", "Good Omens", "Leaves of Grass", "Untitled"}},
+	{[]storage.SortField{{Name: "rating", Descending: true}, {Name: "title"}}, []string{"The Hobbit", "Dune", "Good Omens", "Leaves of Grass", "Untitled"}},
+	{[]storage.SortField{{Name: "genre"}, {Name: "year", Descending: true}}, []string{"Untitled", "Good Omens", "Dune", "The Hobbit", "Leaves of Grass"}},
+	{[]storage.SortField{{Name: "published"}}, []string{"Good Omens", "Leaves of Grass", "Untitled", "The Hobbit", "Dune"}},
+	{[]storage.SortField{{Name: "publisher.country", Descending: true}}, []string{"Dune", "The Hobbit", "Good Omens", "Leaves of Grass", "Untitled"}},
+	{[]storage.SortField{{Name: "available"}}, []string{"Good Omens", "Untitled", "Dune", "The Hobbit", "Leaves of Grass"}},
+}
+
+func testQuerySort(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	addBooks(t, handler)
+	for _, c := range sortCases {
+		if list, _ := titles(t, handler, storage.QueryParams{SortBy: c.sortBy}); !reflect.DeepEqual(list, c.expected) {
+			t.Errorf("unexpected result %v for sort %v", list, c.sortBy)
+		}
+	}
+}
+
+func testQueryFilter(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	addBooks(t, handler)
+	date := time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		filter   storage.Filter
+		expected []string
+	}{
+		{storage.Filter{{Field: "title", Operator: storage.FilterEqual, Value: "Dune"}}, []string{"Dune"}},
+		{storage.Filter{{Field: "year", Operator: storage.FilterNotEqual, Value: int64(1937)}}, []string{"Dune", "Good Omens", "Leaves of Grass", "Untitled"}},
+		{storage.Filter{{Field: "year", Operator: storage.FilterGreaterThan, Value: int64(1937)}}, []string{"Dune", "Good Omens"}},
+		{storage.Filter{{Field: "year", Operator: storage.FilterGreaterThanOrEqual, Value: int64(1937)}}, []string{"The Hobbit", "Dune", "Good Omens"}},
+		{storage.Filter{{Field: "year", Operator: storage.FilterLowerThan, Value: int64(1937)}}, []string{"Leaves of Grass"}},
+		{storage.Filter{{Field: "year", Operator: storage.FilterLowerThanOrEqual, Value: int64(1937)}}, []string{"The Hobbit", "Leaves of Grass"}},
+		{storage.Filter{{Field: "rating", Operator: storage.FilterEqual, Value: 4.5}}, []string{"Dune", "Good Omens"}},
+		{storage.Filter{{Field: "available", Operator: storage.FilterEqual, Value: true}}, []string{"The Hobbit", "Leaves of Grass"}},
+		{storage.Filter{{Field: "available", Operator: storage.FilterNotEqual, Value: true}}, []string{"Dune", "Good Omens", "Untitled"}},
+		{storage.Filter{{Field: "published", Operator: storage.FilterLowerThan, Value: date}}, []string{"The Hobbit"}},
+		{storage.Filter{{Field: "genre", Operator: storage.FilterIn, Value: []interface{}{"poetry", "essay"}}}, []string{"Leaves of Grass"}},
+		{storage.Filter{{Field: "genre", Operator: storage.FilterNotIn, Value: []interface{}{"fiction"}}}, []string{"Leaves of Grass", "Untitled"}},
+		{storage.Filter{{Field: "title", Operator: storage.FilterContains, Value: "OF g"}}, []string{"Leaves of Grass"}},
+		{storage.Filter{{Field: "title", Operator: storage.FilterContains, Value: "."}}, []string{}},
+		{storage.Filter{{Field: "tags", Operator: storage.FilterEqual, Value: "fantasy"}}, []string{"The Hobbit", "Good Omens"}},
+		{storage.Filter{{Field: "tags", Operator: storage.FilterNotEqual, Value: "fantasy"}}, []string{"Dune", "Leaves of Grass", "Untitled"}},
+		{storage.Filter{{Field: "tags", Operator: storage.FilterIn, Value: []interface{}{"scifi", "comedy"}}}, []string{"Dune", "Good Omens"}},
+		{storage.Filter{{Field: "authors.name", Operator: storage.FilterEqual, Value: "Neil Gaiman"}}, []string{"Good Omens"}},
+		{storage.Filter{{Field: "authors.name", Operator: storage.FilterContains, Value: "terry"}}, []string{"Good Omens"}},
+		{storage.Filter{{Field: "publisher.country", Operator: storage.FilterEqual, Value: "UK"}}, []string{"The Hobbit"}},
+		{storage.Filter{
+			{Field: "genre", Operator: storage.FilterEqual, Value: "fiction"},
+			{Field: "rating", Operator: storage.FilterLowerThan, Value: 4.6},
+		}, []string{"Dune", "Good Omens"}},
+	}
+	for _, c := range cases {
+		list, _ := titles(t, handler, storage.QueryParams{Filter: c.filter})
+		if !reflect.DeepEqual(list, c.expected) {
+			t.Errorf("unexpected result %v for filter %s", list, describeFilter(c.filter))
+		}
+		if count, err := handler.Count(context.Background(), c.filter); err != nil || count != int64(len(c.expected)) {
+			t.Errorf("unexpected count %d for filter %s", count, describeFilter(c.filter))
+		}
+	}
+}
+
+func testQueryCursor(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	addBooks(t, handler)
+	for _, c := range sortCases {
+		for _, limit := range []int64{1, 2} {
+			list := []string{}
+			query := storage.QueryParams{Limit: limit, SortBy: c.sortBy}
+			for page := 0; page <= len(c.expected); page++ {
+				pageList, next := titles(t, handler, query)
+				list = append(list, pageList...)
+				if next == nil {
+					break
+				}
+				query.After = next
+			}
+			if !reflect.DeepEqual(list, c.expected) {
+				t.Errorf("unexpected result %v for sort %v and limit %d", list, c.sortBy, limit)
+			}
+		}
+	}
+	// cursors pointing to invalid IDs are rejected the same way invalid item IDs are
+	query := storage.QueryParams{After: &storage.Cursor{ID: "not-an-id"}}
+	if _, err := handler.Query(context.Background(), query); !errors.Is(err, storage.ErrInvalidID) {
+		t.Fatalf("expected invalid id error, got %v", err)
+	}
+}
+
+func testQueryIDs(t *testing.T, s storage.Storage) {
+	for _, name := range []string{"books", "tickets", "logs"} {
+		handler := collection(t, s, name)
+		ids := addBooks(t, handler)
+		result, err := handler.Query(context.Background(), storage.QueryParams{})
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		var listed []string
+		for _, item := range result.Items {
+			id, _ := item.(map[string]interface{})["id"].(string)
+			listed = append(listed, id)
+		}
+		// items are sorted by ID by default, in creation order for generated IDs
+		if !reflect.DeepEqual(listed, ids) {
+			t.Fatalf("unexpected %s ids %v, expected %v", name, listed, ids)
+		}
+	}
+}
+
+func testUnique(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	if _, err := handler.AddItem(context.Background(), map[string]interface{}{"title": "Dune"}); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if err := handler.UpdateItem(context.Background(), ids[0], map[string]interface{}{"title": "Dune"}); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if err := handler.ReplaceItem(context.Background(), ids[0], map[string]interface{}{"title": "Dune"}); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	// failed operations don't modify the items
+	if item, _ := handler.GetItem(context.Background(), ids[0]); item.(map[string]interface{})["title"] != "The Hobbit" {
+		t.Fatalf("unexpected item %v", item)
+	}
+	// items can keep their own value
+	if err := handler.ReplaceItem(context.Background(), ids[1], map[string]interface{}{"title": "Dune", "year": int64(1966)}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	// items without the field are allowed
+	for i := 0; i < 2; i++ {
+		if _, err := handler.AddItem(context.Background(), map[string]interface{}{"year": int64(2000)}); err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+	}
+	// values are released when items are deleted or updated
+	handler.DeleteItem(context.Background(), ids[1])
+	handler.UpdateItem(context.Background(), ids[2], map[string]interface{}{"title": "Good Omens 2"})
+	for _, title := range []string{"Dune", "Good Omens"} {
+		if _, err := handler.AddItem(context.Background(), map[string]interface{}{"title": title}); err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+	}
+}
+
+func describeFilter(filter storage.Filter) string {
+	description := ""
+	for _, condition := range filter {
+		description += fmt.Sprintf("[%s %s %v]", condition.Field, condition.Operator, condition.Value)
+	}
+	return description
+}
+
+func testValidateID(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	for _, id := range ids {
+		if err := handler.ValidateID(id); err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+	}
+	for _, id := range []string{"", "not an id", "../books"} {
+		if err := handler.ValidateID(id); !errors.Is(err, storage.ErrInvalidID) {
+			t.Fatalf("expected invalid id error for id '%s', got %v", id, err)
+		}
+	}
+}
+
+func testClientIDs(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "editions")
+	if _, err := handler.AddItem(context.Background(), map[string]interface{}{"title": "Dune"}); !errors.Is(err, storage.ErrInvalidID) {
+		t.Fatalf("expected invalid id error, got %v", err)
+	}
+	for _, id := range []string{"dune-1965", "dune-2005", "Dune_1984"} {
+		if err := handler.InsertItem(context.Background(), id, map[string]interface{}{"title": id}); err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+	}
+	if err := handler.InsertItem(context.Background(), "dune-1965", map[string]interface{}{"title": "Dune"}); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if err := handler.InsertItem(context.Background(), "dune 1965", map[string]interface{}{"title": "Dune"}); !errors.Is(err, storage.ErrInvalidID) {
+		t.Fatalf("expected invalid id error, got %v", err)
+	}
+	item, err := handler.GetItem(context.Background(), "dune-2005")
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if !reflect.DeepEqual(item, map[string]interface{}{"id": "dune-2005", "title": "dune-2005"}) {
+		t.Fatalf("unexpected item %v", item)
+	}
+	if err := handler.ReplaceItem(context.Background(), "dune-2005", map[string]interface{}{"title": "Dune (2005)"}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	// string IDs are sorted as text
+	var all []string
+	query := storage.QueryParams{Limit: 2}
+	for {
+		list, next := titles(t, handler, query)
+		all = append(all, list...)
+		if next == nil {
+			break
+		}
+		query.After = next
+	}
+	if expected := []string{"Dune_1984", "dune-1965", "Dune (2005)"}; !reflect.DeepEqual(all, expected) {
+		t.Fatalf("unexpected titles %v, expected %v", all, expected)
+	}
+}
+
+func testUUIDs(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "events")
+	id, err := handler.AddItem(context.Background(), map[string]interface{}{"name": "launch"})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if err := handler.ValidateID(id); err != nil || len(id) != 36 {
+		t.Fatalf("unexpected id '%s'", id)
+	}
+	if item, err := handler.GetItem(context.Background(), id); err != nil || !reflect.DeepEqual(item, map[string]interface{}{"id": id, "name": "launch"}) {
+		t.Fatalf("unexpected item %v, err: %v", item, err)
+	}
+	if otherID, _ := handler.AddItem(context.Background(), map[string]interface{}{"name": "landing"}); otherID == id {
+		t.Fatalf("reused id '%s'", id)
+	}
+	if err := handler.ValidateID("dune-1965"); !errors.Is(err, storage.ErrInvalidID) {
+		t.Fatalf("expected invalid id error, got %v", err)
+	}
+}
+
+func testIncrementIDs(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "tickets")
+	var ids []string
+	for _, title := range []string{"first", "second"} {
+		id, err := handler.AddItem(context.Background(), map[string]interface{}{"title": title})
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		ids = append(ids, id)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+	// generated IDs continue after the IDs provided by the client
+	if err := handler.InsertItem(context.Background(), "10", map[string]interface{}{"title": "tenth"}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if id, err := handler.AddItem(context.Background(), map[string]interface{}{"title": "eleventh"}); err != nil || id != "11" {
+		t.Fatalf("unexpected id '%s', err: %v", id, err)
+	}
+	for _, id := range []string{"0", "012", "a1", "dune-1965"} {
+		if err := handler.ValidateID(id); !errors.Is(err, storage.ErrInvalidID) {
+			t.Fatalf("expected invalid id error for id '%s', got %v", id, err)
+		}
+	}
+	// IDs are sorted as numbers
+	list, _ := titles(t, handler, storage.QueryParams{})
+	if expected := []string{"first", "second", "tenth", "eleventh"}; !reflect.DeepEqual(list, expected) {
+		t.Fatalf("unexpected titles %v, expected %v", list, expected)
+	}
+}
+
+func testObjectIDs(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "logs")
+	id, err := handler.AddItem(context.Background(), map[string]interface{}{"message": "started"})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if err := handler.ValidateID(id); err != nil || len(id) != 24 {
+		t.Fatalf("unexpected id '%s'", id)
+	}
+	if item, err := handler.GetItem(context.Background(), id); err != nil || !reflect.DeepEqual(item, map[string]interface{}{"id": id, "message": "started"}) {
+		t.Fatalf("unexpected item %v, err: %v", item, err)
+	}
+	if err := handler.ValidateID("1"); !errors.Is(err, storage.ErrInvalidID) {
+		t.Fatalf("expected invalid id error, got %v", err)
+	}
+}
+
+func testUpsertItem(t *testing.T, s storage.Storage) {
+	for _, test := range []struct {
+		collection string
+		id         string
+	}{
+		{"editions", "dune-1965"},
+		{"tickets", "7"},
+		{"logs", "5e9f1b0c8f1d2a3b4c5d6e7f"},
+	} {
+		handler := collection(t, s, test.collection)
+		created, err := handler.UpsertItem(context.Background(), test.id, map[string]interface{}{"title": "Dune"})
+		if err != nil || !created {
+			t.Fatalf("expected %s item to be created, err: %v", test.collection, err)
+		}
+		created, err = handler.UpsertItem(context.Background(), test.id, map[string]interface{}{"title": "Dune (1965)"})
+		if err != nil || created {
+			t.Fatalf("expected %s item to be replaced, err: %v", test.collection, err)
+		}
+		item, err := handler.GetItem(context.Background(), test.id)
+		if err != nil || !reflect.DeepEqual(item, map[string]interface{}{"id": test.id, "title": "Dune (1965)"}) {
+			t.Fatalf("unexpected %s item %v, err: %v", test.collection, item, err)
+		}
+		if count, _ := handler.Count(context.Background(), nil); count != 1 {
+			t.Fatalf("unexpected %s items count %d", test.collection, count)
+		}
+		if _, err := handler.UpsertItem(context.Background(), "not an id", map[string]interface{}{"title": "Dune"}); !errors.Is(err, storage.ErrInvalidID) {
+			t.Fatalf("expected invalid id error, got %v", err)
+		}
+	}
+}
+
+func testBulkWrite(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	handler.DeleteItem(context.Background(), ids[4])
+	results, err := handler.BulkWrite(context.Background(), []storage.BulkOperation{
+		{Type: storage.BulkCreate, Item: map[string]interface{}{"title": "The Silmarillion"}},
+		{Type: storage.BulkCreate, Item: map[string]interface{}{"title": "The Hobbit"}},
+		{Type: storage.BulkUpdate, ID: ids[0], Item: map[string]interface{}{"year": int64(1938)}},
+		{Type: storage.BulkDelete, ID: ids[1]},
+		{Type: storage.BulkUpdate, ID: ids[4], Item: map[string]interface{}{"year": int64(2000)}},
+		{Type: storage.BulkDelete, ID: "not an id"},
+		{Type: "move", ID: ids[2]},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if len(results) != 7 {
+		t.Fatalf("unexpected results %v", results)
+	}
+	// each operation succeeds or fails on its own
+	for i, expected := range []error{nil, storage.ErrConflict, nil, nil, storage.ErrNotFound, storage.ErrInvalidID} {
+		if (expected == nil && results[i].Err != nil) || !errors.Is(results[i].Err, expected) {
+			t.Fatalf("unexpected result %d error %v, expected %v", i, results[i].Err, expected)
+		}
+	}
+	if results[6].Err == nil {
+		t.Fatalf("expected error for unknown operation")
+	}
+	if item, err := handler.GetItem(context.Background(), results[0].ID); err != nil || item.(map[string]interface{})["title"] != "The Silmarillion" {
+		t.Fatalf("unexpected created item %v, err: %v", item, err)
+	}
+	if item, _ := handler.GetItem(context.Background(), ids[0]); item.(map[string]interface{})["year"] != int64(1938) || item.(map[string]interface{})["title"] != "The Hobbit" {
+		t.Fatalf("unexpected updated item %v", item)
+	}
+	if _, err := handler.GetItem(context.Background(), ids[1]); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected deleted item, got %v", err)
+	}
+	if count, _ := handler.Count(context.Background(), nil); count != 4 {
+		t.Fatalf("unexpected items count %d", count)
+	}
+}
+
+func testBulkWriteIDs(t *testing.T, s storage.Storage) {
+	editions := collection(t, s, "editions")
+	results, err := editions.BulkWrite(context.Background(), []storage.BulkOperation{
+		{Type: storage.BulkCreate, ID: "dune-1965", Item: map[string]interface{}{"title": "Dune"}},
+		{Type: storage.BulkCreate, Item: map[string]interface{}{"title": "Dune"}},
+	})
+	if err != nil || results[0].Err != nil || results[0].ID != "dune-1965" || !errors.Is(results[1].Err, storage.ErrInvalidID) {
+		t.Fatalf("unexpected results %v, err: %v", results, err)
+	}
+	results, _ = editions.BulkWrite(context.Background(), []storage.BulkOperation{
+		{Type: storage.BulkCreate, ID: "dune-1965", Item: map[string]interface{}{"title": "Dune"}},
+	})
+	if !errors.Is(results[0].Err, storage.ErrConflict) {
+		t.Fatalf("expected conflict error, got %v", results[0].Err)
+	}
+
+	// generated IDs continue after the IDs provided by the client
+	tickets := collection(t, s, "tickets")
+	results, err = tickets.BulkWrite(context.Background(), []storage.BulkOperation{
+		{Type: storage.BulkCreate, Item: map[string]interface{}{"title": "first"}},
+		{Type: storage.BulkCreate, Item: map[string]interface{}{"title": "second"}},
+		{Type: storage.BulkCreate, ID: "10", Item: map[string]interface{}{"title": "tenth"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	var ids []string
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("unexpected error: " + result.Err.Error())
+		}
+		ids = append(ids, result.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2", "10"}) {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+	if id, err := tickets.AddItem(context.Background(), map[string]interface{}{"title": "eleventh"}); err != nil || id != "11" {
+		t.Fatalf("unexpected id '%s', err: %v", id, err)
+	}
+}
+
+func testUpdateMany(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	fiction := storage.Filter{{Field: "genre", Operator: storage.FilterEqual, Value: "fiction"}}
+	published := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	updated, err := handler.UpdateMany(context.Background(), fiction, map[string]interface{}{"available": true, "published": published, "rating": nil})
+	if err != nil || updated != 3 {
+		t.Fatalf("unexpected updated count %d, err: %v", updated, err)
+	}
+	available := storage.Filter{{Field: "available", Operator: storage.FilterEqual, Value: true}}
+	if count, _ := handler.Count(context.Background(), available); count != 4 {
+		t.Fatalf("unexpected available items count %d", count)
+	}
+	// only the specified fields are updated
+	item, _ := handler.GetItem(context.Background(), ids[2])
+	expected := map[string]interface{}{
+		"id":        ids[2],
+		"title":     "Good Omens",
+		"year":      int64(1990),
+		"rating":    nil,
+		"available": true,
+		"published": published,
+		"genre":     "fiction",
+		"tags":      []interface{}{"fantasy", "comedy"},
+		"authors":   []interface{}{map[string]interface{}{"name": "Terry Pratchett"}, map[string]interface{}{"name": "Neil Gaiman"}},
+	}
+	if !reflect.DeepEqual(item, expected) {
+		t.Fatalf("unexpected item %v", item)
+	}
+	// the same unique value can't be used by multiple items
+	if _, err := handler.UpdateMany(context.Background(), fiction, map[string]interface{}{"title": "Same"}); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	// no item is updated when the update fails
+	same := storage.Filter{{Field: "title", Operator: storage.FilterEqual, Value: "Same"}}
+	if count, _ := handler.Count(context.Background(), same); count != 0 {
+		t.Fatalf("unexpected updated items count %d after conflict", count)
+	}
+	if item, _ := handler.GetItem(context.Background(), ids[2]); !reflect.DeepEqual(item, expected) {
+		t.Fatalf("unexpected item %v after conflict", item)
+	}
+	// a unique value can be set when a single item matches
+	goodOmens := storage.Filter{{Field: "title", Operator: storage.FilterEqual, Value: "Good Omens"}}
+	if updated, err := handler.UpdateMany(context.Background(), goodOmens, map[string]interface{}{"title": "Good Omens (1990)"}); err != nil || updated != 1 {
+		t.Fatalf("unexpected updated count %d, err: %v", updated, err)
+	}
+	none := storage.Filter{{Field: "genre", Operator: storage.FilterEqual, Value: "essay"}}
+	if updated, err := handler.UpdateMany(context.Background(), none, map[string]interface{}{"available": false}); err != nil || updated != 0 {
+		t.Fatalf("unexpected updated count %d, err: %v", updated, err)
+	}
+}
+
+func testDeleteMany(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	old := storage.Filter{{Field: "year", Operator: storage.FilterLowerThan, Value: int64(1950)}}
+	if deleted, err := handler.DeleteMany(context.Background(), old); err != nil || deleted != 2 {
+		t.Fatalf("unexpected deleted count %d, err: %v", deleted, err)
+	}
+	if list, _ := titles(t, handler, storage.QueryParams{}); !reflect.DeepEqual(list, []string{"Dune", "Good Omens", "Untitled"}) {
+		t.Fatalf("unexpected titles %v", list)
+	}
+	if _, err := handler.GetItem(context.Background(), ids[0]); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected deleted item, got %v", err)
+	}
+	if deleted, err := handler.DeleteMany(context.Background(), old); err != nil || deleted != 0 {
+		t.Fatalf("unexpected deleted count %d, err: %v", deleted, err)
+	}
+}
+
+func testQueryFields(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	// the sort field is not included, but it's still used for the cursor
+	query := storage.QueryParams{
+		Limit:  2,
+		SortBy: []storage.SortField{{Name: "year", Descending: true}},
+		Fields: storage.Projection{Fields: []string{"title", "publisher.country", "authors.name"}},
+	}
+	result, err := handler.Query(context.Background(), query)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	expected := []interface{}{
+		map[string]interface{}{
+			"id":      ids[2],
+			"title":   "Good Omens",
+			"authors": []interface{}{map[string]interface{}{"name": "Terry Pratchett"}, map[string]interface{}{"name": "Neil Gaiman"}},
+		},
+		map[string]interface{}{
+			"id":        ids[1],
+			"title":     "Dune",
+			"authors":   []interface{}{map[string]interface{}{"name": "Frank Herbert"}},
+			"publisher": map[string]interface{}{"country": "US"},
+		},
+	}
+	if !reflect.DeepEqual(result.Items, expected) {
+		t.Fatalf("unexpected items %v", result.Items)
+	}
+	if result.Next == nil {
+		t.Fatalf("missing next cursor")
+	}
+	query.After = result.Next
+	if list, _ := titles(t, handler, query); !reflect.DeepEqual(list, []string{"The Hobbit", "Leaves of Grass"}) {
+		t.Fatalf("unexpected titles %v", list)
+	}
+
+	excluded := storage.QueryParams{
+		Filter: storage.Filter{{Field: "title", Operator: storage.FilterEqual, Value: "Leaves of Grass"}},
+		Fields: storage.Projection{Fields: []string{"year", "genre"}, Exclude: true},
+	}
+	result, err = handler.Query(context.Background(), excluded)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	expected = []interface{}{
+		map[string]interface{}{"id": ids[3], "title": "Leaves of Grass", "available": true},
+	}
+	if !reflect.DeepEqual(result.Items, expected) {
+		t.Fatalf("unexpected items %v", result.Items)
+	}
+
+	// every excluded field is a sort field, it's only used for the cursor
+	sortExcluded := storage.QueryParams{
+		Filter: storage.Filter{{Field: "title", Operator: storage.FilterEqual, Value: "Leaves of Grass"}},
+		SortBy: []storage.SortField{{Name: "year"}},
+		Fields: storage.Projection{Fields: []string{"year"}, Exclude: true},
+	}
+	result, err = handler.Query(context.Background(), sortExcluded)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	expected = []interface{}{
+		map[string]interface{}{"id": ids[3], "title": "Leaves of Grass", "available": true, "genre": "poetry"},
+	}
+	if !reflect.DeepEqual(result.Items, expected) {
+		t.Fatalf("unexpected items %v", result.Items)
+	}
+}
+
+func testGetItemFields(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	included := storage.Projection{Fields: []string{"title", "publisher.country", "authors.name"}}
+	item, err := handler.GetItemFields(context.Background(), ids[1], included)
+	expected := map[string]interface{}{
+		"id":        ids[1],
+		"title":     "Dune",
+		"authors":   []interface{}{map[string]interface{}{"name": "Frank Herbert"}},
+		"publisher": map[string]interface{}{"country": "US"},
+	}
+	if err != nil || !reflect.DeepEqual(item, expected) {
+		t.Fatalf("unexpected item %v, err: %v", item, err)
+	}
+	excluded := storage.Projection{Fields: []string{"year", "genre"}, Exclude: true}
+	item, err = handler.GetItemFields(context.Background(), ids[3], excluded)
+	expected = map[string]interface{}{"id": ids[3], "title": "Leaves of Grass", "available": true}
+	if err != nil || !reflect.DeepEqual(item, expected) {
+		t.Fatalf("unexpected item %v, err: %v", item, err)
+	}
+	// the whole item is returned when the projection is empty
+	whole, _ := handler.GetItem(context.Background(), ids[1])
+	if item, _ := handler.GetItemFields(context.Background(), ids[1], storage.Projection{}); !reflect.DeepEqual(item, whole) {
+		t.Fatalf("unexpected item %v", item)
+	}
+	handler.DeleteItem(context.Background(), ids[1])
+	if _, err := handler.GetItemFields(context.Background(), ids[1], included); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+// searchTitles titles of the items found by the search, scores must be sorted in descending order
+func searchTitles(t *testing.T, handler storage.CollectionHandler, query storage.SearchQuery) []string {
+	results, err := handler.Search(context.Background(), query)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	list := []string{}
+	for i, result := range results {
+		if result.Score <= 0 || (i > 0 && result.Score > results[i-1].Score) {
+			t.Fatalf("unexpected score %f for result %d", result.Score, i)
+		}
+		if _, exists := result.Item["id"]; !exists {
+			t.Fatalf("missing id for item %v", result.Item)
+		}
+		list = append(list, result.Item["title"].(string))
+	}
+	return list
+}
+
+func testSearch(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	ids := addBooks(t, handler)
+	after1950 := storage.Filter{{Field: "year", Operator: storage.FilterGreaterThan, Value: int64(1950)}}
+	cases := []struct {
+		query    storage.SearchQuery
+		expected []string
+	}{
+		// items with the same score are sorted by ID
+		{storage.SearchQuery{Text: "fantasy"}, []string{"The Hobbit", "Good Omens"}},
+		{storage.SearchQuery{Text: "FANTASY", Skip: 1, Limit: 1}, []string{"Good Omens"}},
+		{storage.SearchQuery{Text: "fantasy", Filter: after1950}, []string{"Good Omens"}},
+		// items matching more words are more relevant
+		{storage.SearchQuery{Text: "pratchett gaiman fantasy"}, []string{"Good Omens", "The Hobbit"}},
+		{storage.SearchQuery{Text: "herbert"}, []string{"Dune"}},
+		{storage.SearchQuery{Text: "zebra"}, []string{}},
+	}
+	for _, c := range cases {
+		if list := searchTitles(t, handler, c.query); !reflect.DeepEqual(list, c.expected) {
+			t.Errorf("unexpected titles %v for search %v", list, c.query)
+		}
+	}
+
+	// the index is updated when items are modified or deleted
+	if err := handler.UpdateItem(context.Background(), ids[1], map[string]interface{}{"title": "Dune Messiah"}); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if err := handler.DeleteItem(context.Background(), ids[0]); err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if list := searchTitles(t, handler, storage.SearchQuery{Text: "messiah fantasy"}); !reflect.DeepEqual(list, []string{"Dune Messiah", "Good Omens"}) &&
+		!reflect.DeepEqual(list, []string{"Good Omens", "Dune Messiah"}) {
+		t.Fatalf("unexpected titles %v after updating items", list)
+	}
+	if list := searchTitles(t, handler, storage.SearchQuery{Text: "hobbit"}); len(list) != 0 {
+		t.Fatalf("unexpected titles %v after deleting items", list)
+	}
+}
+
+func testAggregate(t *testing.T, s storage.Storage) {
+	handler := collection(t, s, "books")
+	addBooks(t, handler)
+	query := storage.AggregateQuery{
+		GroupBy: []string{"genre"},
+		Sum:     []string{"year"},
+		Avg:     []string{"year"},
+		Min:     []string{"published"},
+		Max:     []string{"rating"},
+	}
+	groups, err := handler.Aggregate(context.Background(), query)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	// items without the group field are grouped together, missing values are ignored
+	expected := []storage.AggregateGroup{
+		{
+			Key:   map[string]interface{}{"genre": nil},
+			Count: 1,
+			Sum:   map[string]interface{}{"year": int64(0)},
+			Avg:   map[string]interface{}{"year": nil},
+			Min:   map[string]interface{}{"published": nil},
+			Max:   map[string]interface{}{"rating": nil},
+		},
+		{
+			Key:   map[string]interface{}{"genre": "fiction"},
+			Count: 3,
+			Sum:   map[string]interface{}{"year": int64(5892)},
+			Avg:   map[string]interface{}{"year": 1964.0},
+			Min:   map[string]interface{}{"published": time.Date(1937, 9, 21, 10, 30, 0, 0, time.UTC)},
+			Max:   map[string]interface{}{"rating": 4.7},
+		},
+		{
+			Key:   map[string]interface{}{"genre": "poetry"},
+			Count: 1,
+			Sum:   map[string]interface{}{"year": int64(1855)},
+			Avg:   map[string]interface{}{"year": 1855.0},
+			Min:   map[string]interface{}{"published": nil},
+			Max:   map[string]interface{}{"rating": nil},
+		},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("unexpected groups %v", groups)
+	}
+
+	// groups are sorted by all the group fields
+	fiction := storage.Filter{{Field: "genre", Operator: storage.FilterEqual, Value: "fiction"}}
+	groups, err = handler.Aggregate(context.Background(), storage.AggregateQuery{GroupBy: []string{"genre", "available"}, Filter: fiction})
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	var keys []interface{}
+	for _, group := range groups {
+		keys = append(keys, group.Key["available"])
+		if group.Count != 1 || group.Key["genre"] != "fiction" {
+			t.Fatalf("unexpected group %v", group)
+		}
+	}
+	if !reflect.DeepEqual(keys, []interface{}{nil, false, true}) {
+		t.Fatalf("unexpected group keys %v", keys)
+	}
+
+	// all the matching items are placed in a single group
+	after1900 := storage.Filter{{Field: "year", Operator: storage.FilterGreaterThan, Value: int64(1900)}}
+	groups, err = handler.Aggregate(context.Background(), storage.AggregateQuery{Sum: []string{"rating"}, Filter: after1900})
+	if err != nil || len(groups) != 1 || groups[0].Count != 3 || len(groups[0].Key) != 0 {
+		t.Fatalf("unexpected groups %v, err: %v", groups, err)
+	}
+	essay := storage.Filter{{Field: "genre", Operator: storage.FilterEqual, Value: "essay"}}
+	if groups, err = handler.Aggregate(context.Background(), storage.AggregateQuery{Filter: essay}); err != nil || len(groups) != 0 {
+		t.Fatalf("unexpected groups %v, err: %v", groups, err)
+	}
+
+	// integer sums keep their precision beyond the float64 range of exact integers
+	for _, year := range []int64{1<<53 - 1, 2} {
+		if _, err := handler.AddItem(context.Background(), map[string]interface{}{"title": fmt.Sprint(year), "genre": "essay", "year": year}); err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+	}
+	groups, err = handler.Aggregate(context.Background(), storage.AggregateQuery{Sum: []string{"year"}, Filter: essay})
+	if err != nil || len(groups) != 1 || groups[0].Sum["year"] != int64(1<<53+1) {
+		t.Fatalf("unexpected groups %v, err: %v", groups, err)
+	}
+}
@@ -25,10 +25,11 @@ func main() {
 
 	port := mk_os.GetEnv("SERVER_PORT", "80")
 	storageType := mk_os.GetEnv("STORAGE_TYPE", server.StorageTypeMongoDB)
+	server.StorageTimeout = mk_os.GetDurationEnv("STORAGE_TIMEOUT", server.StorageTimeout)
 
 	server.InitStorage(readManifest(), storageType)
 
-	mainRoute := mux.NewRouter().PathPrefix("/api/").Subrouter()
+	mainRoute := mux.NewRouter().PathPrefix(server.APIPathPrefix).Subrouter()
 	addListRoutesEndpoint(mainRoute)
 	addAPIRoutes(mainRoute)
 
@@ -80,10 +81,19 @@ func addAPIRoutes(router *mux.Router) {
 		log.Debugf("adding routes for collection '%s'", collection.Name)
 		apiRoute := router.PathPrefix(fmt.Sprintf("/%s/", collection.Name)).Subrouter()
 		apiRoute.Use(server.ValidateID(collection))
+		// registered before the item routes, otherwise "_search" and "_aggregate" would be handled as item IDs
+		apiRoute.HandleFunc("/_search", server.SearchHandler(collection)).Methods(http.MethodGet)
+		apiRoute.HandleFunc("/_aggregate", server.AggregateHandler(collection)).Methods(http.MethodGet)
 		apiRoute.HandleFunc("/{id}", server.GetHandler(collection)).Methods(http.MethodGet)
 		apiRoute.HandleFunc("/", server.ParseBody(server.PutHandler(collection))).Methods(http.MethodPut)
+		// registered before the item routes, otherwise "_bulk" and "_update" would be handled as item IDs
+		apiRoute.HandleFunc("/_bulk", server.ParseBulk(server.BulkHandler(collection))).Methods(http.MethodPost)
+		apiRoute.HandleFunc("/_update", server.ParseBody(server.UpdateManyHandler(collection))).Methods(http.MethodPost)
 		apiRoute.HandleFunc("/{id}", server.ParseBody(server.PostHandler(collection))).Methods(http.MethodPost)
+		apiRoute.HandleFunc("/{id}", server.ParseBody(server.ReplaceHandler(collection))).Methods(http.MethodPut)
+		apiRoute.HandleFunc("/{id}", server.ParsePatch(server.PatchHandler(collection))).Methods(http.MethodPatch)
 		apiRoute.HandleFunc("/{id}", server.DeleteHandler(collection)).Methods(http.MethodDelete)
 		apiRoute.HandleFunc("/", server.ListCollectionHandler(collection)).Methods(http.MethodGet)
+		apiRoute.HandleFunc("/", server.DeleteManyHandler(collection)).Methods(http.MethodDelete)
 	}
 }
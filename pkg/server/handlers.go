@@ -1,25 +1,52 @@
 package server
 
 import (
+	stdcontext "context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/context"
 	log "github.com/sirupsen/logrus"
 	"monkiato/apio/internal/data"
+	"monkiato/apio/internal/patch"
 	"monkiato/apio/internal/storage"
 	"net/http"
-	"strconv"
 )
 
 const (
-	defaultLimit = 20
-	maxLimit     = 100
+	invalidItemDataMsg = "invalid item data"
+	// ndjsonContentType media type for newline delimited JSON, accepted by the bulk endpoint
+	ndjsonContentType = "application/x-ndjson"
+	// maxBulkOperations max amount of operations accepted in a single bulk request
+	maxBulkOperations = 1000
 )
 
+// bulkOperation single operation sent to the bulk endpoint
+type bulkOperation struct {
+	Op   string                 `json:"op"`
+	ID   string                 `json:"id,omitempty"`
+	Item map[string]interface{} `json:"item,omitempty"`
+}
+
 // GetHandler used to handle GET requests, the collectionDefinition is provided based on the endpoint being called
 func GetHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// handle GET for collection
-		item := context.Get(r, "item")
+		fields, err := parseFieldsParam(r.URL.Query().Get("fields"), collectionDefinition)
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// the projection is applied by the storage, so only the requested fields are fetched
+		id := context.Get(r, "id").(string)
+		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		item, err := storageCollection.GetItemFields(ctx, id, fields)
+		if err != nil {
+			addStorageErrorResponse(w, err, "can't fetch item")
+			return
+		}
 		data, err := json.Marshal(item)
 		if err != nil {
 			log.Error(err.Error())
@@ -38,17 +65,15 @@ func PutHandler(collectionDefinition data.CollectionDefinition) func(http.Respon
 		item := context.Get(r, "parsedBody").(map[string]interface{})
 
 		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
-		if !collectionDefinition.IsDataValid(item) {
-			addErrorResponse(w, http.StatusBadRequest, "invalid item data, no matching collection definition")
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		if !isBodyIDValid(w, r, item, "") || !isCompleteItemValid(w, r, collectionDefinition, item) {
 			return
 		}
-		if id, err := storageCollection.AddItem(item); err != nil {
-			log.Error(err.Error())
-			addErrorResponse(w, http.StatusInternalServerError, "can't add new item")
+		if id, err := storageCollection.AddItem(ctx, item); err != nil {
+			addStorageErrorResponse(w, err, "can't add new item")
 		} else {
-			addSuccessResponse(w, http.StatusCreated, map[string]interface{}{
-				"id": id,
-			})
+			addWriteResponse(ctx, w, r, collectionDefinition, http.StatusCreated, id)
 		}
 	}
 }
@@ -61,84 +86,560 @@ func PostHandler(collectionDefinition data.CollectionDefinition) func(http.Respo
 		newItem := context.Get(r, "parsedBody").(map[string]interface{})
 
 		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
-		if !collectionDefinition.IsDataValid(newItem) {
-			addErrorResponse(w, http.StatusBadRequest, "invalid item data, no matching collection definition")
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		if !isBodyIDValid(w, r, newItem, id) {
+			return
+		}
+		if fieldErrors := collectionDefinition.Validate(newItem); len(fieldErrors) > 0 {
+			addValidationErrorResponse(w, r, http.StatusBadRequest, invalidItemDataMsg, fieldErrors)
 			return
 		}
+		collectionDefinition.ToNative(newItem)
 
-		if _, found := storageCollection.GetItem(id); !found {
-			log.Errorf("item '%s' not found", id)
-			addErrorResponse(w, http.StatusBadRequest, "item not found")
+		if err := storageCollection.UpdateItem(ctx, id, newItem); err != nil {
+			addStorageErrorResponse(w, err, "can't update item")
 			return
 		}
 
-		if err := storageCollection.UpdateItem(id, newItem); err != nil {
-			log.Error(err.Error())
-			addErrorResponse(w, http.StatusInternalServerError, "can't update item")
+		addWriteResponse(ctx, w, r, collectionDefinition, http.StatusOK, id)
+	}
+}
+
+// ReplaceHandler used to handle PUT requests over an item, the whole item content is replaced and the item is
+// created if it doesn't exist.
+// The collectionDefinition is provided based on the endpoint being called
+func ReplaceHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// handle PUT for collection item
+		id := context.Get(r, "id").(string)
+		newItem := context.Get(r, "parsedBody").(map[string]interface{})
+
+		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		if !isBodyIDValid(w, r, newItem, id) || !isCompleteItemValid(w, r, collectionDefinition, newItem) {
 			return
 		}
 
-		addSuccessResponse(w, http.StatusOK, map[string]interface{}{
-			"id": id,
+		created, err := storageCollection.UpsertItem(ctx, id, newItem)
+		if err != nil {
+			addStorageErrorResponse(w, err, "can't replace item")
+			return
+		}
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		addWriteResponse(ctx, w, r, collectionDefinition, status, id)
+	}
+}
+
+// PatchHandler used to handle PATCH requests, the patch is applied over the current item and the result replaces
+// the item content. The storage applies the patch atomically, so concurrent writes are never lost.
+// The collectionDefinition is provided based on the endpoint being called
+func PatchHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// handle PATCH for collection item
+		id := context.Get(r, "id").(string)
+		itemPatch := context.Get(r, "parsedPatch").(patch.Patch)
+
+		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		err := storageCollection.PatchItem(ctx, id, func(item map[string]interface{}) (map[string]interface{}, error) {
+			return applyPatch(collectionDefinition, itemPatch, item, id)
 		})
+		var problem *patchProblem
+		if errors.As(err, &problem) && len(problem.fields) > 0 {
+			addValidationErrorResponse(w, r, problem.status, problem.msg, problem.fields)
+			return
+		}
+		if errors.As(err, &problem) {
+			addErrorResponse(w, problem.status, problem.msg)
+			return
+		}
+		if err != nil {
+			addStorageErrorResponse(w, err, "can't update item")
+			return
+		}
+
+		addWriteResponse(ctx, w, r, collectionDefinition, http.StatusOK, id)
 	}
 }
 
+// patchProblem error returned when the patch can't be applied or the patched item isn't valid, it aborts the storage
+// operation and it's reported with the status and the validation errors
+type patchProblem struct {
+	status int
+	msg    string
+	fields []data.FieldError
+}
+
+func (p *patchProblem) Error() string {
+	return p.msg
+}
+
+// applyPatch apply the patch over the current item and validate the result, the item is converted to the storage
+// native types
+func applyPatch(collectionDefinition data.CollectionDefinition, itemPatch patch.Patch, item map[string]interface{}, itemID string) (map[string]interface{}, error) {
+	// patch is applied over the JSON representation, e.g. dates are formatted strings
+	patchedItem, err := itemPatch.Apply(toJSONValue(item))
+	if err != nil {
+		return nil, &patchProblem{status: http.StatusUnprocessableEntity, msg: "can't apply patch. error: " + err.Error()}
+	}
+	newItem, ok := patchedItem.(map[string]interface{})
+	if !ok {
+		return nil, &patchProblem{status: http.StatusBadRequest, msg: "invalid item data, object expected"}
+	}
+	fieldErrors := validateBodyID(newItem, itemID)
+	if len(fieldErrors) == 0 {
+		fieldErrors = collectionDefinition.ValidateComplete(newItem)
+	}
+	if len(fieldErrors) > 0 {
+		return nil, &patchProblem{status: http.StatusBadRequest, msg: invalidItemDataMsg, fields: fieldErrors}
+	}
+	collectionDefinition.ToNative(newItem)
+	return newItem, nil
+}
+
 // DeleteHandler used to handle DELETE requests, the collectionDefinition is provided based on the endpoint being called
 func DeleteHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// handle DELEte for collection
 		id := context.Get(r, "id").(string)
 		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		ctx, cancel := storageContext(r)
+		defer cancel()
 
-		if _, found := storageCollection.GetItem(id); !found {
-			log.Errorf("item '%s' not found", id)
-			addErrorResponse(w, http.StatusBadRequest, "item not found")
+		if err := storageCollection.DeleteItem(ctx, id); err != nil {
+			addStorageErrorResponse(w, err, "can't delete item")
 			return
 		}
 
-		if err := storageCollection.DeleteItem(id); err != nil {
-			log.Error(err.Error())
-			addErrorResponse(w, http.StatusInternalServerError, "can't delete item")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// BulkHandler used to handle POST requests with a batch of create, update and delete operations. Each operation is
+// validated on its own and the valid ones are executed in a single storage batch. The results are returned in the
+// same order, using the status code a single request for the operation would get
+func BulkHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operations := context.Get(r, "parsedOperations").([]bulkOperation)
+
+		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		ctx, cancel := storageContext(r)
+		defer cancel()
+
+		results := make([]map[string]interface{}, len(operations))
+		var storageOperations []storage.BulkOperation
+		// result index for each storage operation
+		var storageIndexes []int
+		for i, operation := range operations {
+			results[i] = map[string]interface{}{"op": operation.Op}
+			if operation.ID != "" {
+				results[i]["id"] = operation.ID
+			}
+			storageOperation, problem := toStorageBulkOperation(collectionDefinition, storageCollection, operation)
+			if problem != nil {
+				results[i]["status"] = http.StatusBadRequest
+				results[i]["error"] = problem
+				continue
+			}
+			storageOperations = append(storageOperations, storageOperation)
+			storageIndexes = append(storageIndexes, i)
+		}
+
+		storageResults, err := storageCollection.BulkWrite(ctx, storageOperations)
+		if err != nil {
+			addStorageErrorResponse(w, err, "can't execute bulk operations")
 			return
 		}
+		for n, storageResult := range storageResults {
+			result := results[storageIndexes[n]]
+			if storageResult.ID != "" {
+				result["id"] = storageResult.ID
+			}
+			if storageResult.Err != nil {
+				status, msg := storageErrorStatus(storageResult.Err, "can't execute operation")
+				result["status"] = status
+				result["error"] = map[string]interface{}{"msg": msg}
+				continue
+			}
+			switch storageOperations[n].Type {
+			case storage.BulkCreate:
+				result["status"] = http.StatusCreated
+			case storage.BulkUpdate:
+				result["status"] = http.StatusOK
+			case storage.BulkDelete:
+				result["status"] = http.StatusNoContent
+			}
+		}
 
-		w.WriteHeader(http.StatusNoContent)
+		failed := 0
+		for _, result := range results {
+			if result["status"].(int) >= http.StatusBadRequest {
+				failed++
+			}
+		}
+		addSuccessResponse(w, http.StatusOK, map[string]interface{}{
+			"results": results,
+			"failed":  failed,
+		})
 	}
 }
 
+// bulkOperationProblem validation problem found for a bulk operation, it has the same format used by error responses
+type bulkOperationProblem struct {
+	Msg    string            `json:"msg"`
+	Fields []data.FieldError `json:"fields,omitempty"`
+}
+
+// toStorageBulkOperation validates the operation the same way a single request would do, and converts the item to
+// the storage native types
+func toStorageBulkOperation(collectionDefinition data.CollectionDefinition, storageCollection storage.CollectionHandler, operation bulkOperation) (storage.BulkOperation, *bulkOperationProblem) {
+	storageOperation := storage.BulkOperation{
+		Type: storage.BulkOperationType(operation.Op),
+		ID:   operation.ID,
+		Item: operation.Item,
+	}
+	switch storageOperation.Type {
+	case storage.BulkCreate, storage.BulkUpdate:
+		if operation.Item == nil {
+			return storageOperation, &bulkOperationProblem{Msg: "missing operation item"}
+		}
+	case storage.BulkDelete:
+	default:
+		return storageOperation, &bulkOperationProblem{Msg: fmt.Sprintf("unknown operation '%s'", operation.Op)}
+	}
+	if operation.ID == "" && storageOperation.Type != storage.BulkCreate {
+		return storageOperation, &bulkOperationProblem{Msg: "missing operation id"}
+	}
+	if operation.ID != "" {
+		if err := storageCollection.ValidateID(operation.ID); err != nil {
+			return storageOperation, &bulkOperationProblem{Msg: storage.ErrInvalidID.Error()}
+		}
+	}
+	if storageOperation.Type == storage.BulkDelete {
+		return storageOperation, nil
+	}
+
+	fieldErrors := validateBodyID(operation.Item, operation.ID)
+	if len(fieldErrors) == 0 && storageOperation.Type == storage.BulkCreate {
+		fieldErrors = collectionDefinition.ValidateComplete(operation.Item)
+	} else if len(fieldErrors) == 0 {
+		fieldErrors = collectionDefinition.Validate(operation.Item)
+	}
+	if len(fieldErrors) > 0 {
+		return storageOperation, &bulkOperationProblem{Msg: invalidItemDataMsg, Fields: fieldErrors}
+	}
+	collectionDefinition.ToNative(operation.Item)
+	return storageOperation, nil
+}
+
+// UpdateManyHandler used to handle POST requests updating all the items matching the filter in the query params, only
+// the fields in the request body are updated. A filter is required so the whole collection is never updated by
+// mistake, use 'dry_run' to get the amount of matching items without updating them
+func UpdateManyHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item := context.Get(r, "parsedBody").(map[string]interface{})
+
+		filter, dryRun, err := parseMatchingParams(r.URL.Query(), collectionDefinition)
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !isBodyIDValid(w, r, item, "") {
+			return
+		}
+		if fieldErrors := collectionDefinition.Validate(item); len(fieldErrors) > 0 {
+			addValidationErrorResponse(w, r, http.StatusBadRequest, invalidItemDataMsg, fieldErrors)
+			return
+		}
+		collectionDefinition.ToNative(item)
+
+		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		if dryRun {
+			addMatchedResponse(ctx, w, storageCollection, filter)
+			return
+		}
+		updated, err := storageCollection.UpdateMany(ctx, filter, item)
+		if err != nil {
+			addStorageErrorResponse(w, err, "can't update items")
+			return
+		}
+		addSuccessResponse(w, http.StatusOK, map[string]interface{}{
+			"updated": updated,
+		})
+	}
+}
+
+// DeleteManyHandler used to handle DELETE requests removing all the items matching the filter in the query params.
+// A filter is required so the whole collection is never deleted by mistake, use 'dry_run' to get the amount of
+// matching items without deleting them
+func DeleteManyHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, dryRun, err := parseMatchingParams(r.URL.Query(), collectionDefinition)
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		if dryRun {
+			addMatchedResponse(ctx, w, storageCollection, filter)
+			return
+		}
+		deleted, err := storageCollection.DeleteMany(ctx, filter)
+		if err != nil {
+			addStorageErrorResponse(w, err, "can't delete items")
+			return
+		}
+		addSuccessResponse(w, http.StatusOK, map[string]interface{}{
+			"deleted": deleted,
+		})
+	}
+}
+
+// addMatchedResponse responds to a dry run request with the amount of items matching the filter
+func addMatchedResponse(ctx stdcontext.Context, w http.ResponseWriter, storageCollection storage.CollectionHandler, filter storage.Filter) {
+	matched, err := storageCollection.Count(ctx, filter)
+	if err != nil {
+		addStorageErrorResponse(w, err, "unable to count items from DB")
+		return
+	}
+	addSuccessResponse(w, http.StatusOK, map[string]interface{}{
+		"matched": matched,
+	})
+}
+
 // ListCollectionHandler used to get a list of items in the collection using pagination
 func ListCollectionHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		queryParams := r.URL.Query()
-		skip, skipErr := strconv.ParseInt(queryParams.Get("skip"), 10, 64)
-		limit, limitErr := strconv.ParseInt(queryParams.Get("limit"), 10, 64)
-		if skipErr != nil || skip < 0 {
-			skip = 0
+		query, err := parseQueryParams(r.URL.Query(), collectionDefinition, listParams)
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		result, err := storageCollection.Query(ctx, query)
+		if err != nil {
+			addStorageErrorResponse(w, err, "unable to obtain items from DB")
+			return
+		}
+		total, err := storageCollection.Count(ctx, query.Filter)
+		if err != nil {
+			addStorageErrorResponse(w, err, "unable to count items from DB")
+			return
+		}
+		data, err := json.Marshal(result.Items)
+		if err != nil {
+			log.Error(err.Error())
+			addErrorResponse(w, http.StatusInternalServerError, "unable to parse items list data")
+			return
+		}
+		addPaginationHeaders(w, r, query, result, total)
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	}
+}
+
+// SearchHandler used to handle full text search requests, the 'q' param is searched in the searchable fields and the
+// matching items are returned sorted by relevance, including their score. Filters, pagination with skip and limit,
+// and fields params are supported the same way they are for lists
+func SearchHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(collectionDefinition.SearchableFields()) == 0 {
+			addErrorResponse(w, http.StatusBadRequest, "the collection has no searchable fields")
+			return
+		}
+		text := r.URL.Query().Get("q")
+		if text == "" {
+			addErrorResponse(w, http.StatusBadRequest, "missing search text 'q'")
+			return
 		}
-		if limitErr != nil || limit <= 0 {
-			limit = defaultLimit
+		query, err := parseQueryParams(r.URL.Query(), collectionDefinition, searchParams)
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
 		}
-		if limit > maxLimit {
-			limit = maxLimit
+		if len(query.SortBy) > 0 || query.After != nil {
+			addErrorResponse(w, http.StatusBadRequest, "search results are sorted by relevance, sort and cursor are not supported")
+			return
 		}
 		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
-		items, err := storageCollection.Query(storage.QueryParams{
-			Skip:  skip,
-			Limit: limit,
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		results, err := storageCollection.Search(ctx, storage.SearchQuery{
+			Text:   text,
+			Filter: query.Filter,
+			Skip:   query.Skip,
+			Limit:  query.Limit,
 		})
+		if err != nil {
+			addStorageErrorResponse(w, err, "unable to search items from DB")
+			return
+		}
+		response := make([]map[string]interface{}, len(results))
+		for i, result := range results {
+			response[i] = map[string]interface{}{
+				"score": result.Score,
+				"item":  query.Fields.Apply(result.Item),
+			}
+		}
+		data, err := json.Marshal(response)
 		if err != nil {
 			log.Error(err.Error())
-			addErrorResponse(w, http.StatusInternalServerError, "unable to obtain items from DB")
+			addErrorResponse(w, http.StatusInternalServerError, "unable to parse search results data")
 			return
 		}
-		data, err := json.Marshal(items)
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	}
+}
+
+// AggregateHandler used to handle aggregation requests, the items matching the filters are grouped by the 'group'
+// fields and the requested values are computed for each group. Groups are returned sorted by their values
+func AggregateHandler(collectionDefinition data.CollectionDefinition) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseAggregateParams(r.URL.Query(), collectionDefinition)
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		ctx, cancel := storageContext(r)
+		defer cancel()
+		groups, err := storageCollection.Aggregate(ctx, query)
+		if err != nil {
+			addStorageErrorResponse(w, err, "unable to aggregate items from DB")
+			return
+		}
+		response := make([]map[string]interface{}, len(groups))
+		for i, group := range groups {
+			response[i] = map[string]interface{}{
+				"group": group.Key,
+				"count": group.Count,
+			}
+			// only the requested values are included
+			for name, values := range map[string]map[string]interface{}{"sum": group.Sum, "avg": group.Avg, "min": group.Min, "max": group.Max} {
+				if len(values) > 0 {
+					response[i][name] = values
+				}
+			}
+		}
+		data, err := json.Marshal(response)
 		if err != nil {
 			log.Error(err.Error())
-			addErrorResponse(w, http.StatusInternalServerError, "unable to parse items list data")
+			addErrorResponse(w, http.StatusInternalServerError, "unable to parse aggregation data")
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 		w.Write(data)
 	}
 }
+
+// isCompleteItemValid validates a whole item content, used when items are created or replaced. Default values are
+// applied for missing fields before checking the required ones, and valid items are converted to the storage native
+// types. An error response listing all the invalid fields is added if the item is not valid
+func isCompleteItemValid(w http.ResponseWriter, r *http.Request, collectionDefinition data.CollectionDefinition, item map[string]interface{}) bool {
+	if fieldErrors := collectionDefinition.ValidateComplete(item); len(fieldErrors) > 0 {
+		addValidationErrorResponse(w, r, http.StatusBadRequest, invalidItemDataMsg, fieldErrors)
+		return false
+	}
+	collectionDefinition.ToNative(item)
+	return true
+}
+
+// isBodyIDValid removes the item ID from the request body, items returned by the api include it so they can be sent
+// back as they are. The ID can't be modified, a body ID different to the item ID is rejected with a validation error
+// response. The itemID is empty when the item is created with an ID generated by the storage
+func isBodyIDValid(w http.ResponseWriter, r *http.Request, item map[string]interface{}, itemID string) bool {
+	if fieldErrors := validateBodyID(item, itemID); len(fieldErrors) > 0 {
+		addValidationErrorResponse(w, r, http.StatusBadRequest, invalidItemDataMsg, fieldErrors)
+		return false
+	}
+	return true
+}
+
+// validateBodyID removes the item ID from the item content, a problem is returned if the ID doesn't match itemID
+func validateBodyID(item map[string]interface{}, itemID string) []data.FieldError {
+	bodyID, found := item[data.IDField]
+	if !found {
+		return nil
+	}
+	if itemID == "" || bodyID != itemID {
+		return []data.FieldError{
+			{Field: data.IDField, Code: data.ErrorCodeReadOnly, Message: "the item ID can't be modified"},
+		}
+	}
+	delete(item, data.IDField)
+	return nil
+}
+
+// addStorageErrorResponse error response for a failed storage operation, the status depends on the error cause:
+// 404 for missing items, 409 for conflicts with existing items, 400 for invalid IDs and 503 when the storage is
+// unavailable. Any other error is reported with 500 status and the specified message
+func addStorageErrorResponse(w http.ResponseWriter, err error, msg string) {
+	status, msg := storageErrorStatus(err, msg)
+	addErrorResponse(w, status, msg)
+}
+
+// storageErrorStatus status code and error message used to report a failed storage operation, the specified message
+// is used for unknown errors
+func storageErrorStatus(err error, msg string) (int, string) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		log.Debug(err.Error())
+		return http.StatusNotFound, storage.ErrNotFound.Error()
+	case errors.Is(err, storage.ErrConflict):
+		log.Debug(err.Error())
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, storage.ErrInvalidID):
+		log.Debug(err.Error())
+		return http.StatusBadRequest, storage.ErrInvalidID.Error()
+	case errors.Is(err, storage.ErrUnavailable):
+		log.Error(err.Error())
+		return http.StatusServiceUnavailable, storage.ErrUnavailable.Error()
+	}
+	log.Error(err.Error())
+	return http.StatusInternalServerError, msg
+}
+
+// addWriteResponse responds to a write request with the item ID, and the stored item when the client prefers it.
+// Created items include the 'Location' header. The item is fetched after the write, so defaults and normalized
+// values are included, if fetching it fails the preference is ignored since the write already succeeded
+func addWriteResponse(ctx stdcontext.Context, w http.ResponseWriter, r *http.Request, collectionDefinition data.CollectionDefinition, status int, id string) {
+	if status == http.StatusCreated {
+		w.Header().Set("Location", itemLocation(collectionDefinition, id))
+	}
+	response := map[string]interface{}{
+		"id": id,
+	}
+	if prefersRepresentation(r) {
+		storageCollection, _ := Storage.GetCollection(collectionDefinition.Name)
+		if item, err := storageCollection.GetItem(ctx, id); err != nil {
+			log.Errorf("unable to fetch stored item %s.%s. err: %s", collectionDefinition.Name, id, err.Error())
+		} else {
+			response["item"] = item
+			w.Header().Set("Preference-Applied", returnRepresentation)
+		}
+	}
+	addSuccessResponse(w, status, response)
+}
+
+// toJSONValue get the JSON representation for a value obtained from a storage
+func toJSONValue(value interface{}) interface{} {
+	var jsonValue interface{}
+	encoded, _ := json.Marshal(value)
+	json.Unmarshal(encoded, &jsonValue)
+	return jsonValue
+}
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"bytes"
+	stdcontext "context"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/context"
 	"io/ioutil"
 	"monkiato/apio/internal/data"
+	"monkiato/apio/internal/patch"
+	"monkiato/apio/internal/storage"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -23,6 +27,7 @@ type TestCase struct {
 	id                        string
 	item                      map[string]interface{}
 	parsedBody                map[string]interface{}
+	parsedPatch               patch.Patch
 	responseBodyInvalidFormat bool
 	expectedStatus            int
 	expectedData              interface{}
@@ -31,11 +36,11 @@ type TestCase struct {
 func createCollectionDefinition() data.CollectionDefinition {
 	return data.CollectionDefinition{
 		Name: "books",
-		Fields: map[string]string{
-			"name":      "string",
-			"lastname":  "string",
-			"age":       "float",
-			"is_active": "bool",
+		Fields: map[string]data.FieldDefinition{
+			"name":      {Type: "string"},
+			"lastname":  {Type: "string"},
+			"age":       {Type: "float"},
+			"is_active": {Type: "bool"},
 		},
 	}
 }
@@ -73,16 +78,56 @@ func TestGetHandler_responses(t *testing.T) {
 		t.Fatalf("unexpected null handler")
 	}
 
+	InitStorage(createManifest(t), StorageTypeMemory)
+
+	collection, _ := Storage.GetCollection("books")
+	collection.InsertItem(stdcontext.Background(), testItemId, createCollectionItem())
+	expectedItem := createCollectionItem()
+	expectedItem["id"] = testItemId
+
 	cases := []TestCase{
 		{
 			description:               "should succeed to fetch item",
 			methodType:                http.MethodGet,
 			endpoint:                  "/api/books/" + testItemId,
 			id:                        testItemId,
-			item:                      createCollectionItem(),
 			responseBodyInvalidFormat: false,
 			expectedStatus:            http.StatusOK,
-			expectedData:              createCollectionItem(),
+			expectedData:              expectedItem,
+		},
+		{
+			description:    "should only include the requested fields",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/" + testItemId + "?fields=name,age",
+			id:             testItemId,
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]interface{}{
+				"id":   testItemId,
+				"name": "Bob",
+				"age":  20.0,
+			},
+		},
+		{
+			description:    "should fail due to unknown field",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/" + testItemId + "?fields=-pages",
+			id:             testItemId,
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error":   map[string]interface{}{"msg": "invalid field 'pages'"},
+				"success": false,
+			},
+		},
+		{
+			description:    "should fail due to item not found in storage",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/100",
+			id:             "100",
+			expectedStatus: http.StatusNotFound,
+			expectedData: map[string]interface{}{
+				"error":   map[string]interface{}{"msg": "item not found"},
+				"success": false,
+			},
 		},
 	}
 
@@ -121,7 +166,10 @@ func TestPutHandler(t *testing.T) {
 			expectedStatus:            http.StatusBadRequest,
 			expectedData: map[string]interface{}{
 				"error": map[string]interface{}{
-					"msg": "invalid item data, no matching collection definition",
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "bad", "code": "unknown_field", "message": "unknown field"},
+					},
 				},
 				"success": false,
 			},
@@ -140,14 +188,153 @@ func TestPutHandler(t *testing.T) {
 			expectedStatus:            http.StatusBadRequest,
 			expectedData: map[string]interface{}{
 				"error": map[string]interface{}{
-					"msg": "invalid item data, no matching collection definition",
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "age", "code": "invalid_type", "message": "invalid value, float expected"},
+					},
+				},
+				"success": false,
+			},
+		},
+	}
+
+	runTestCases(t, handler, cases)
+}
+
+func TestPutHandler_requiredFields(t *testing.T) {
+	collectionDefinition := data.CollectionDefinition{
+		Name: "books",
+		Fields: map[string]data.FieldDefinition{
+			"title":  {Type: "string", Required: true},
+			"author": {Type: "string", Required: true},
+			"status": {Type: "string", Required: true, Default: "available"},
+		},
+	}
+	handler := PutHandler(collectionDefinition)
+
+	manifest, _ := json.Marshal([]data.CollectionDefinition{collectionDefinition})
+	InitStorage(string(manifest), StorageTypeMemory)
+
+	cases := []TestCase{
+		{
+			description:               "should fail due to missing required fields",
+			methodType:                http.MethodPut,
+			endpoint:                  "/api/books/",
+			parsedBody:                map[string]interface{}{},
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "author", "code": "required", "message": "field is required"},
+						map[string]interface{}{"field": "title", "code": "required", "message": "field is required"},
+					},
 				},
 				"success": false,
 			},
 		},
+		{
+			description:               "should succeed and apply default values",
+			methodType:                http.MethodPut,
+			endpoint:                  "/api/books/",
+			parsedBody:                map[string]interface{}{"title": "The Hobbit", "author": "Tolkien"},
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusCreated,
+			expectedData: map[string]interface{}{
+				"data": map[string]interface{}{
+					"id": "1",
+				},
+				"success": true,
+			},
+		},
 	}
 
 	runTestCases(t, handler, cases)
+
+	collection, _ := Storage.GetCollection("books")
+	item, _ := collection.GetItem(stdcontext.Background(), "1")
+	if item.(map[string]interface{})["status"] != "available" {
+		t.Fatalf("unexpected item data %v", item)
+	}
+}
+
+func TestPutHandler_uniqueFields(t *testing.T) {
+	collectionDefinition := data.CollectionDefinition{
+		Name: "people",
+		Fields: map[string]data.FieldDefinition{
+			"email": {Type: "email", Unique: true},
+		},
+	}
+	handler := PutHandler(collectionDefinition)
+
+	manifest, _ := json.Marshal([]data.CollectionDefinition{collectionDefinition})
+	InitStorage(string(manifest), StorageTypeMemory)
+
+	cases := []TestCase{
+		{
+			description:    "should succeed",
+			methodType:     http.MethodPut,
+			endpoint:       "/api/people/",
+			parsedBody:     map[string]interface{}{"email": "bob@example.com"},
+			expectedStatus: http.StatusCreated,
+			expectedData: map[string]interface{}{
+				"data": map[string]interface{}{
+					"id": "1",
+				},
+				"success": true,
+			},
+		},
+		{
+			description:    "should fail due to duplicated unique value",
+			methodType:     http.MethodPut,
+			endpoint:       "/api/people/",
+			parsedBody:     map[string]interface{}{"email": "bob@example.com"},
+			expectedStatus: http.StatusConflict,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "item conflict: duplicated value for unique field 'email'",
+				},
+				"success": false,
+			},
+		},
+	}
+
+	runTestCases(t, handler, cases)
+}
+
+func TestPutHandler_returnRepresentation(t *testing.T) {
+	collectionDefinition := data.CollectionDefinition{
+		Name: "books",
+		Fields: map[string]data.FieldDefinition{
+			"title":  {Type: "string", Required: true},
+			"status": {Type: "string", Required: true, Default: "available"},
+		},
+	}
+	manifest, _ := json.Marshal([]data.CollectionDefinition{collectionDefinition})
+	InitStorage(string(manifest), StorageTypeMemory)
+
+	for i, endpoint := range []string{"/api/books/", "/api/books/?return=item"} {
+		req := httptest.NewRequest(http.MethodPut, endpoint, nil)
+		if i == 0 {
+			req.Header.Set("Prefer", "respond-async, return=representation")
+		}
+		context.Set(req, "parsedBody", map[string]interface{}{"title": "The Hobbit"})
+		w := httptest.NewRecorder()
+		PutHandler(collectionDefinition)(w, req)
+
+		id := fmt.Sprintf("%d", i+1)
+		if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/books/"+id {
+			t.Fatalf("unexpected response %d, location '%s'", w.Code, w.Header().Get("Location"))
+		}
+		if w.Header().Get("Preference-Applied") != "return=representation" {
+			t.Fatalf("unexpected preference applied '%s'", w.Header().Get("Preference-Applied"))
+		}
+		expected := `{"data":{"id":"` + id + `","item":{"id":"` + id + `","status":"available","title":"The Hobbit"}},"success":true}`
+		if w.Body.String() != expected {
+			t.Fatalf("unexpected body %s", w.Body.String())
+		}
+	}
 }
 
 func TestPostHandler(t *testing.T) {
@@ -159,7 +346,7 @@ func TestPostHandler(t *testing.T) {
 	InitStorage(createManifest(t), StorageTypeMemory)
 
 	collection, _ := Storage.GetCollection("books")
-	itemId, _ := collection.AddItem(map[string]interface{}{
+	itemId, _ := collection.AddItem(stdcontext.Background(), map[string]interface{}{
 		"name":      "old name",
 		"lastname":  "old lastname",
 		"age":       5,
@@ -189,7 +376,7 @@ func TestPostHandler(t *testing.T) {
 			id:                        "100",
 			parsedBody:                createCollectionItem(),
 			responseBodyInvalidFormat: false,
-			expectedStatus:            http.StatusBadRequest,
+			expectedStatus:            http.StatusNotFound,
 			expectedData: map[string]interface{}{
 				"error": map[string]interface{}{
 					"msg": "item not found",
@@ -207,7 +394,10 @@ func TestPostHandler(t *testing.T) {
 			expectedStatus:            http.StatusBadRequest,
 			expectedData: map[string]interface{}{
 				"error": map[string]interface{}{
-					"msg": "invalid item data, no matching collection definition",
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "bad", "code": "unknown_field", "message": "unknown field"},
+					},
 				},
 				"success": false,
 			},
@@ -227,7 +417,10 @@ func TestPostHandler(t *testing.T) {
 			expectedStatus:            http.StatusBadRequest,
 			expectedData: map[string]interface{}{
 				"error": map[string]interface{}{
-					"msg": "invalid item data, no matching collection definition",
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "age", "code": "invalid_type", "message": "invalid value, float expected"},
+					},
 				},
 				"success": false,
 			},
@@ -237,6 +430,166 @@ func TestPostHandler(t *testing.T) {
 	runTestCases(t, handler, cases)
 }
 
+func TestReplaceHandler(t *testing.T) {
+	handler := ReplaceHandler(createCollectionDefinition())
+	if handler == nil {
+		t.Fatalf("unexpected null handler")
+	}
+
+	InitStorage(createManifest(t), StorageTypeMemory)
+
+	collection, _ := Storage.GetCollection("books")
+	itemId, _ := collection.AddItem(stdcontext.Background(), createCollectionItem())
+
+	cases := []TestCase{
+		{
+			description:               "should succeed and replace item",
+			methodType:                http.MethodPut,
+			endpoint:                  "/api/books/" + itemId,
+			id:                        itemId,
+			parsedBody:                map[string]interface{}{"name": "new name"},
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusOK,
+			expectedData: map[string]interface{}{
+				"data": map[string]interface{}{
+					"id": "1",
+				},
+				"success": true,
+			},
+		},
+		{
+			description:               "should fail due to wrong item structure",
+			methodType:                http.MethodPut,
+			endpoint:                  "/api/books/" + itemId,
+			id:                        itemId,
+			parsedBody:                map[string]interface{}{"bad": "structure"},
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "bad", "code": "unknown_field", "message": "unknown field"},
+					},
+				},
+				"success": false,
+			},
+		},
+	}
+
+	runTestCases(t, handler, cases)
+
+	item, _ := collection.GetItem(stdcontext.Background(), itemId)
+	if !reflect.DeepEqual(item, map[string]interface{}{"id": itemId, "name": "new name"}) {
+		t.Fatalf("unexpected item data %v", item)
+	}
+}
+
+func TestPatchHandler(t *testing.T) {
+	handler := PatchHandler(createCollectionDefinition())
+	if handler == nil {
+		t.Fatalf("unexpected null handler")
+	}
+
+	InitStorage(createManifest(t), StorageTypeMemory)
+
+	collection, _ := Storage.GetCollection("books")
+	itemId, _ := collection.AddItem(stdcontext.Background(), createCollectionItem())
+
+	cases := []TestCase{
+		{
+			description: "should succeed and apply merge patch",
+			methodType:  http.MethodPatch,
+			endpoint:    "/api/books/" + itemId,
+			id:          itemId,
+			item:        createCollectionItem(),
+			parsedPatch: patch.MergePatch{Patch: map[string]interface{}{
+				"name":     "new name",
+				"lastname": nil,
+			}},
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusOK,
+			expectedData: map[string]interface{}{
+				"data": map[string]interface{}{
+					"id": "1",
+				},
+				"success": true,
+			},
+		},
+		{
+			description: "should succeed and apply json patch",
+			methodType:  http.MethodPatch,
+			endpoint:    "/api/books/" + itemId,
+			id:          itemId,
+			item:        createCollectionItem(),
+			parsedPatch: patch.JSONPatch{
+				{Op: "test", Path: "/name", Value: "new name"},
+				{Op: "replace", Path: "/age", Value: 30.0},
+			},
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusOK,
+			expectedData: map[string]interface{}{
+				"data": map[string]interface{}{
+					"id": "1",
+				},
+				"success": true,
+			},
+		},
+		{
+			description: "should fail due to failing json patch",
+			methodType:  http.MethodPatch,
+			endpoint:    "/api/books/" + itemId,
+			id:          itemId,
+			item:        createCollectionItem(),
+			parsedPatch: patch.JSONPatch{
+				{Op: "remove", Path: "/unknown"},
+			},
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusUnprocessableEntity,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "can't apply patch. error: path 'unknown' not found",
+				},
+				"success": false,
+			},
+		},
+		{
+			description: "should fail due to wrong data type",
+			methodType:  http.MethodPatch,
+			endpoint:    "/api/books/" + itemId,
+			id:          itemId,
+			item:        createCollectionItem(),
+			parsedPatch: patch.MergePatch{Patch: map[string]interface{}{
+				"age": "invalid type",
+			}},
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "age", "code": "invalid_type", "message": "invalid value, float expected"},
+					},
+				},
+				"success": false,
+			},
+		},
+	}
+
+	runTestCases(t, handler, cases)
+
+	// patches are applied over the stored item, so each case sees the changes made by the previous ones
+	item, _ := collection.GetItem(stdcontext.Background(), itemId)
+	expectedItem := createCollectionItem()
+	expectedItem["id"] = itemId
+	expectedItem["name"] = "new name"
+	expectedItem["age"] = 30.0
+	delete(expectedItem, "lastname")
+	if !reflect.DeepEqual(item, expectedItem) {
+		t.Fatalf("unexpected item data %v", item)
+	}
+}
+
 func TestDeleteHandler(t *testing.T) {
 	handler := DeleteHandler(createCollectionDefinition())
 	if handler == nil {
@@ -246,7 +599,7 @@ func TestDeleteHandler(t *testing.T) {
 	InitStorage(createManifest(t), StorageTypeMemory)
 
 	collection, _ := Storage.GetCollection("books")
-	itemId, _ := collection.AddItem(map[string]interface{}{
+	itemId, _ := collection.AddItem(stdcontext.Background(), map[string]interface{}{
 		"name":      "old name",
 		"lastname":  "old lastname",
 		"age":       5,
@@ -268,7 +621,7 @@ func TestDeleteHandler(t *testing.T) {
 			endpoint:                  "/api/books/100",
 			id:                        "100",
 			responseBodyInvalidFormat: false,
-			expectedStatus:            http.StatusBadRequest,
+			expectedStatus:            http.StatusNotFound,
 			expectedData: map[string]interface{}{
 				"error": map[string]interface{}{
 					"msg": "item not found",
@@ -281,6 +634,360 @@ func TestDeleteHandler(t *testing.T) {
 	runTestCases(t, handler, cases)
 }
 
+func TestBulkHandler(t *testing.T) {
+	InitStorage(createManifest(t), StorageTypeMemory)
+	collection, _ := Storage.GetCollection("books")
+	itemId, _ := collection.AddItem(stdcontext.Background(), createCollectionItem())
+	handler := ParseBulk(BulkHandler(createCollectionDefinition()))
+
+	body := `[
+		{"op": "create", "item": {"name": "Alice", "lastname": "Smith", "age": 30, "is_active": true}},
+		{"op": "create", "item": {"name": "Alice", "pages": 100}},
+		{"op": "update", "id": "` + itemId + `", "item": {"age": 21}},
+		{"op": "update", "id": "100", "item": {"age": 21}},
+		{"op": "delete", "id": "not-an-id"},
+		{"op": "move", "id": "` + itemId + `"}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/api/books/_bulk", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	expected := map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"failed": 4.0,
+			"results": []interface{}{
+				map[string]interface{}{"op": "create", "id": "2", "status": 201.0},
+				map[string]interface{}{"op": "create", "status": 400.0, "error": map[string]interface{}{
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "pages", "code": "unknown_field", "message": "unknown field"},
+					},
+				}},
+				map[string]interface{}{"op": "update", "id": itemId, "status": 200.0},
+				map[string]interface{}{"op": "update", "id": "100", "status": 404.0, "error": map[string]interface{}{"msg": "item not found"}},
+				map[string]interface{}{"op": "delete", "id": "not-an-id", "status": 400.0, "error": map[string]interface{}{"msg": "invalid item id"}},
+				map[string]interface{}{"op": "move", "id": itemId, "status": 400.0, "error": map[string]interface{}{"msg": "unknown operation 'move'"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(response, expected) {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+	if item, _ := collection.GetItem(stdcontext.Background(), itemId); item.(map[string]interface{})["age"] != 21.0 {
+		t.Fatalf("unexpected updated item %v", item)
+	}
+}
+
+func TestUpdateManyHandler(t *testing.T) {
+	InitStorage(createManifest(t), StorageTypeMemory)
+	collection, _ := Storage.GetCollection("books")
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Alice", "age": 20.0})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Bob", "age": 30.0})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Carol", "age": 40.0})
+	handler := UpdateManyHandler(createCollectionDefinition())
+
+	cases := []TestCase{
+		{
+			description:    "should return the matching items count on dry run",
+			methodType:     http.MethodPost,
+			endpoint:       "/api/books/_update?age[gte]=30&dry_run=true",
+			parsedBody:     map[string]interface{}{"is_active": false},
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"matched": 2.0},
+				"success": true,
+			},
+		},
+		{
+			description:    "should update matching items",
+			methodType:     http.MethodPost,
+			endpoint:       "/api/books/_update?age[gte]=30",
+			parsedBody:     map[string]interface{}{"is_active": false},
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"updated": 2.0},
+				"success": true,
+			},
+		},
+		{
+			description:    "should fail due to missing filter",
+			methodType:     http.MethodPost,
+			endpoint:       "/api/books/_update",
+			parsedBody:     map[string]interface{}{"is_active": false},
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error":   map[string]interface{}{"msg": "a filter is required"},
+				"success": false,
+			},
+		},
+		{
+			description:    "should fail due to invalid item data",
+			methodType:     http.MethodPost,
+			endpoint:       "/api/books/_update?name=Alice",
+			parsedBody:     map[string]interface{}{"age": "old"},
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "age", "code": "invalid_type", "message": "invalid value, float expected"},
+					},
+				},
+				"success": false,
+			},
+		},
+		{
+			description:    "should fail due to modified id",
+			methodType:     http.MethodPost,
+			endpoint:       "/api/books/_update?name=Alice",
+			parsedBody:     map[string]interface{}{"id": "2"},
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid item data",
+					"fields": []interface{}{
+						map[string]interface{}{"field": "id", "code": "read_only", "message": "the item ID can't be modified"},
+					},
+				},
+				"success": false,
+			},
+		},
+	}
+	runTestCases(t, handler, cases)
+
+	inactive := storage.Filter{{Field: "is_active", Operator: storage.FilterEqual, Value: false}}
+	if count, _ := collection.Count(stdcontext.Background(), inactive); count != 2 {
+		t.Fatalf("unexpected updated items count %d", count)
+	}
+}
+
+func TestDeleteManyHandler(t *testing.T) {
+	InitStorage(createManifest(t), StorageTypeMemory)
+	collection, _ := Storage.GetCollection("books")
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Alice", "age": 20.0})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Bob", "age": 30.0})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Carol", "age": 40.0})
+	handler := DeleteManyHandler(createCollectionDefinition())
+
+	cases := []TestCase{
+		{
+			description:    "should return the matching items count on dry run",
+			methodType:     http.MethodDelete,
+			endpoint:       "/api/books/?age[lt]=35&dry_run=1",
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"matched": 2.0},
+				"success": true,
+			},
+		},
+		{
+			description:    "should delete matching items",
+			methodType:     http.MethodDelete,
+			endpoint:       "/api/books/?age[lt]=35",
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"deleted": 2.0},
+				"success": true,
+			},
+		},
+		{
+			description:    "should fail due to missing filter",
+			methodType:     http.MethodDelete,
+			endpoint:       "/api/books/",
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error":   map[string]interface{}{"msg": "a filter is required"},
+				"success": false,
+			},
+		},
+		{
+			description:    "should fail due to invalid dry_run value",
+			methodType:     http.MethodDelete,
+			endpoint:       "/api/books/?name=Carol&dry_run=maybe",
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error":   map[string]interface{}{"msg": "invalid dry_run value 'maybe'"},
+				"success": false,
+			},
+		},
+	}
+	runTestCases(t, handler, cases)
+
+	if count, _ := collection.Count(stdcontext.Background(), nil); count != 1 {
+		t.Fatalf("unexpected items count %d", count)
+	}
+}
+
+func TestDeleteManyHandler_controlParamFields(t *testing.T) {
+	// fields using the name of a param of another endpoint are still used as filters
+	collectionDefinition := data.CollectionDefinition{
+		Name: "stock",
+		Fields: map[string]data.FieldDefinition{
+			"name":  {Type: "string"},
+			"count": {Type: "integer"},
+		},
+	}
+	manifest, _ := json.Marshal([]data.CollectionDefinition{collectionDefinition})
+	InitStorage(string(manifest), StorageTypeMemory)
+	collection, _ := Storage.GetCollection("stock")
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "bolt", "count": int64(0)})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "bolt", "count": int64(10)})
+	handler := DeleteManyHandler(collectionDefinition)
+
+	cases := []TestCase{
+		{
+			description:    "should only delete items matching all the filters",
+			methodType:     http.MethodDelete,
+			endpoint:       "/api/stock/?count=0&name=bolt",
+			expectedStatus: http.StatusOK,
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"deleted": 1.0},
+				"success": true,
+			},
+		},
+	}
+	runTestCases(t, handler, cases)
+
+	if count, _ := collection.Count(stdcontext.Background(), nil); count != 1 {
+		t.Fatalf("unexpected items count %d", count)
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	collectionDefinition := createCollectionDefinition()
+	collectionDefinition.Fields["name"] = data.FieldDefinition{Type: "string", Searchable: true}
+	collectionDefinition.Fields["lastname"] = data.FieldDefinition{Type: "string", Searchable: true}
+	manifest, _ := json.Marshal([]data.CollectionDefinition{collectionDefinition})
+	InitStorage(string(manifest), StorageTypeMemory)
+	collection, _ := Storage.GetCollection("books")
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Alice", "lastname": "Smith", "age": 30.0})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Bob", "lastname": "Jones", "age": 40.0})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Smith", "lastname": "Smith", "age": 50.0})
+	handler := SearchHandler(collectionDefinition)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/books/_search?q=smith&fields=name&age[gte]=30", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	var results []struct {
+		Score float64                `json:"score"`
+		Item  map[string]interface{} `json:"item"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &results)
+	if len(results) != 2 || results[0].Score <= results[1].Score {
+		t.Fatalf("unexpected results %s", w.Body.String())
+	}
+	expected := []map[string]interface{}{
+		{"id": "3", "name": "Smith"},
+		{"id": "1", "name": "Alice"},
+	}
+	for i, result := range results {
+		if !reflect.DeepEqual(result.Item, expected[i]) {
+			t.Fatalf("unexpected result item %v", result.Item)
+		}
+	}
+
+	cases := []TestCase{
+		{
+			description:    "should fail due to missing search text",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/_search",
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error":   map[string]interface{}{"msg": "missing search text 'q'"},
+				"success": false,
+			},
+		},
+		{
+			description:    "should fail due to sort param",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/_search?q=smith&sort=name",
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error":   map[string]interface{}{"msg": "search results are sorted by relevance, sort and cursor are not supported"},
+				"success": false,
+			},
+		},
+	}
+	runTestCases(t, handler, cases)
+
+	runTestCases(t, SearchHandler(createCollectionDefinition()), []TestCase{
+		{
+			description:    "should fail due to missing searchable fields",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/_search?q=smith",
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error":   map[string]interface{}{"msg": "the collection has no searchable fields"},
+				"success": false,
+			},
+		},
+	})
+}
+
+func TestAggregateHandler(t *testing.T) {
+	InitStorage(createManifest(t), StorageTypeMemory)
+	collection, _ := Storage.GetCollection("books")
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Alice", "age": 20.0, "is_active": true})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Bob", "age": 30.0, "is_active": true})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Carol", "age": 40.0, "is_active": false})
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{"name": "Dave", "is_active": false})
+	handler := AggregateHandler(createCollectionDefinition())
+
+	cases := []TestCase{
+		{
+			description:    "should aggregate grouped items",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/_aggregate?group=is_active&sum=age&avg=age&max=name",
+			expectedStatus: http.StatusOK,
+			expectedData: []interface{}{
+				map[string]interface{}{
+					"group": map[string]interface{}{"is_active": false},
+					"count": 2.0,
+					"sum":   map[string]interface{}{"age": 40.0},
+					"avg":   map[string]interface{}{"age": 40.0},
+					"max":   map[string]interface{}{"name": "Dave"},
+				},
+				map[string]interface{}{
+					"group": map[string]interface{}{"is_active": true},
+					"count": 2.0,
+					"sum":   map[string]interface{}{"age": 50.0},
+					"avg":   map[string]interface{}{"age": 25.0},
+					"max":   map[string]interface{}{"name": "Bob"},
+				},
+			},
+		},
+		{
+			description:    "should count filtered items",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/_aggregate?count&age[gte]=30",
+			expectedStatus: http.StatusOK,
+			expectedData: []interface{}{
+				map[string]interface{}{"group": map[string]interface{}{}, "count": 2.0},
+			},
+		},
+		{
+			description:    "should fail due to non numeric field",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/_aggregate?sum=name",
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error":   map[string]interface{}{"msg": "field 'name' can't be used for sum"},
+				"success": false,
+			},
+		},
+	}
+	runTestCases(t, handler, cases)
+}
+
 func TestListCollectionHandler(t *testing.T) {
 	handler := ListCollectionHandler(createCollectionDefinition())
 	if handler == nil {
@@ -290,13 +997,13 @@ func TestListCollectionHandler(t *testing.T) {
 	InitStorage(createManifest(t), StorageTypeMemory)
 
 	collection, _ := Storage.GetCollection("books")
-	collection.AddItem(map[string]interface{}{
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{
 		"name":      "name1",
 		"lastname":  "lastname1",
 		"age":       5,
 		"is_active": true,
 	})
-	collection.AddItem(map[string]interface{}{
+	collection.AddItem(stdcontext.Background(), map[string]interface{}{
 		"name":      "name2",
 		"lastname":  "lastname2",
 		"age":       10,
@@ -312,12 +1019,14 @@ func TestListCollectionHandler(t *testing.T) {
 			expectedStatus:            http.StatusOK,
 			expectedData: []interface{}{
 				map[string]interface{}{
+					"id":        "1",
 					"name":      "name1",
 					"lastname":  "lastname1",
 					"age":       float64(5),
 					"is_active": true,
 				},
 				map[string]interface{}{
+					"id":        "2",
 					"name":      "name2",
 					"lastname":  "lastname2",
 					"age":       float64(10),
@@ -325,6 +1034,17 @@ func TestListCollectionHandler(t *testing.T) {
 				},
 			},
 		},
+		{
+			description:               "should exclude fields",
+			methodType:                http.MethodGet,
+			endpoint:                  "/api/books/?fields=-lastname,-is_active",
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusOK,
+			expectedData: []interface{}{
+				map[string]interface{}{"id": "1", "name": "name1", "age": float64(5)},
+				map[string]interface{}{"id": "2", "name": "name2", "age": float64(10)},
+			},
+		},
 		{
 			description:               "should skip 1",
 			methodType:                http.MethodGet,
@@ -333,6 +1053,7 @@ func TestListCollectionHandler(t *testing.T) {
 			expectedStatus:            http.StatusOK,
 			expectedData: []interface{}{
 				map[string]interface{}{
+					"id":        "2",
 					"name":      "name2",
 					"lastname":  "lastname2",
 					"age":       float64(10),
@@ -355,6 +1076,30 @@ func TestListCollectionHandler(t *testing.T) {
 			expectedStatus:            http.StatusOK,
 			expectedData: []interface{}{
 				map[string]interface{}{
+					"id":        "1",
+					"name":      "name1",
+					"lastname":  "lastname1",
+					"age":       float64(5),
+					"is_active": true,
+				},
+			},
+		},
+		{
+			description:               "should sort descending",
+			methodType:                http.MethodGet,
+			endpoint:                  "/api/books/?sort=-age",
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusOK,
+			expectedData: []interface{}{
+				map[string]interface{}{
+					"id":        "2",
+					"name":      "name2",
+					"lastname":  "lastname2",
+					"age":       float64(10),
+					"is_active": true,
+				},
+				map[string]interface{}{
+					"id":        "1",
 					"name":      "name1",
 					"lastname":  "lastname1",
 					"age":       float64(5),
@@ -362,11 +1107,175 @@ func TestListCollectionHandler(t *testing.T) {
 				},
 			},
 		},
+		{
+			description:               "should filter items",
+			methodType:                http.MethodGet,
+			endpoint:                  "/api/books/?age[gt]=5&name[contains]=NAME",
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusOK,
+			expectedData: []interface{}{
+				map[string]interface{}{
+					"id":        "2",
+					"name":      "name2",
+					"lastname":  "lastname2",
+					"age":       float64(10),
+					"is_active": true,
+				},
+			},
+		},
+		{
+			description:               "should fail due to invalid filter value",
+			methodType:                http.MethodGet,
+			endpoint:                  "/api/books/?age=invalid",
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid value 'invalid' for field 'age', float expected",
+				},
+				"success": false,
+			},
+		},
+		{
+			description:               "should fail due to invalid cursor",
+			methodType:                http.MethodGet,
+			endpoint:                  "/api/books/?cursor=invalid",
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid cursor",
+				},
+				"success": false,
+			},
+		},
+		{
+			description:               "should fail due to invalid cursor item id",
+			methodType:                http.MethodGet,
+			endpoint:                  "/api/books/?cursor=" + storage.NewCursor(nil, "not-an-id", nil).Encode(),
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid item id",
+				},
+				"success": false,
+			},
+		},
+		{
+			description:               "should fail due to unknown sort field",
+			methodType:                http.MethodGet,
+			endpoint:                  "/api/books/?sort=unknown",
+			responseBodyInvalidFormat: false,
+			expectedStatus:            http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid sort field 'unknown'",
+				},
+				"success": false,
+			},
+		},
 	}
 
 	runTestCases(t, handler, cases)
 }
 
+func TestListCollectionHandler_cancelledRequest(t *testing.T) {
+	InitStorage(createManifest(t), StorageTypeMemory)
+	handler := ListCollectionHandler(createCollectionDefinition())
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/books/", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status code: %d", rr.Code)
+	}
+}
+
+func Test_addStorageErrorResponse(t *testing.T) {
+	cases := []struct {
+		err            error
+		expectedStatus int
+		expectedMsg    string
+	}{
+		{fmt.Errorf("%w: '1'", storage.ErrNotFound), http.StatusNotFound, "item not found"},
+		{fmt.Errorf("%w: duplicated value", storage.ErrConflict), http.StatusConflict, "item conflict: duplicated value"},
+		{fmt.Errorf("%w: 'abc'", storage.ErrInvalidID), http.StatusBadRequest, "invalid item id"},
+		{fmt.Errorf("%w: connection refused", storage.ErrUnavailable), http.StatusServiceUnavailable, "storage unavailable"},
+		{fmt.Errorf("unexpected"), http.StatusInternalServerError, "testing error"},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		addStorageErrorResponse(rr, c.err, "testing error")
+		if rr.Code != c.expectedStatus {
+			t.Fatalf("unexpected status code %d for error '%s'", rr.Code, c.err.Error())
+		}
+		var body map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if msg := body["error"].(map[string]interface{})["msg"]; msg != c.expectedMsg {
+			t.Fatalf("unexpected message '%v' for error '%s'", msg, c.err.Error())
+		}
+	}
+}
+
+func TestListCollectionHandler_typedFields(t *testing.T) {
+	var collectionDefinition data.CollectionDefinition
+	json.Unmarshal([]byte(`{"name": "books", "fields": {"title": "string", "pages": "integer", "published": "datetime"}}`), &collectionDefinition)
+	manifest, _ := json.Marshal([]data.CollectionDefinition{collectionDefinition})
+	InitStorage(string(manifest), StorageTypeMemory)
+
+	runTestCases(t, PutHandler(collectionDefinition), []TestCase{
+		{
+			description:    "should create item with typed fields",
+			methodType:     http.MethodPut,
+			endpoint:       "/api/books/",
+			parsedBody:     map[string]interface{}{"title": "The Hobbit", "pages": 310.0, "published": "1937-09-21T02:00:00+02:00"},
+			expectedStatus: http.StatusCreated,
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"id": "1"},
+				"success": true,
+			},
+		},
+		{
+			description:    "should create another item with typed fields",
+			methodType:     http.MethodPut,
+			endpoint:       "/api/books/",
+			parsedBody:     map[string]interface{}{"title": "The Silmarillion", "pages": 365.0, "published": "1977-09-15T00:00:00Z"},
+			expectedStatus: http.StatusCreated,
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"id": "2"},
+				"success": true,
+			},
+		},
+	})
+
+	runTestCases(t, ListCollectionHandler(collectionDefinition), []TestCase{
+		{
+			description:    "should filter by datetime",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/?published[lt]=1950-01-01T00:00:00Z",
+			expectedStatus: http.StatusOK,
+			expectedData: []interface{}{
+				map[string]interface{}{"id": "1", "title": "The Hobbit", "pages": 310.0, "published": "1937-09-21T00:00:00Z"},
+			},
+		},
+		{
+			description:    "should fail due to invalid integer",
+			methodType:     http.MethodGet,
+			endpoint:       "/api/books/?pages=1.5",
+			expectedStatus: http.StatusBadRequest,
+			expectedData: map[string]interface{}{
+				"error": map[string]interface{}{
+					"msg": "invalid value '1.5' for field 'pages', integer expected",
+				},
+				"success": false,
+			},
+		},
+	})
+}
+
 func runTestCases(t *testing.T, handler func(w http.ResponseWriter, r *http.Request), cases []TestCase) {
 	for _, c := range cases {
 		t.Logf("running test case: [%s]%s", c.methodType, c.description)
@@ -375,6 +1284,7 @@ func runTestCases(t *testing.T, handler func(w http.ResponseWriter, r *http.Requ
 		context.Set(req, "item", c.item)
 		context.Set(req, "id", c.id)
 		context.Set(req, "parsedBody", c.parsedBody)
+		context.Set(req, "parsedPatch", c.parsedPatch)
 		handler(w, req)
 
 		if w.Code != c.expectedStatus {
@@ -1,11 +1,18 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"io/ioutil"
+	"mime"
 	"monkiato/apio/internal/data"
+	"monkiato/apio/internal/patch"
+	"monkiato/apio/internal/storage"
 	"net/http"
 )
 
@@ -24,38 +31,138 @@ func ParseBody(handler http.HandlerFunc) func(http.ResponseWriter, *http.Request
 			addErrorResponse(w, http.StatusBadRequest, "can't parse body")
 			return
 		}
+		// null is decoded as a nil map, only objects are valid items
+		if parsedBody == nil {
+			addErrorResponse(w, http.StatusBadRequest, "can't parse body, object expected")
+			return
+		}
 		context.Set(r, "parsedBody", parsedBody)
 		handler.ServeHTTP(w, r)
 	}
 }
 
+// ParsePatch middleware used to parse the request body as a patch, the patch format is selected by the
+// Content-Type header: JSON Merge Patch (application/merge-patch+json or application/json) or JSON Patch
+// (application/json-patch+json). The patch will be stored in Gorilla Context, it can be obtained from subsequence
+// handlers through context.Get(r, "parsedPatch")
+func ParsePatch(handler http.HandlerFunc) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, "can't read body")
+			return
+		}
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType != "" && contentType != "application/json" &&
+			contentType != patch.MergePatchContentType && contentType != patch.JSONPatchContentType {
+			addErrorResponse(w, http.StatusUnsupportedMediaType, "unsupported patch content type")
+			return
+		}
+		parsedPatch, err := patch.Parse(contentType, body)
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, "can't parse patch")
+			return
+		}
+		context.Set(r, "parsedPatch", parsedPatch)
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// ParseBulk middleware used to parse the list of operations sent to the bulk endpoint, the format is selected by the
+// Content-Type header: a JSON array (application/json) or one operation per line (application/x-ndjson).
+// The operations will be stored in Gorilla Context, it can be obtained from subsequence handlers through
+// context.Get(r, "parsedOperations")
+func ParseBulk(handler http.HandlerFunc) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, "can't read body")
+			return
+		}
+		var operations []bulkOperation
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch contentType {
+		case "", "application/json":
+			err = json.Unmarshal(body, &operations)
+		case ndjsonContentType:
+			operations, err = parseNDJSONOperations(body)
+		default:
+			addErrorResponse(w, http.StatusUnsupportedMediaType, "unsupported bulk content type")
+			return
+		}
+		if err != nil {
+			addErrorResponse(w, http.StatusBadRequest, "can't parse operations. error: "+err.Error())
+			return
+		}
+		if len(operations) > maxBulkOperations {
+			addErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("too many operations, up to %d operations are accepted", maxBulkOperations))
+			return
+		}
+		context.Set(r, "parsedOperations", operations)
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// parseNDJSONOperations parse one operation per line, empty lines are ignored
+func parseNDJSONOperations(body []byte) ([]bulkOperation, error) {
+	operations := []bulkOperation{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var operation bulkOperation
+		if err := json.Unmarshal(scanner.Bytes(), &operation); err != nil {
+			return nil, fmt.Errorf("invalid operation at line %d", line)
+		}
+		operations = append(operations, operation)
+	}
+	return operations, scanner.Err()
+}
+
 // ValidateID middleware used to detect an item ID in the request, if exists it means the endpoint is trying to operate
 // over an existing item, and the middleware will try to find and get the item, otherwise an error is returned if the
-// item was not found. The item will be stored in Gorilla Context, it can be obtained from subsequence handlers through
-// context.Get(r, "item")
-func ValidateID(collection data.CollectionDefinition) mux.MiddlewareFunc {
+// item was not found or the ID format is not valid for the collection. The item will be stored in Gorilla Context, it
+// can be obtained from subsequence handlers through context.Get(r, "item").
+// Collections using client IDs create items with PUT requests, so missing items are accepted for PUT requests and
+// no item is stored in that case. GET requests only validate the ID format, the handler fetches the requested fields
+func ValidateID(collectionDefinition data.CollectionDefinition) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			vars := mux.Vars(r)
 
 			// collection validation
-			collection, error := Storage.GetCollection(collection.Name)
+			collection, error := Storage.GetCollection(collectionDefinition.Name)
 			if error != nil {
 				addErrorResponse(w, http.StatusBadRequest, "can't fetch collection. error: "+error.Error())
 				return
 			}
 
 			if id, ok := vars["id"]; ok {
+				if err := collection.ValidateID(id); err != nil {
+					addStorageErrorResponse(w, err, "invalid item id")
+					return
+				}
+				context.Set(r, "id", id)
+				if r.Method == http.MethodGet {
+					next.ServeHTTP(w, r)
+					return
+				}
 				// id exists, validate if the item exists in the specified collections
-				item, found := collection.GetItem(id)
-				if !found {
-					//not found
-					addErrorResponse(w, http.StatusNotFound, "item not found")
+				ctx, cancel := storageContext(r)
+				defer cancel()
+				item, err := collection.GetItem(ctx, id)
+				// PUT creates the item when it doesn't exist
+				createsItem := errors.Is(err, storage.ErrNotFound) && r.Method == http.MethodPut
+				if err != nil && !createsItem {
+					addStorageErrorResponse(w, err, "can't fetch item")
 					return
 				}
 
-				context.Set(r, "id", id)
-				context.Set(r, "item", item)
+				if !createsItem {
+					context.Set(r, "item", item)
+				}
 			}
 			next.ServeHTTP(w, r)
 		})
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"monkiato/apio/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func createItemRouter(collectionDefinition data.CollectionDefinition) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(ValidateID(collectionDefinition))
+	router.HandleFunc("/{id}", GetHandler(collectionDefinition)).Methods(http.MethodGet)
+	router.HandleFunc("/{id}", ParseBody(ReplaceHandler(collectionDefinition))).Methods(http.MethodPut)
+	return router
+}
+
+func serveItemRequest(router *mux.Router, method string, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestValidateID(t *testing.T) {
+	InitStorage(createManifest(t), StorageTypeMemory)
+	router := createItemRouter(createCollectionDefinition())
+
+	if rr := serveItemRequest(router, http.MethodGet, "/not-an-id", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d for invalid id", rr.Code)
+	}
+	if rr := serveItemRequest(router, http.MethodGet, "/100", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status code %d for missing item", rr.Code)
+	}
+	// PUT creates missing items
+	if rr := serveItemRequest(router, http.MethodPut, "/100", `{"name": "Bob", "lastname": "Howards", "age": 20, "is_active": true}`); rr.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d creating item", rr.Code)
+	}
+	if rr := serveItemRequest(router, http.MethodGet, "/100", ""); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d for upserted item", rr.Code)
+	}
+}
+
+func TestValidateID_clientIDs(t *testing.T) {
+	InitStorage(`[{"name": "editions", "id_strategy": "client", "fields": {"title": "string"}}]`, StorageTypeMemory)
+	collections := Storage.GetCollectionDefinitions()
+	router := createItemRouter(collections[0])
+
+	if rr := serveItemRequest(router, http.MethodPut, "/dune-1965", `{"title": "Dune"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d creating item", rr.Code)
+	}
+	if rr := serveItemRequest(router, http.MethodPut, "/dune-1965", `{"title": "Dune (1965)"}`); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d replacing item", rr.Code)
+	}
+	rr := serveItemRequest(router, http.MethodGet, "/dune-1965", "")
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"id":"dune-1965","title":"Dune (1965)"}` {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+	// items returned by the api can be sent back with their ID, but the ID can't be modified
+	if rr := serveItemRequest(router, http.MethodPut, "/dune-1965", rr.Body.String()); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d replacing item with its id", rr.Code)
+	}
+	if rr := serveItemRequest(router, http.MethodPut, "/dune-1965", `{"id": "dune-2005", "title": "Dune"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d modifying item id", rr.Code)
+	}
+	if rr := serveItemRequest(router, http.MethodPut, "/dune%201965", `{"title": "Dune"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d for invalid id", rr.Code)
+	}
+}
+
+func TestParseBody_nonObject(t *testing.T) {
+	InitStorage(createManifest(t), StorageTypeMemory)
+	router := createItemRouter(createCollectionDefinition())
+
+	for _, body := range []string{"null", "[]", `"Bob"`, "10"} {
+		rr := serveItemRequest(router, http.MethodPut, "/100", body)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("unexpected status code %d for body %s", rr.Code, body)
+		}
+		if !strings.Contains(rr.Body.String(), "can't parse body") {
+			t.Fatalf("unexpected response %s for body %s", rr.Body.String(), body)
+		}
+	}
+}
+
+func TestParseBulk(t *testing.T) {
+	var parsed []bulkOperation
+	handler := ParseBulk(func(w http.ResponseWriter, r *http.Request) {
+		parsed = context.Get(r, "parsedOperations").([]bulkOperation)
+	})
+	serveBulk := func(contentType string, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/_bulk", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr.Code
+	}
+
+	ndjson := "{\"op\": \"create\", \"item\": {\"name\": \"Bob\"}}\n\n{\"op\": \"delete\", \"id\": \"1\"}\n"
+	if code := serveBulk("application/x-ndjson", ndjson); code != http.StatusOK || len(parsed) != 2 || parsed[1].ID != "1" {
+		t.Fatalf("unexpected status code %d, operations %v", code, parsed)
+	}
+	if code := serveBulk("application/json", `[{"op": "delete", "id": "1"}]`); code != http.StatusOK || len(parsed) != 1 || parsed[0].Op != "delete" {
+		t.Fatalf("unexpected status code %d, operations %v", code, parsed)
+	}
+	if code := serveBulk("application/x-ndjson", "{\"op\": \"delete\"}\nnot json"); code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d for invalid operation", code)
+	}
+	if code := serveBulk("text/plain", "[]"); code != http.StatusUnsupportedMediaType {
+		t.Fatalf("unexpected status code %d for unsupported content type", code)
+	}
+	if code := serveBulk("application/json", "["+strings.Repeat(`{"op": "delete", "id": "1"},`, maxBulkOperations)+`{"op": "delete", "id": "1"}]`); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status code %d for too many operations", code)
+	}
+}
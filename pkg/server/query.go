@@ -0,0 +1,323 @@
+package server
+
+import (
+	"fmt"
+	"monkiato/apio/internal/data"
+	"monkiato/apio/internal/storage"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+var (
+	// filterParamRegexp matches filter query params, e.g. "year" or "year[gte]"
+	filterParamRegexp = regexp.MustCompile(`^([^\[\]]+)(?:\[([a-z]+)\])?$`)
+
+	// listParams query params used by the list endpoint, they are not used as filters
+	listParams = map[string]bool{
+		"skip":   true,
+		"limit":  true,
+		"sort":   true,
+		"cursor": true,
+		"fields": true,
+	}
+	// searchParams query params used by the search endpoint, they are not used as filters
+	searchParams = map[string]bool{
+		"skip":   true,
+		"limit":  true,
+		"sort":   true,
+		"cursor": true,
+		"fields": true,
+		"q":      true,
+	}
+	// matchingParams query params used by update and delete by filter, they are not used as filters
+	matchingParams = map[string]bool{
+		"dry_run": true,
+	}
+	// aggregateParams query params used by the aggregate endpoint, they are not used as filters
+	aggregateParams = map[string]bool{
+		"group": true,
+		"count": true,
+		"sum":   true,
+		"avg":   true,
+		"min":   true,
+		"max":   true,
+	}
+)
+
+// parseQueryParams parse all query params used to list collection items: pagination (skip and limit, or cursor),
+// sorting and filters. controlParams are the params used by the endpoint, the rest of them are filters
+func parseQueryParams(queryParams url.Values, collectionDefinition data.CollectionDefinition, controlParams map[string]bool) (storage.QueryParams, error) {
+	skip, skipErr := strconv.ParseInt(queryParams.Get("skip"), 10, 64)
+	limit, limitErr := strconv.ParseInt(queryParams.Get("limit"), 10, 64)
+	if skipErr != nil || skip < 0 {
+		skip = 0
+	}
+	if limitErr != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	sortBy, err := parseSortParam(queryParams.Get("sort"), collectionDefinition)
+	if err != nil {
+		return storage.QueryParams{}, err
+	}
+	filter, err := parseFilterParams(queryParams, collectionDefinition, controlParams)
+	if err != nil {
+		return storage.QueryParams{}, err
+	}
+	fields, err := parseFieldsParam(queryParams.Get("fields"), collectionDefinition)
+	if err != nil {
+		return storage.QueryParams{}, err
+	}
+	var after *storage.Cursor
+	if token := queryParams.Get("cursor"); token != "" {
+		if after, err = parseCursor(token, sortBy, collectionDefinition); err != nil {
+			return storage.QueryParams{}, err
+		}
+		// cursor already points to the page start
+		skip = 0
+	}
+	return storage.QueryParams{
+		Skip:   skip,
+		Limit:  limit,
+		SortBy: sortBy,
+		Filter: filter,
+		After:  after,
+		Fields: fields,
+	}, nil
+}
+
+// parseMatchingParams parse the query params used by the operations applied to all matching items: the filter,
+// which is required, and the optional 'dry_run' flag
+func parseMatchingParams(queryParams url.Values, collectionDefinition data.CollectionDefinition) (storage.Filter, bool, error) {
+	filter, err := parseFilterParams(queryParams, collectionDefinition, matchingParams)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(filter) == 0 {
+		return nil, false, fmt.Errorf("a filter is required")
+	}
+	dryRun := false
+	if value := queryParams.Get("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			return nil, false, fmt.Errorf("invalid dry_run value '%s'", value)
+		}
+	}
+	return filter, dryRun, nil
+}
+
+// parseCursor decode the cursor token, values are converted to the field types since the cursor encoding can
+// only keep JSON types, e.g. dates are decoded as strings
+func parseCursor(token string, sortBy []storage.SortField, collectionDefinition data.CollectionDefinition) (*storage.Cursor, error) {
+	cursor, err := storage.DecodeCursor(token, sortBy)
+	if err != nil {
+		return nil, err
+	}
+	for i, sortField := range sortBy {
+		if text, ok := cursor.Values[i].(string); ok {
+			if cursor.Values[i], err = collectionDefinition.ParseFieldValue(sortField.Name, text); err != nil {
+				return nil, fmt.Errorf("invalid cursor")
+			}
+		}
+	}
+	return cursor, nil
+}
+
+// parseSortParam parse a comma separated list of field names used to sort a query, e.g. "-year,title".
+// A '-' prefix means descending order, an optional '+' prefix can be used for ascending order.
+// Each field must be declared in the collection definition
+func parseSortParam(value string, collectionDefinition data.CollectionDefinition) ([]storage.SortField, error) {
+	var sortBy []storage.SortField
+	if value == "" {
+		return sortBy, nil
+	}
+	for _, name := range strings.Split(value, ",") {
+		sortField := storage.SortField{}
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, "-") {
+			sortField.Descending = true
+			name = name[1:]
+		} else if strings.HasPrefix(name, "+") {
+			name = name[1:]
+		}
+		field, exists := collectionDefinition.FieldByPath(name)
+		if !exists || field.Type == data.FieldTypeObject || field.Type == data.FieldTypeArray {
+			return nil, fmt.Errorf("invalid sort field '%s'", name)
+		}
+		sortField.Name = name
+		sortBy = append(sortBy, sortField)
+	}
+	return sortBy, nil
+}
+
+// parseFieldsParam parse the comma separated list of fields returned for each item, e.g. "title,author", or the
+// fields excluded from the items using the '-' prefix, e.g. "-notes". Included and excluded fields can't be mixed,
+// and the item ID can't be excluded
+func parseFieldsParam(value string, collectionDefinition data.CollectionDefinition) (storage.Projection, error) {
+	var projection storage.Projection
+	if value == "" {
+		return projection, nil
+	}
+	for i, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		exclude := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if i == 0 {
+			projection.Exclude = exclude
+		} else if exclude != projection.Exclude {
+			return storage.Projection{}, fmt.Errorf("included and excluded fields can't be mixed")
+		}
+		if name == data.IDField {
+			if exclude {
+				return storage.Projection{}, fmt.Errorf("the item id can't be excluded")
+			}
+		} else if _, exists := collectionDefinition.FieldByPath(name); !exists {
+			return storage.Projection{}, fmt.Errorf("invalid field '%s'", name)
+		}
+		for _, field := range projection.Fields {
+			if field == name || strings.HasPrefix(name, field+".") || strings.HasPrefix(field, name+".") {
+				return storage.Projection{}, fmt.Errorf("fields '%s' and '%s' overlap", field, name)
+			}
+		}
+		projection.Fields = append(projection.Fields, name)
+	}
+	return projection, nil
+}
+
+// parseAggregateParams parse the query params used to aggregate items: comma separated lists of fields for 'group',
+// 'sum', 'avg', 'min' and 'max', and the filters. Sum and avg require numeric fields, min and max require fields
+// that can be compared. Items are always counted, so the 'count' param is optional
+func parseAggregateParams(queryParams url.Values, collectionDefinition data.CollectionDefinition) (storage.AggregateQuery, error) {
+	filter, err := parseFilterParams(queryParams, collectionDefinition, aggregateParams)
+	if err != nil {
+		return storage.AggregateQuery{}, err
+	}
+	query := storage.AggregateQuery{Filter: filter}
+	params := []struct {
+		name    string
+		fields  *[]string
+		allowed func(field data.FieldDefinition) bool
+	}{
+		{"group", &query.GroupBy, func(field data.FieldDefinition) bool { return true }},
+		{"sum", &query.Sum, isNumericField},
+		{"avg", &query.Avg, isNumericField},
+		{"min", &query.Min, data.FieldDefinition.SupportsRange},
+		{"max", &query.Max, data.FieldDefinition.SupportsRange},
+	}
+	for _, param := range params {
+		value := queryParams.Get(param.name)
+		if value == "" {
+			continue
+		}
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			field, exists := collectionDefinition.FieldByPath(name)
+			if !exists {
+				return storage.AggregateQuery{}, fmt.Errorf("invalid %s field '%s'", param.name, name)
+			}
+			// arrays and objects can't be aggregated, including fields nested inside arrays
+			if field.Type == data.FieldTypeArray || field.Type == data.FieldTypeObject || !param.allowed(field) {
+				return storage.AggregateQuery{}, fmt.Errorf("field '%s' can't be used for %s", name, param.name)
+			}
+			*param.fields = append(*param.fields, name)
+		}
+	}
+	return query, nil
+}
+
+func isNumericField(field data.FieldDefinition) bool {
+	return field.Type == "float" || field.Type == data.FieldTypeInteger
+}
+
+// parseFilterParams parse all query params not included in controlParams as filter conditions, e.g.
+// "year[gte]=1990&author=Tolkien". controlParams depend on the endpoint, so fields using the same name as a param of
+// another endpoint can still be filtered.
+// Field names, operators and values are validated against the collection definition. Values for 'in' and 'nin'
+// operators are comma separated
+func parseFilterParams(queryParams url.Values, collectionDefinition data.CollectionDefinition, controlParams map[string]bool) (storage.Filter, error) {
+	var filter storage.Filter
+
+	// sort param names so conditions are always created in the same order
+	names := make([]string, 0, len(queryParams))
+	for name := range queryParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if controlParams[name] {
+			continue
+		}
+		matches := filterParamRegexp.FindStringSubmatch(name)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid filter param '%s'", name)
+		}
+		field := matches[1]
+		operator := storage.FilterEqual
+		if matches[2] != "" {
+			operator = storage.FilterOperator(matches[2])
+		}
+		fieldDefinition, exists := collectionDefinition.FieldByPath(field)
+		if !exists {
+			return nil, fmt.Errorf("invalid filter field '%s'", field)
+		}
+		if fieldDefinition.Type == data.FieldTypeArray && fieldDefinition.Items != nil {
+			// array elements are filtered individually
+			fieldDefinition = *fieldDefinition.Items
+		}
+		if !isFilterOperatorAllowed(fieldDefinition, operator) {
+			return nil, fmt.Errorf("invalid filter operator '%s' for field '%s'", operator, field)
+		}
+		for _, rawValue := range queryParams[name] {
+			value, err := parseFilterValue(collectionDefinition, field, operator, rawValue)
+			if err != nil {
+				return nil, err
+			}
+			filter = append(filter, storage.FilterCondition{
+				Field:    field,
+				Operator: operator,
+				Value:    value,
+			})
+		}
+	}
+	return filter, nil
+}
+
+func parseFilterValue(collectionDefinition data.CollectionDefinition, field string, operator storage.FilterOperator, rawValue string) (interface{}, error) {
+	if operator != storage.FilterIn && operator != storage.FilterNotIn {
+		return collectionDefinition.ParseFieldValue(field, rawValue)
+	}
+	values := []interface{}{}
+	for _, rawElement := range strings.Split(rawValue, ",") {
+		value, err := collectionDefinition.ParseFieldValue(field, rawElement)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func isFilterOperatorAllowed(field data.FieldDefinition, operator storage.FilterOperator) bool {
+	if field.Type == data.FieldTypeObject || field.Type == data.FieldTypeArray {
+		return false
+	}
+	switch operator {
+	case storage.FilterEqual, storage.FilterNotEqual, storage.FilterIn, storage.FilterNotIn:
+		return true
+	case storage.FilterGreaterThan, storage.FilterGreaterThanOrEqual, storage.FilterLowerThan, storage.FilterLowerThanOrEqual:
+		return field.SupportsRange()
+	case storage.FilterContains:
+		return field.SupportsContains()
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"monkiato/apio/internal/storage"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func Test_parseSortParam(t *testing.T) {
+	sortBy, err := parseSortParam("-age, name,+lastname", createCollectionDefinition())
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	expected := []storage.SortField{
+		{Name: "age", Descending: true},
+		{Name: "name"},
+		{Name: "lastname"},
+	}
+	if !reflect.DeepEqual(sortBy, expected) {
+		t.Fatalf("unexpected sort fields %v", sortBy)
+	}
+}
+
+func Test_parseSortParam_empty(t *testing.T) {
+	sortBy, err := parseSortParam("", createCollectionDefinition())
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	if len(sortBy) != 0 {
+		t.Fatalf("unexpected sort fields %v", sortBy)
+	}
+}
+
+func Test_parseSortParam_unknownField(t *testing.T) {
+	if _, err := parseSortParam("-unknown", createCollectionDefinition()); err == nil {
+		t.Fatalf("unexpected success result")
+	}
+}
+
+func Test_parseFilterParams(t *testing.T) {
+	queryParams, _ := url.ParseQuery("age[gte]=18&name=Bob&lastname[in]=Howards,Smith&is_active=true&skip=1&sort=name")
+	filter, err := parseFilterParams(queryParams, createCollectionDefinition(), listParams)
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	expected := storage.Filter{
+		{Field: "age", Operator: storage.FilterGreaterThanOrEqual, Value: 18.0},
+		{Field: "is_active", Operator: storage.FilterEqual, Value: true},
+		{Field: "lastname", Operator: storage.FilterIn, Value: []interface{}{"Howards", "Smith"}},
+		{Field: "name", Operator: storage.FilterEqual, Value: "Bob"},
+	}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Fatalf("unexpected filter %v", filter)
+	}
+}
+
+func Test_parseFilterParams_fails(t *testing.T) {
+	cases := []string{
+		"unknown=value",
+		"age=not_a_number",
+		"age[contains]=1",
+		"is_active[gt]=true",
+		"name[unknown]=Bob",
+		"name[gt=Bob",
+	}
+	for _, query := range cases {
+		queryParams, _ := url.ParseQuery(query)
+		if _, err := parseFilterParams(queryParams, createCollectionDefinition(), listParams); err == nil {
+			t.Errorf("unexpected success result for query '%s'", query)
+		}
+	}
+}
+
+func Test_parseFieldsParam(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected storage.Projection
+	}{
+		{"", storage.Projection{}},
+		{"name, age,id", storage.Projection{Fields: []string{"name", "age", "id"}}},
+		{"-lastname,-is_active", storage.Projection{Fields: []string{"lastname", "is_active"}, Exclude: true}},
+	}
+	for _, c := range cases {
+		projection, err := parseFieldsParam(c.value, createCollectionDefinition())
+		if err != nil {
+			t.Fatalf("unexpected error: " + err.Error())
+		}
+		if !reflect.DeepEqual(projection, c.expected) {
+			t.Errorf("unexpected projection %v for '%s'", projection, c.value)
+		}
+	}
+}
+
+func Test_parseFieldsParam_fails(t *testing.T) {
+	cases := []string{
+		"unknown",
+		"name,-age",
+		"-id",
+		"name,name",
+		",name",
+	}
+	for _, value := range cases {
+		if _, err := parseFieldsParam(value, createCollectionDefinition()); err == nil {
+			t.Errorf("unexpected success result for fields '%s'", value)
+		}
+	}
+}
+
+func Test_parseAggregateParams(t *testing.T) {
+	queryParams, _ := url.ParseQuery("group=is_active,name&sum=age&avg=age&min=name,age&max=age&count&lastname=Smith")
+	query, err := parseAggregateParams(queryParams, createCollectionDefinition())
+	if err != nil {
+		t.Fatalf("unexpected error: " + err.Error())
+	}
+	expected := storage.AggregateQuery{
+		GroupBy: []string{"is_active", "name"},
+		Sum:     []string{"age"},
+		Avg:     []string{"age"},
+		Min:     []string{"name", "age"},
+		Max:     []string{"age"},
+		Filter:  storage.Filter{{Field: "lastname", Operator: storage.FilterEqual, Value: "Smith"}},
+	}
+	if !reflect.DeepEqual(query, expected) {
+		t.Fatalf("unexpected aggregate query %v", query)
+	}
+}
+
+func Test_parseAggregateParams_fails(t *testing.T) {
+	cases := []string{
+		"group=unknown",
+		"sum=name",
+		"avg=is_active",
+		"min=is_active",
+		"max=unknown",
+		"sum=age&unknown=1",
+	}
+	for _, query := range cases {
+		queryParams, _ := url.ParseQuery(query)
+		if _, err := parseAggregateParams(queryParams, createCollectionDefinition()); err == nil {
+			t.Errorf("unexpected success result for query '%s'", query)
+		}
+	}
+}
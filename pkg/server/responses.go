@@ -2,7 +2,21 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
+	"mime"
+	"monkiato/apio/internal/data"
+	"monkiato/apio/internal/storage"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// problemJSONContentType media type for RFC 7807 problem details
+	problemJSONContentType = "application/problem+json"
+	// returnRepresentation RFC 7240 preference used to get the stored item in write responses
+	returnRepresentation = "return=representation"
 )
 
 func addErrorResponse(w http.ResponseWriter, status int, error string) {
@@ -17,6 +31,66 @@ func addErrorResponse(w http.ResponseWriter, status int, error string) {
 	w.Write(bytes)
 }
 
+// addValidationErrorResponse error response including the list of problems found for each field. When the client
+// accepts 'application/problem+json' the response follows RFC 7807, and problems are listed in 'errors' member
+func addValidationErrorResponse(w http.ResponseWriter, r *http.Request, status int, error string, fieldErrors []data.FieldError) {
+	if acceptsProblemJSON(r) {
+		bytes, _ := json.Marshal(map[string]interface{}{
+			"type":   "about:blank",
+			"title":  http.StatusText(status),
+			"status": status,
+			"detail": error,
+			"errors": fieldErrors,
+		})
+		w.Header().Set("Content-Type", problemJSONContentType)
+		w.WriteHeader(status)
+		w.Write(bytes)
+		return
+	}
+	data := map[string]interface{}{
+		"success": false,
+		"error": map[string]interface{}{
+			"msg":    error,
+			"fields": fieldErrors,
+		},
+	}
+	bytes, _ := json.Marshal(data)
+	w.WriteHeader(status)
+	w.Write(bytes)
+}
+
+func acceptsProblemJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accepted); err == nil && mediaType == problemJSONContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// prefersRepresentation check if the client asked for the stored item in the response of a write request, using
+// 'Prefer: return=representation' header or 'return=item' query param
+func prefersRepresentation(r *http.Request) bool {
+	if r.URL.Query().Get("return") == "item" {
+		return true
+	}
+	for _, header := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			// preference parameters are ignored, e.g. 'return=representation; charset=utf-8'
+			token := strings.TrimSpace(strings.SplitN(preference, ";", 2)[0])
+			if strings.EqualFold(strings.ReplaceAll(token, " ", ""), returnRepresentation) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// itemLocation URL path for a collection item
+func itemLocation(collectionDefinition data.CollectionDefinition, id string) string {
+	return APIPathPrefix + url.PathEscape(collectionDefinition.Name) + "/" + url.PathEscape(id)
+}
+
 func addSuccessResponse(w http.ResponseWriter, status int, extraData map[string]interface{}) {
 	data := map[string]interface{}{
 		"success": true,
@@ -26,3 +100,53 @@ func addSuccessResponse(w http.ResponseWriter, status int, extraData map[string]
 	w.WriteHeader(status)
 	w.Write(bytes)
 }
+
+// addPaginationHeaders adds the total amount of items in 'X-Total-Count' header, the cursor for the next page
+// in 'X-Next-Cursor' header, and the 'Link' header with next and prev page URLs when they are available.
+// Page URLs keep the rest of the original query params. Only next page is available for cursor pagination
+func addPaginationHeaders(w http.ResponseWriter, r *http.Request, query storage.QueryParams, result storage.QueryResult, total int64) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	var links []string
+	if query.After != nil {
+		if result.Next != nil {
+			links = append(links, fmt.Sprintf("<%s>; rel=\"next\"", cursorPageURL(r, result.Next.Encode())))
+		}
+	} else {
+		skip, limit := query.Skip, query.Limit
+		if skip+limit < total {
+			links = append(links, fmt.Sprintf("<%s>; rel=\"next\"", pageURL(r, skip+limit, limit)))
+		}
+		if skip > 0 {
+			prevSkip := skip - limit
+			if prevSkip < 0 {
+				prevSkip = 0
+			}
+			links = append(links, fmt.Sprintf("<%s>; rel=\"prev\"", pageURL(r, prevSkip, limit)))
+		}
+	}
+	if result.Next != nil {
+		w.Header().Set("X-Next-Cursor", result.Next.Encode())
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+func pageURL(r *http.Request, skip int64, limit int64) string {
+	pageURL := *r.URL
+	queryParams := pageURL.Query()
+	queryParams.Set("skip", strconv.FormatInt(skip, 10))
+	queryParams.Set("limit", strconv.FormatInt(limit, 10))
+	pageURL.RawQuery = queryParams.Encode()
+	return pageURL.RequestURI()
+}
+
+func cursorPageURL(r *http.Request, cursor string) string {
+	pageURL := *r.URL
+	queryParams := pageURL.Query()
+	queryParams.Del("skip")
+	queryParams.Set("cursor", cursor)
+	pageURL.RawQuery = queryParams.Encode()
+	return pageURL.RequestURI()
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"io/ioutil"
+	"monkiato/apio/internal/data"
+	"monkiato/apio/internal/storage"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -22,6 +24,46 @@ func Test_addErrorResponse(t *testing.T) {
 	}
 }
 
+func Test_addValidationErrorResponse(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPut, "/api/books/", nil)
+	addValidationErrorResponse(recorder, request, http.StatusBadRequest, "testing error", []data.FieldError{
+		{Field: "name", Code: data.ErrorCodeRequired, Message: "field is required"},
+	})
+	if recorder.Code != 400 {
+		t.Error("unexpected status code")
+	}
+	data, err := ioutil.ReadAll(recorder.Body)
+	if err != nil {
+		t.Errorf("unexpected error reading body: " + err.Error())
+	}
+	if string(data) != "{\"error\":{\"fields\":[{\"field\":\"name\",\"code\":\"required\",\"message\":\"field is required\"}],\"msg\":\"testing error\"},\"success\":false}" {
+		t.Error("unexpected body: " + string(data))
+	}
+}
+
+func Test_addValidationErrorResponse_problemJSON(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPut, "/api/books/", nil)
+	request.Header.Set("Accept", "application/json, application/problem+json;q=0.9")
+	addValidationErrorResponse(recorder, request, http.StatusBadRequest, "testing error", []data.FieldError{
+		{Field: "name", Code: data.ErrorCodeRequired, Message: "field is required"},
+	})
+	if recorder.Code != 400 {
+		t.Error("unexpected status code")
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Error("unexpected content type: " + contentType)
+	}
+	data, err := ioutil.ReadAll(recorder.Body)
+	if err != nil {
+		t.Errorf("unexpected error reading body: " + err.Error())
+	}
+	if string(data) != "{\"detail\":\"testing error\",\"errors\":[{\"field\":\"name\",\"code\":\"required\",\"message\":\"field is required\"}],\"status\":400,\"title\":\"Bad Request\",\"type\":\"about:blank\"}" {
+		t.Error("unexpected body: " + string(data))
+	}
+}
+
 func Test_addSuccessResponse(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	addSuccessResponse(recorder, http.StatusOK, nil)
@@ -53,3 +95,62 @@ func Test_addSuccessResponse_withExtraData(t *testing.T) {
 		t.Error("unexpected body: " + string(data))
 	}
 }
+
+func Test_prefersRepresentation(t *testing.T) {
+	cases := map[string]bool{
+		"":                                     false,
+		"return=minimal":                       false,
+		"return=representation":                true,
+		"Return=Representation; charset=utf8":  true,
+		"respond-async, return=representation": true,
+	}
+	for prefer, expected := range cases {
+		request := httptest.NewRequest(http.MethodPut, "/api/books/", nil)
+		request.Header.Set("Prefer", prefer)
+		if prefersRepresentation(request) != expected {
+			t.Errorf("unexpected result for prefer header '%s'", prefer)
+		}
+	}
+	if !prefersRepresentation(httptest.NewRequest(http.MethodPut, "/api/books/?return=item", nil)) {
+		t.Error("expected representation for return=item query param")
+	}
+}
+
+func Test_addPaginationHeaders(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/api/books/?skip=10&limit=5&sort=name", nil)
+	addPaginationHeaders(recorder, request, storage.QueryParams{Skip: 10, Limit: 5}, storage.QueryResult{}, 30)
+	if recorder.Header().Get("X-Total-Count") != "30" {
+		t.Error("unexpected total count header: " + recorder.Header().Get("X-Total-Count"))
+	}
+	expectedLink := "</api/books/?limit=5&skip=15&sort=name>; rel=\"next\", </api/books/?limit=5&skip=5&sort=name>; rel=\"prev\""
+	if recorder.Header().Get("Link") != expectedLink {
+		t.Error("unexpected link header: " + recorder.Header().Get("Link"))
+	}
+}
+
+func Test_addPaginationHeaders_singlePage(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/api/books/", nil)
+	addPaginationHeaders(recorder, request, storage.QueryParams{Limit: 20}, storage.QueryResult{}, 3)
+	if recorder.Header().Get("X-Total-Count") != "3" {
+		t.Error("unexpected total count header: " + recorder.Header().Get("X-Total-Count"))
+	}
+	if _, exists := recorder.Header()["Link"]; exists {
+		t.Error("unexpected link header: " + recorder.Header().Get("Link"))
+	}
+}
+
+func Test_addPaginationHeaders_cursor(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/api/books/?cursor=abc&skip=10", nil)
+	next := &storage.Cursor{ID: "2"}
+	addPaginationHeaders(recorder, request, storage.QueryParams{After: &storage.Cursor{ID: "1"}, Limit: 5}, storage.QueryResult{Next: next}, 30)
+	if recorder.Header().Get("X-Next-Cursor") != next.Encode() {
+		t.Error("unexpected next cursor header: " + recorder.Header().Get("X-Next-Cursor"))
+	}
+	expectedLink := "</api/books/?cursor=" + next.Encode() + ">; rel=\"next\""
+	if recorder.Header().Get("Link") != expectedLink {
+		t.Error("unexpected link header: " + recorder.Header().Get("Link"))
+	}
+}
@@ -1,13 +1,18 @@
 package server
 
 import (
+	"context"
 	log "github.com/sirupsen/logrus"
 	"monkiato/apio/internal/storage"
+	"net/http"
+	"time"
 )
 
 var (
 	//Storage main and unique storage instance used across the api
 	Storage storage.Storage
+	//StorageTimeout max duration of the storage operations executed for a single request
+	StorageTimeout = 5 * time.Second
 )
 
 const (
@@ -15,6 +20,13 @@ const (
 	StorageTypeMemory  = "memory"
 	//StorageTypeMongoDB identifier for storage.mongodb
 	StorageTypeMongoDB = "mongodb"
+	//StorageTypeFile identifier for storage.file
+	StorageTypeFile = "file"
+	//StorageTypeSQLite identifier for storage.sqlite
+	StorageTypeSQLite = "sqlite"
+
+	//APIPathPrefix path prefix used for all the collection endpoints
+	APIPathPrefix = "/api/"
 )
 
 // InitStorage is an encapsulated function for the storage initialization process
@@ -27,6 +39,12 @@ func InitStorage(apiManifest string, storageType string) {
 	case StorageTypeMemory:
 		Storage = storage.NewMemoryStorage()
 		break
+	case StorageTypeFile:
+		Storage = storage.NewFileStorage()
+		break
+	case StorageTypeSQLite:
+		Storage = storage.NewSQLiteStorage()
+		break
 	default:
 		log.Fatalf("unexoected storage type initialization: " + storageType)
 		break
@@ -34,3 +52,9 @@ func InitStorage(apiManifest string, storageType string) {
 	Storage.Initialize(apiManifest)
 	log.Debugf("storage ready. type: %T", Storage)
 }
+
+// storageContext creates the context used for storage operations, it's derived from the request context, so the
+// operations are cancelled when the client disconnects or the StorageTimeout is reached
+func storageContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), StorageTimeout)
+}